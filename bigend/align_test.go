@@ -0,0 +1,129 @@
+package bigend
+
+import (
+	"bytes"
+	"errors"
+	"math"
+	"testing"
+)
+
+type alignIn struct {
+	A uint8
+	B uint64
+	C uint16
+}
+
+type alignRec struct {
+	X    uint8
+	Y    uint32
+	Z    uint16
+	In   [2]alignIn
+	W    uint8
+	F1   uint8  `binary:"bits=3"`
+	F2   uint16 `binary:"bits=9"`
+	F3   uint32 `binary:"bits=30"`
+	F4   bool   `binary:"bits=1"`
+	D    float64
+	E    uint8
+	Al   uint8 `binary:"align=16"`
+	Tail uint8
+}
+
+type alignBits struct {
+	X uint8
+	A uint32 `binary:"bits=4"`
+	B uint32 `binary:"bits=30"`
+	Y uint8
+}
+
+type alignPair struct {
+	S uint16
+	C uint8
+}
+
+type alignVar struct {
+	N    uint8
+	Data []uint32 `binary:"len=N"`
+	T    uint16
+}
+
+func padTo(b []byte, n int) []byte {
+	for len(b)%n != 0 {
+		b = append(b, 0)
+	}
+	return b
+}
+
+func TestNaturalAlign(t *testing.T) {
+	c := Codec{NaturalAlign: true}
+	a := alignRec{X: 1, Y: 2, Z: 3, In: [2]alignIn{{4, 5, 6}, {7, 8, 9}}, W: 10,
+		F1: 5, F2: 300, F3: 0x3ffffff0, F4: true, D: 1.5, E: 11, Al: 12, Tail: 13}
+	want := AppendUint32(padTo([]byte{1}, 4), 2)
+	want = AppendUint16(want, 3)
+	for _, in := range a.In {
+		want = AppendUint64(padTo(append(padTo(want, 8), in.A), 8), in.B)
+		want = AppendUint16(want, in.C)
+	}
+	want = append(padTo(want, 8), 10)
+	// The bit fields share storage units the way a C compiler packs them.
+	if bigEndian {
+		want = AppendUint32(AppendUint16(append(want, 0xa0), 0x9600), 0xffffffc2)
+	} else {
+		want = AppendUint32(AppendUint16(append(want, 0x05), 300), 0x7ffffff0)
+	}
+	want = append(AppendUint64(want, math.Float64bits(1.5)), 11)
+	want = padTo(append(padTo(want, 16), 12, 13), 16)
+
+	bits := []byte{1, 0x0f, 0, 0}
+	bits = append(AppendUint32(bits, 0x3fffffff), 2, 0, 0, 0)
+	if bigEndian {
+		bits = append([]byte{1, 0xf0, 0, 0}, bits[4:]...)
+		PutUint32(bits[4:], 0xfffffffc)
+	}
+	for _, tt := range []struct {
+		v    any
+		want []byte
+	}{
+		{a, want},
+		{alignBits{1, 0xf, 0x3fffffff, 2}, bits},
+		{[]alignPair{{1, 2}, {3, 4}}, append(AppendUint16(append(AppendUint16(nil, 1), 2, 0), 3), 4, 0)},
+	} {
+		b, err := c.Append(nil, tt.v)
+		if err != nil || !bytes.Equal(b, tt.want) {
+			t.Errorf("Append(%+v) = %x, %v, want %x", tt.v, b, err, tt.want)
+		}
+		if n := c.Size(tt.v); n != len(tt.want) {
+			t.Errorf("Size(%+v) = %d, want %d", tt.v, n, len(tt.want))
+		}
+	}
+	var got alignRec
+	if n, err := c.Decode(want, &got); err != nil || n != len(want) || got != a {
+		t.Errorf("Decode = %d, %+v, %v", n, got, err)
+	}
+
+	strict := c
+	strict.Strict = true
+	want[2] = 1
+	var se *StrictError
+	if _, err := strict.Decode(want, &got); !errors.As(err, &se) || se.Offset != 2 {
+		t.Errorf("strict Decode with non-zero padding = %v", err)
+	}
+
+	// Variable size fields are aligned too.
+	v := alignVar{Data: []uint32{1, 2}, T: 3}
+	want = AppendUint32(AppendUint32(padTo([]byte{2}, 4), 1), 2)
+	want = padTo(AppendUint16(want, 3), 4)
+	b, err := c.Append(nil, v)
+	if err != nil || !bytes.Equal(b, want) || c.Size(v) != len(want) {
+		t.Fatalf("Append(%+v) = %x, %v, want %x", v, b, err, want)
+	}
+	var gv alignVar
+	if n, err := c.Decode(b, &gv); err != nil || n != len(b) || gv.N != 2 || gv.Data[1] != 2 || gv.T != 3 {
+		t.Errorf("Decode = %d, %+v, %v", n, gv, err)
+	}
+
+	// Without NaturalAlign the encoding stays packed.
+	if n := Size(alignPair{}); n != 3 {
+		t.Errorf("packed Size = %d, want 3", n)
+	}
+}
@@ -0,0 +1,86 @@
+package bigend
+
+import (
+	"io"
+	"reflect"
+)
+
+func ReadAt(ra io.ReaderAt, off int64, data any) error {
+	return Codec{}.ReadAt(ra, off, data)
+}
+
+// ReadAt reads structured binary data from ra at offset off into data.
+// Values of a known size up to a chunk are read with a single ReadAt call.
+func (c Codec) ReadAt(ra io.ReaderAt, off int64, data any) error {
+	size := intDataSize(data)
+	if size == 0 {
+		if isNil(data) {
+			return nilPointer(reflect.TypeOf(data))
+		}
+		_, size = c.decodeValue(data)
+	}
+	if size < 0 || size > chunkSize || c.MaxBytes > 0 && size > c.MaxBytes {
+		return c.Read(&offsetReader{ra: ra, off: off}, data)
+	}
+
+	bp := chunkPool.Get().(*[]byte)
+	defer chunkPool.Put(bp)
+	bs := (*bp)[:size]
+	if n, err := ra.ReadAt(bs, off); n < size {
+		if err == io.EOF && n > 0 {
+			err = io.ErrUnexpectedEOF
+		}
+		return err
+	}
+	_, err := c.Decode(bs, data)
+	return err
+}
+
+func WriteAt(wa io.WriterAt, off int64, data any) error {
+	return Codec{}.WriteAt(wa, off, data)
+}
+
+// WriteAt writes the binary representation of data into wa at offset off.
+// Values of a known size up to a chunk are written with a single WriteAt call.
+func (c Codec) WriteAt(wa io.WriterAt, off int64, data any) error {
+	size := intDataSize(data)
+	if size == 0 && !isNil(data) {
+		size = c.typeSize(reflect.Indirect(reflect.ValueOf(data)))
+	}
+	if size < 0 || size > chunkSize {
+		return c.Write(&offsetWriter{wa: wa, off: off}, data)
+	}
+
+	bp := chunkPool.Get().(*[]byte)
+	defer chunkPool.Put(bp)
+	bs, err := c.Append((*bp)[:0], data)
+	if err != nil {
+		return err
+	}
+	_, err = wa.WriteAt(bs, off)
+	return err
+}
+
+// offsetReader reads from an io.ReaderAt from an offset onwards.
+type offsetReader struct {
+	ra  io.ReaderAt
+	off int64
+}
+
+func (r *offsetReader) Read(p []byte) (int, error) {
+	n, err := r.ra.ReadAt(p, r.off)
+	r.off += int64(n)
+	return n, err
+}
+
+// offsetWriter writes to an io.WriterAt from an offset onwards.
+type offsetWriter struct {
+	wa  io.WriterAt
+	off int64
+}
+
+func (w *offsetWriter) Write(p []byte) (int, error) {
+	n, err := w.wa.WriteAt(p, w.off)
+	w.off += int64(n)
+	return n, err
+}
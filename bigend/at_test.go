@@ -0,0 +1,66 @@
+package bigend
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+type atPage struct {
+	No   uint32
+	Kind uint8
+	Data [11]byte
+}
+
+func TestReadAtWriteAt(t *testing.T) {
+	f, err := os.Create(filepath.Join(t.TempDir(), "pages"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	for i := 0; i < 4; i++ {
+		if err := WriteAt(f, int64(i*16), atPage{No: uint32(i), Kind: 7}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Large values go through the same path as small ones.
+	big := make([]uint64, 20000)
+	big[len(big)-1] = 42
+	if err := WriteAt(f, 64, big); err != nil {
+		t.Fatal(err)
+	}
+	end := int64(64 + 8*len(big))
+
+	var p atPage
+	if err := ReadAt(f, 32, &p); err != nil || p != (atPage{No: 2, Kind: 7}) {
+		t.Errorf("ReadAt(32) = %+v, %v", p, err)
+	}
+	var x uint32
+	if err := ReadAt(f, 48, &x); err != nil || x != 3 {
+		t.Errorf("ReadAt(48) = %d, %v", x, err)
+	}
+	got := make([]uint64, len(big))
+	if err := ReadAt(f, 64, got); err != nil || got[len(got)-1] != 42 {
+		t.Errorf("ReadAt(64) = %v", err)
+	}
+	if err := ReadAt(f, end-4, &p); err != io.ErrUnexpectedEOF {
+		t.Errorf("ReadAt across the end = %v", err)
+	}
+	if err := ReadAt(f, end, &p); err != io.EOF {
+		t.Errorf("ReadAt at the end = %v", err)
+	}
+	if n := testing.AllocsPerRun(100, func() { ReadAt(f, 32, &p) }); n != 0 {
+		t.Errorf("ReadAt of a struct allocates %v times", n)
+	}
+
+	c := Codec{LenSize: 1}
+	if err := c.WriteAt(f, 0, struct{ S string }{"hey"}); err != nil {
+		t.Errorf("WriteAt of a variable size value = %v", err)
+	}
+	var s struct{ S string }
+	if err := c.ReadAt(bytes.NewReader([]byte{3, 'a', 'b', 'c'}), 0, &s); err != nil || s.S != "abc" {
+		t.Errorf("ReadAt of a variable size value = %+v, %v", s, err)
+	}
+}
@@ -0,0 +1,128 @@
+package bigend
+
+import (
+	"errors"
+	"strconv"
+)
+
+// Builder appends big-endian binary data to a byte slice. Lengths and
+// offsets that are only known once more data is appended are reserved as
+// placeholders, and patched later.
+//
+// The zero value is an empty Builder ready to use. A Builder is an
+// io.Writer, so values can be appended with Write or Codec.Write.
+type Builder struct {
+	buf    []byte
+	scopes []Mark // open BeginLength scopes, innermost last
+	err    error
+}
+
+// Mark is a placeholder appended by a Builder.
+type Mark struct {
+	off  int // offset of the placeholder in the buffer
+	size int // size of the placeholder in bytes
+}
+
+// NewBuilder returns a Builder appending to buf.
+func NewBuilder(buf []byte) *Builder {
+	return &Builder{buf: buf}
+}
+
+// Bytes returns the built data. It fails if a placeholder overflowed,
+// or if a BeginLength scope is still open.
+func (b *Builder) Bytes() ([]byte, error) {
+	if b.err == nil && len(b.scopes) > 0 {
+		return b.buf, errors.New("binary: Builder has an open length scope")
+	}
+	return b.buf, b.err
+}
+
+// Len returns the number of bytes built, which is the offset of the next byte.
+func (b *Builder) Len() int { return len(b.buf) }
+
+func (b *Builder) Uint8(x uint8) { b.buf = append(b.buf, x) }
+
+func (b *Builder) Uint16(x uint16) { b.buf = AppendUint16(b.buf, x) }
+
+func (b *Builder) Uint32(x uint32) { b.buf = AppendUint32(b.buf, x) }
+
+func (b *Builder) Uint64(x uint64) { b.buf = AppendUint64(b.buf, x) }
+
+// Write appends p. It never fails.
+func (b *Builder) Write(p []byte) (int, error) {
+	b.buf = append(b.buf, p...)
+	return len(p), nil
+}
+
+func (b *Builder) Reserve8() Mark { return b.reserve(1) }
+
+func (b *Builder) Reserve16() Mark { return b.reserve(2) }
+
+func (b *Builder) Reserve32() Mark { return b.reserve(4) }
+
+func (b *Builder) Reserve64() Mark { return b.reserve(8) }
+
+// reserve appends a zero placeholder of size bytes.
+func (b *Builder) reserve(size int) Mark {
+	var zero [8]byte
+	m := Mark{off: len(b.buf), size: size}
+	b.buf = append(b.buf, zero[:size]...)
+	return m
+}
+
+// Patch stores into the placeholder m the number of bytes appended after it.
+func (b *Builder) Patch(m Mark) {
+	b.PatchValue(m, uint64(len(b.buf)-m.off-m.size))
+}
+
+// PatchOffset stores into the placeholder m the offset of the next byte
+// appended, as in offset tables pointing to data that follows them.
+func (b *Builder) PatchOffset(m Mark) {
+	b.PatchValue(m, uint64(len(b.buf)))
+}
+
+// PatchValue stores x into the placeholder m.
+func (b *Builder) PatchValue(m Mark, x uint64) {
+	if m.size < 8 && x>>(8*m.size) != 0 {
+		if b.err == nil {
+			b.err = errors.New("binary: " + strconv.FormatUint(x, 10) + " overflows a " + strconv.Itoa(m.size) + "-byte placeholder")
+		}
+		return
+	}
+	p := b.buf[m.off : m.off+m.size]
+	switch m.size {
+	case 1:
+		p[0] = uint8(x)
+	case 2:
+		PutUint16(p, uint16(x))
+	case 4:
+		PutUint32(p, uint32(x))
+	case 8:
+		PutUint64(p, x)
+	}
+}
+
+// BeginLength8 appends a 1-byte length placeholder, which the matching
+// EndLength fills with the number of bytes appended after it.
+// Length scopes can be nested.
+func (b *Builder) BeginLength8() { b.scopes = append(b.scopes, b.Reserve8()) }
+
+func (b *Builder) BeginLength16() { b.scopes = append(b.scopes, b.Reserve16()) }
+
+func (b *Builder) BeginLength32() { b.scopes = append(b.scopes, b.Reserve32()) }
+
+func (b *Builder) BeginLength64() { b.scopes = append(b.scopes, b.Reserve64()) }
+
+// EndLength ends the innermost length scope and patches its length.
+func (b *Builder) EndLength() {
+	n := len(b.scopes) - 1
+	if n < 0 {
+		if b.err == nil {
+			b.err = errors.New("binary: Builder.EndLength without BeginLength")
+		}
+		return
+	}
+	m := b.scopes[n]
+	b.scopes = b.scopes[:n]
+	b.Patch(m)
+}
@@ -0,0 +1,59 @@
+package bigend
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestBuilder(t *testing.T) {
+	var b Builder
+	b.Write([]byte("RIFF"))
+	b.BeginLength32()
+	b.Write([]byte("WAVE"))
+	b.Write([]byte("fmt "))
+	b.BeginLength32()
+	if err := Write(&b, struct{ A, B uint16 }{1, 2}); err != nil {
+		t.Fatal(err)
+	}
+	b.EndLength()
+	b.EndLength()
+	want := append(AppendUint32([]byte("RIFF"), 16), "WAVEfmt "...)
+	want = AppendUint16(AppendUint16(AppendUint32(want, 4), 1), 2)
+	if got, err := b.Bytes(); err != nil || !bytes.Equal(got, want) {
+		t.Errorf("Bytes = %x, %v, want %x", got, err, want)
+	}
+
+	// Offsets are patched with the position at the time of the call.
+	tb := NewBuilder([]byte("II*\x00"))
+	ifd := tb.Reserve32()
+	tb.PatchOffset(ifd)
+	tb.Uint16(1)
+	val := tb.Reserve32()
+	tb.PatchOffset(val)
+	tb.Write([]byte("hello"))
+	want = AppendUint32([]byte("II*\x00"), 8)
+	want = append(AppendUint32(AppendUint16(want, 1), 14), "hello"...)
+	if got, err := tb.Bytes(); err != nil || !bytes.Equal(got, want) {
+		t.Errorf("Bytes = %x, %v, want %x", got, err, want)
+	}
+
+	var ob Builder
+	ob.BeginLength8()
+	ob.Write(make([]byte, 300))
+	ob.EndLength()
+	ob.BeginLength16()
+	if _, err := ob.Bytes(); err == nil {
+		t.Error("Bytes after a length overflowing its placeholder succeeded")
+	}
+	var ub Builder
+	ub.EndLength()
+	ub.BeginLength16()
+	if _, err := ub.Bytes(); err == nil {
+		t.Error("Bytes after EndLength without BeginLength succeeded")
+	}
+	ub = Builder{}
+	ub.BeginLength16()
+	if _, err := ub.Bytes(); err == nil {
+		t.Error("Bytes with an open length scope succeeded")
+	}
+}
@@ -0,0 +1,45 @@
+package bigend
+
+import (
+	"reflect"
+
+	"github.com/go-perf/encoding/internal/wire"
+)
+
+// condition is the presence condition of a struct field declared with
+// an if= or since= tag, resolved against the fields of the struct.
+type condition struct {
+	wire.Cond
+	index int // index of the earlier field
+}
+
+// present reports whether the field with condition c is present in the struct v.
+func (c *condition) present(v reflect.Value) bool {
+	return c.Present(fieldUint(v.Field(c.index)))
+}
+
+// setCondition resolves the field named name of a condition against
+// the fields of si. It reports false if there is no such earlier
+// integer or bool field.
+func (si *structInfo) setCondition(t reflect.Type, c *condition, name string) bool {
+	for _, f := range si.fields {
+		for _, bf := range f.bits {
+			if !bf.skip && t.Field(bf.index).Name == name {
+				c.index = bf.index
+				return true
+			}
+		}
+		if f.bits != nil || f.skip || f.ref != wire.RefNone || t.Field(f.index).Name != name {
+			continue
+		}
+		switch f.typ.Kind() {
+		case reflect.Bool,
+			reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+			reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			c.index = f.index
+			return true
+		}
+		return false
+	}
+	return false
+}
@@ -0,0 +1,69 @@
+package bigend
+
+import (
+	"bytes"
+	"testing"
+)
+
+type condRec struct {
+	Version uint8
+	Flags   uint8
+	A       uint32
+	B       uint16  `binary:"if=Flags&0x4"`
+	C       uint64  `binary:"since=3,version=Version"`
+	_       [2]byte `binary:"version=Version,since=4"`
+	On      bool    `binary:"bits=1"`
+	Pad     uint8   `binary:"bits=7"`
+	D       [3]byte `binary:"if=On"`
+}
+
+type condLate struct {
+	B     uint16 `binary:"if=Flags&0x4"`
+	Flags uint8
+}
+
+func TestConditionalFields(t *testing.T) {
+	on := byte(0x01)
+	if bigEndian {
+		on = 0x80
+	}
+	v1 := AppendUint32([]byte{1, 0}, 1)
+	v3 := AppendUint64(AppendUint16(AppendUint32([]byte{3, 4}, 1), 2), 3)
+	v4 := AppendUint64(AppendUint16(AppendUint32([]byte{4, 5}, 1), 2), 3)
+	for _, tt := range []struct {
+		in   condRec
+		want []byte
+	}{
+		{condRec{Version: 1, A: 1, B: 2, C: 3, D: [3]byte{1, 2, 3}}, append(v1, 0)},
+		{condRec{Version: 3, Flags: 4, A: 1, B: 2, C: 3, On: true, D: [3]byte{1, 2, 3}}, append(v3, on, 1, 2, 3)},
+		{condRec{Version: 4, Flags: 5, A: 1, B: 2, C: 3}, append(v4, 0, 0, 0)},
+	} {
+		b, err := Append(nil, tt.in)
+		if err != nil || !bytes.Equal(b, tt.want) {
+			t.Errorf("Append(%+v) = %x, %v, want %x", tt.in, b, err, tt.want)
+			continue
+		}
+		if n := Size(tt.in); n != len(tt.want) {
+			t.Errorf("Size(%+v) = %d, want %d", tt.in, n, len(tt.want))
+		}
+		// Absent fields decode as zero.
+		want := tt.in
+		if want.Flags&4 == 0 {
+			want.B = 0
+		}
+		if want.Version < 3 {
+			want.C = 0
+		}
+		if !want.On {
+			want.D = [3]byte{}
+		}
+		got := condRec{B: 9, C: 9, D: [3]byte{9}}
+		if n, err := Decode(b, &got); err != nil || n != len(b) || got != want {
+			t.Errorf("Decode(%x) = %d, %+v, %v, want %+v", b, n, got, err, want)
+		}
+	}
+
+	if _, err := Append(nil, condLate{}); err == nil {
+		t.Error("Append of a condition on a later field succeeded")
+	}
+}
@@ -0,0 +1,155 @@
+package bigend
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/go-perf/encoding/internal/wire"
+)
+
+// stringFormat is the encoding of a string field declared with a fixed=,
+// cstring, utf16 or ucs2 tag.
+type stringFormat struct {
+	wire.StringFormat
+}
+
+// encodedLen returns the size of s encoded in the format, without
+// a length prefix, terminator or padding.
+func (sf *stringFormat) encodedLen(s string) int {
+	if sf.UTF16 {
+		return 2 * utf16Len(s)
+	}
+	return len(s)
+}
+
+var errStringNUL = errors.New("binary: string contains a NUL character")
+
+func errFixedOverflow(n, fixed int) error {
+	return errors.New("binary: string of " + strconv.Itoa(n) + " bytes overflows fixed=" + strconv.Itoa(fixed))
+}
+
+// formatString decodes the string field f of the struct v.
+func (d *decoder) formatString(v reflect.Value, f *field) {
+	fv := v.Field(f.index)
+	switch {
+	case f.size != variable && f.str.UTF16:
+		d.fixedUTF16(fv, f)
+	case f.size != variable:
+		d.fixedString(fv, f)
+	case f.str.CString && f.str.UTF16:
+		d.cstringUTF16(fv)
+	case f.str.CString:
+		d.cstring(fv)
+	case f.ref != wire.RefNone:
+		d.utf16Units(fv, v.Field(f.from), f.ref)
+	default:
+		d.utf16Units(fv, reflect.Value{}, wire.RefNone)
+	}
+}
+
+// formatString encodes the string field f of the struct v.
+func (e *encoder) formatString(v reflect.Value, f *field) {
+	fv := v.Field(f.index)
+	switch {
+	case f.size != variable && f.str.UTF16:
+		e.fixedUTF16(fv, f)
+	case f.size != variable:
+		e.fixedString(fv, f)
+	case f.str.CString && f.str.UTF16:
+		e.cstringUTF16(fv, f)
+	case f.str.CString:
+		e.cstring(fv)
+	default:
+		e.utf16Units(fv, f.str, f.ref)
+	}
+}
+
+// fixedString decodes a string of f.size bytes, which ends at the first NUL byte.
+func (d *decoder) fixedString(v reflect.Value, f *field) {
+	pos := d.pos()
+	b := d.next(f.size)
+	n := bytes.IndexByte(b, 0)
+	if n < 0 {
+		n = len(b)
+		if d.c.Strict && f.str.CString {
+			d.fail(&StrictError{Offset: pos, Msg: "unterminated string"})
+		}
+	} else if d.c.Strict {
+		for i, x := range b[n:] {
+			if x != 0 {
+				d.fail(&StrictError{Offset: pos + n + i, Msg: "non-zero string padding"})
+				break
+			}
+		}
+	}
+	v.SetString(string(b[:n]))
+}
+
+// fixedString encodes v as f.size bytes, padded with NUL bytes.
+func (e *encoder) fixedString(v reflect.Value, f *field) {
+	s := v.String()
+	max := f.size
+	if f.str.CString {
+		max--
+	}
+	if len(s) > max {
+		if !f.str.Truncate {
+			e.fail(errFixedOverflow(len(s), f.size))
+			return
+		}
+		for max > 0 && !utf8.RuneStart(s[max]) {
+			max--
+		}
+		s = s[:max]
+	}
+	if strings.IndexByte(s, 0) >= 0 {
+		e.fail(errStringNUL)
+		return
+	}
+	b := e.next(f.size)
+	n := copy(b, s)
+	for i := n; i < len(b); i++ {
+		b[i] = 0
+	}
+}
+
+// cstring decodes a NUL-terminated string.
+func (d *decoder) cstring(v reflect.Value) {
+	var s []byte
+	for {
+		if d.offset == len(d.buf) && !d.fill(1) {
+			return
+		}
+		b := d.buf[d.offset:]
+		end := bytes.IndexByte(b, 0)
+		if end >= 0 {
+			b = b[:end]
+		}
+		s = append(s, b...)
+		d.offset += len(b)
+		if max := d.c.MaxLen; max > 0 && len(s) > max {
+			d.fail(&LimitError{Limit: "MaxLen", Offset: d.pos()})
+			return
+		}
+		if end >= 0 {
+			d.offset++ // NUL byte
+			break
+		}
+	}
+	v.SetString(string(s))
+}
+
+// cstring encodes v followed by a NUL byte.
+func (e *encoder) cstring(v reflect.Value) {
+	s := v.String()
+	if strings.IndexByte(s, 0) >= 0 {
+		e.fail(errStringNUL)
+		return
+	}
+	e.stringBytes(s)
+	e.uint8(0)
+}
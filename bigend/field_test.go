@@ -0,0 +1,110 @@
+package bigend
+
+import (
+	"reflect"
+	"testing"
+)
+
+type fieldKind uint16
+
+type fieldHdr struct {
+	Ver  uint8  `binary:"bits=3"`
+	Neg  int8   `binary:"bits=4"`
+	On   bool   `binary:"bits=1"`
+	Wide uint16 `binary:"bits=12"`
+	_    uint16 `binary:"bits=4"`
+	Seq  uint32
+	K    fieldKind
+	N    int
+	Z    complex64
+	In   [2]struct{ F float64 }
+	Ack  U32
+}
+
+func TestField(t *testing.T) {
+	v := fieldHdr{Ver: 5, Neg: -3, On: true, Wide: 0xabc, Seq: 0x01020304, K: 7, N: -9, Z: complex(1, -2)}
+	v.In[1].F = 2.5
+	v.Ack.Set(0x0a0b0c0d)
+	ty := reflect.TypeOf(v)
+	for _, c := range []Codec{{IntSize: 4}, {IntSize: 8, NaturalAlign: true}} {
+		b, err := c.Append(nil, &v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		seq, err1 := CodecField[uint32](c, ty, "Seq")
+		neg, err2 := CodecField[int8](c, ty, "Neg")
+		wide, err3 := CodecField[uint16](c, ty, "Wide")
+		on, err4 := CodecField[bool](c, ty, "On")
+		k, err5 := CodecField[fieldKind](c, ty, "K")
+		n, err6 := CodecField[int](c, ty, "N")
+		z, err7 := CodecField[complex64](c, ty, "Z")
+		f, err8 := CodecField[float64](c, ty, "In[1].F")
+		ack, err9 := CodecField[uint32](c, ty, "Ack")
+		for _, err := range []error{err1, err2, err3, err4, err5, err6, err7, err8, err9} {
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		if seq.Get(b) != v.Seq || neg.Get(b) != -3 || wide.Get(b) != 0xabc || !on.Get(b) || k.Get(b) != 7 ||
+			n.Get(b) != -9 || z.Get(b) != v.Z || f.Get(b) != 2.5 || ack.Get(b) != 0x0a0b0c0d {
+			t.Errorf("%+v: Get = %v %v %v %v %v %v %v %v %#x", c, seq.Get(b), neg.Get(b), wide.Get(b), on.Get(b),
+				k.Get(b), n.Get(b), z.Get(b), f.Get(b), ack.Get(b))
+		}
+
+		seq.Set(b, 99)
+		neg.Set(b, 6)
+		wide.Set(b, 0x123)
+		on.Set(b, false)
+		k.Set(b, 300)
+		n.Set(b, 12)
+		z.Set(b, 3i)
+		f.Set(b, -1)
+		ack.Set(b, 7)
+		var got fieldHdr
+		if _, err := c.Decode(b, &got); err != nil {
+			t.Fatal(err)
+		}
+		want := v
+		want.Seq, want.Neg, want.Wide, want.On, want.K, want.N, want.Z, want.In[1].F = 99, 6, 0x123, false, 300, 12, 3i, -1
+		want.Ack.Set(7)
+		if got != want {
+			t.Errorf("%+v: after Set\n got %+v\nwant %+v", c, got, want)
+		}
+
+		if _, err := CodecField[uint16](c, ty, "Seq"); err == nil {
+			t.Error("CodecField of the wrong kind succeeded")
+		}
+		if _, err := CodecField[uint16](c, ty, "Ack"); err == nil {
+			t.Error("CodecField of the wrong size for a U32 succeeded")
+		}
+		if _, err := CodecField[uint16](c, ty, "None"); err == nil {
+			t.Error("CodecField of a missing field succeeded")
+		}
+	}
+
+	if _, err := Field[uint8](reflect.TypeOf(struct{ B [4]byte }{}), "B"); err == nil {
+		t.Error("Field of a byte array succeeded")
+	}
+	if _, err := Field[uint8](reflect.TypeOf(struct{ B []byte }{}), "B"); err == nil {
+		t.Error("Field of a type of variable size succeeded")
+	}
+}
+
+func TestFieldAllocs(t *testing.T) {
+	a, err := Field[uint64](reflect.TypeOf(struct {
+		A uint16
+		B uint64
+	}{}), "B")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := make([]byte, 10)
+	a.Set(b, 42)
+	if a.Get(b) != 42 || Uint64(b[2:]) != 42 {
+		t.Errorf("Get = %d, encoding %x", a.Get(b), b)
+	}
+	if n := testing.AllocsPerRun(100, func() { a.Set(b, a.Get(b)+1) }); n != 0 {
+		t.Errorf("Get and Set allocate %v times", n)
+	}
+}
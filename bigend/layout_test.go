@@ -0,0 +1,102 @@
+package bigend
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type layoutHdr struct {
+	A   uint8 `binary:"bits=3"`
+	_   uint8 `binary:"bits=2"`
+	B   bool  `binary:"bits=1"`
+	Seq [4]byte
+	In  [2]struct{ X int16 }
+	S   string `binary:"fixed=4"`
+	W   string `binary:"fixed=4,utf16"`
+	Mac [6]byte
+}
+
+type layoutVar struct {
+	N    uint8
+	Data []uint16 `binary:"len=N"`
+	Name string
+}
+
+func TestLayout(t *testing.T) {
+	ord := order(2) // the Order of values in the byte order of the package
+	want := []FieldLayout{
+		{Path: "A", Offset: 0, Size: 1, Kind: reflect.Uint8, Order: ord, BitOffset: 0, Bits: 3},
+		{Path: "B", Offset: 0, Size: 1, Kind: reflect.Bool, Order: ord, BitOffset: 5, Bits: 1},
+		{Path: "Seq", Offset: 1, Size: 4, Kind: reflect.Array},
+		{Path: "In[0].X", Offset: 5, Size: 2, Kind: reflect.Int16, Order: ord},
+		{Path: "In[1].X", Offset: 7, Size: 2, Kind: reflect.Int16, Order: ord},
+		{Path: "S", Offset: 9, Size: 4, Kind: reflect.String},
+		{Path: "W", Offset: 13, Size: 4, Kind: reflect.String, Order: ord},
+		{Path: "Mac", Offset: 17, Size: 6, Kind: reflect.Array},
+	}
+	fl, err := Layout(reflect.TypeOf(layoutHdr{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(fl, want) {
+		t.Errorf("Layout:\n got %+v\nwant %+v", fl, want)
+	}
+
+	// The wire types are byte arrays too.
+	fl, err = Layout(reflect.TypeOf(struct{ X U16 }{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fl) != 1 || fl[0].Size != 2 || fl[0].Kind != reflect.Array {
+		t.Errorf("Layout of a U16 field = %+v", fl)
+	}
+
+	fl, err = Codec{NaturalAlign: true}.Layout(reflect.TypeOf(layoutHdr{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fl[3].Path != "In[0].X" || fl[3].Offset != 6 {
+		t.Errorf("NaturalAlign: In[0].X laid out as %+v", fl[3])
+	}
+
+	if _, err := Layout(reflect.TypeOf(layoutVar{})); err == nil {
+		t.Error("Layout of a type of variable size succeeded")
+	}
+}
+
+func TestDump(t *testing.T) {
+	v := layoutHdr{A: 5, B: true, Seq: [4]byte{1, 2, 3, 4}, S: "ab", W: "xy", Mac: [6]byte{0xa, 0xb, 0xc, 0xd, 0xe, 0xf}}
+	var b bytes.Buffer
+	if err := Dump(&b, &v); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSuffix(b.String(), "\n"), "\n")
+	if len(lines) != 8 {
+		t.Fatalf("Dump wrote %d lines, want 8:\n%s", len(lines), b.String())
+	}
+	for _, want := range []string{
+		"00000000 " + strings.Repeat(" ", 48) + "  B = true (bits 5..5)",
+		"00000001  01 02 03 04" + strings.Repeat(" ", 36) + "  Seq = [4]uint8 of length 4",
+		"00000009  61 62 00 00" + strings.Repeat(" ", 36) + `  S = "ab"`,
+		"00000011  0a 0b 0c 0d 0e 0f" + strings.Repeat(" ", 30) + "  Mac = [6]uint8 of length 6",
+	} {
+		found := false
+		for _, l := range lines {
+			found = found || l == want
+		}
+		if !found {
+			t.Errorf("Dump has no line %q:\n%s", want, b.String())
+		}
+	}
+
+	b.Reset()
+	err := Codec{LenSize: 2}.Dump(&b, &layoutVar{N: 2, Data: []uint16{1, 2}, Name: "hello"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(b.String(), `Name = "hello"`) || !strings.Contains(b.String(), "Data = []uint16 of length 2") {
+		t.Errorf("Dump of a value of variable size:\n%s", b.String())
+	}
+}
@@ -0,0 +1,105 @@
+package bigend
+
+import (
+	"errors"
+	"reflect"
+	"strconv"
+)
+
+// Codec is a configurable encoder and decoder.
+// The zero value encodes and decodes like the package-level functions.
+//
+// Options affecting the encoded layout are part of the cached encoding
+// plans, so a Codec should be reused rather than rebuilt per call.
+type Codec struct {
+	// IntSize is the encoded size in bytes of int and uint values, 4 or 8.
+	// Other values leave int and uint unsupported, as in Read and Write.
+	IntSize int
+
+	// LenSize is the size in bytes of the length prefix written before
+	// slices, maps and strings nested in a value: 1, 2, 4 or 8. Other
+	// values leave them unsupported, as in Read and Write. The length of
+	// a top-level slice is never encoded. Map entries are encoded sorted
+	// by encoded key, so equal maps have the same encoding.
+	LenSize int
+
+	// NaturalAlign lays out structs as C compilers do on amd64 and arm64.
+	// Each field is preceded by zero padding up to a multiple of its size
+	// from the start of the struct, or of the alignment of its struct or
+	// array type, and each struct is padded to a multiple of its largest
+	// field alignment. Bit fields do not straddle units of their type.
+	// Otherwise structs are packed, except for fields tagged
+	// `binary:"align=N"`, which are aligned to N in both layouts.
+	NaturalAlign bool
+
+	EncodeOptions
+	DecodeOptions
+}
+
+// EncodeOptions configures encoding. The zero value encodes like Write.
+type EncodeOptions struct {
+	// NilAsZero encodes a nil pointer as the zero value it points to,
+	// which decodes to a pointer to that zero value. Otherwise encoding
+	// a nil pointer fails.
+	NilAsZero bool
+}
+
+// DecodeOptions configures decoding. The zero value decodes like Read.
+type DecodeOptions struct {
+	// Strict rejects bool bytes other than 0 and 1, non-zero bytes or
+	// bits in blank (_) fields and padding, and duplicate map keys, with
+	// a *StrictError.
+	Strict bool
+
+	// Limits protect against hostile input. Zero means no limit.
+	// Exceeding a limit returns a *LimitError before memory is allocated
+	// for the offending value.
+	MaxBytes int // input bytes consumed by a call
+	MaxLen   int // elements of a variable-length value
+	MaxDepth int // nesting depth of arrays, slices, maps and structs
+}
+
+// StrictError reports input rejected by strict decoding.
+type StrictError struct {
+	Offset int // offset of the offending byte from the start of the value
+	Msg    string
+}
+
+func (e *StrictError) Error() string {
+	return "binary: " + e.Msg + " at offset " + strconv.Itoa(e.Offset)
+}
+
+// nilPointer returns the error for a nil pointer of type t.
+func nilPointer(t reflect.Type) error {
+	return errors.New("binary: nil pointer " + t.String())
+}
+
+var errIntOverflow = errors.New("binary: int value overflows Codec.IntSize")
+
+// LimitError reports input rejected because of a DecodeOptions limit.
+type LimitError struct {
+	Limit  string // name of the exceeded limit, such as "MaxLen"
+	Offset int    // offset from the start of the value where it was exceeded
+}
+
+func (e *LimitError) Error() string {
+	return "binary: " + e.Limit + " exceeded at offset " + strconv.Itoa(e.Offset)
+}
+
+func invalidBool(offset int, x byte) error {
+	return &StrictError{Offset: offset, Msg: "invalid bool value " + strconv.Itoa(int(x))}
+}
+
+// fail records the first error encountered by d.
+func (d *decoder) fail(err error) {
+	if d.err == nil {
+		d.err = err
+	}
+}
+
+// fail records the first error encountered by e.
+func (e *encoder) fail(err error) {
+	if e.err == nil {
+		e.err = err
+	}
+}
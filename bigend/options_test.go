@@ -0,0 +1,73 @@
+package bigend
+
+import (
+	"bytes"
+	"io"
+	"testing"
+)
+
+type intRec struct {
+	A int
+	B uint
+	C [2]int
+	D int16
+}
+
+func TestCodecIntSize(t *testing.T) {
+	v := intRec{A: -2, B: 7, C: [2]int{1, -1}, D: 3}
+	if n := Size(v); n != -1 {
+		t.Errorf("Size without IntSize = %d, want -1", n)
+	}
+	if _, err := Append(nil, &v); err == nil {
+		t.Error("Append of an int without IntSize succeeded")
+	}
+
+	want := AppendUint32(nil, 0xfffffffe)
+	want = AppendUint32(want, 7)
+	want = AppendUint32(AppendUint32(want, 1), 0xffffffff)
+	want = AppendUint16(want, 3)
+	c := Codec{IntSize: 4}
+	if n := c.Size(v); n != len(want) {
+		t.Errorf("Size = %d, want %d", n, len(want))
+	}
+	b, err := c.Append([]byte{0xff}, &v)
+	if err != nil || !bytes.Equal(b, append([]byte{0xff}, want...)) {
+		t.Fatalf("Append = %x, %v, want ff%x", b, err, want)
+	}
+	var got intRec
+	if n, err := c.Decode(b[1:], &got); err != nil || n != len(want) || got != v {
+		t.Errorf("Decode = %d, %v, %+v", n, err, got)
+	}
+	if _, err := c.Decode(b[1:10], &got); err != io.ErrUnexpectedEOF {
+		t.Errorf("Decode of short input = %v", err)
+	}
+
+	v.A = 1 << 40
+	if _, err := c.Append(nil, v); err != errIntOverflow {
+		t.Errorf("Append of an int overflowing IntSize = %v", err)
+	}
+
+	c = Codec{IntSize: 8}
+	var buf bytes.Buffer
+	if err := c.Write(&buf, v); err != nil || buf.Len() != c.Size(v) || buf.Len() != 34 {
+		t.Fatalf("Write = %d bytes, %v", buf.Len(), err)
+	}
+	got = intRec{}
+	if err := c.Read(&buf, &got); err != nil || got != v {
+		t.Errorf("Read = %+v, %v", got, err)
+	}
+}
+
+func TestDecodeSlice(t *testing.T) {
+	b, err := Append(nil, []uint16{1, 2})
+	if err != nil || !bytes.Equal(b, AppendUint16(AppendUint16(nil, 1), 2)) {
+		t.Fatalf("Append = %x, %v", b, err)
+	}
+	var a [2]uint16
+	if n, err := Decode(b, a[:]); err != nil || n != 4 || a != [2]uint16{1, 2} {
+		t.Errorf("Decode = %d, %v, %v", n, err, a)
+	}
+	if _, err := Decode(b[:3], a[:]); err != io.ErrUnexpectedEOF {
+		t.Errorf("Decode of short input = %v", err)
+	}
+}
@@ -0,0 +1,208 @@
+package bigend
+
+import (
+	"io"
+	"reflect"
+	"strconv"
+	"sync"
+
+	"github.com/go-perf/encoding/internal/wire"
+)
+
+// chunkSize bounds the buffer used by Read and Write: larger values
+// are streamed through it rather than encoded or decoded at once.
+const chunkSize = 64 << 10
+
+// smallSize bounds the values Read and Write transfer through a local
+// array rather than a chunk buffer from chunkPool.
+const smallSize = 16
+
+var chunkPool = sync.Pool{
+	New: func() any {
+		b := make([]byte, chunkSize)
+		return &b
+	},
+}
+
+// PartialError is returned by Read and Write when reading or writing
+// a slice fails part way. The first N elements were fully transferred.
+type PartialError struct {
+	N   int
+	Err error
+}
+
+func (e *PartialError) Error() string {
+	return "binary: " + e.Err.Error() + " after " + strconv.Itoa(e.N) + " elements"
+}
+
+func (e *PartialError) Unwrap() error { return e.Err }
+
+// partial wraps err in a *PartialError if n > 0.
+func partial(err error, n int) error {
+	if err == nil || n == 0 {
+		return err
+	}
+	return &PartialError{N: n, Err: err}
+}
+
+// top decodes the top-level value v.
+// The length of a top-level slice is not encoded.
+func (d *decoder) top(v reflect.Value) error {
+	if v.Kind() != reflect.Slice {
+		d.value(v)
+		return d.err
+	}
+	for i, l := 0, v.Len(); i < l; i++ {
+		d.value(v.Index(i))
+		if d.err != nil {
+			if d.r == nil {
+				return d.err
+			}
+			return partial(d.err, i)
+		}
+	}
+	return nil
+}
+
+// pos returns the number of bytes consumed so far.
+func (d *decoder) pos() int { return d.base + d.offset }
+
+// pos returns the position of the next byte of output.
+func (e *encoder) pos() int { return e.base + len(e.buf) }
+
+// align skips the padding that aligns the input to a multiple of align
+// from start.
+func (d *decoder) align(start, align int) {
+	d.skip(wire.AlignUp(d.pos()-start, align) - (d.pos() - start))
+}
+
+// align zero-pads the output to a multiple of align from start.
+func (e *encoder) align(start, align int) {
+	e.skip(wire.AlignUp(e.pos()-start, align) - (e.pos() - start))
+}
+
+// next consumes the next n bytes of input.
+// After an error it returns zero bytes without consuming anything.
+func (d *decoder) next(n int) []byte {
+	if len(d.buf)-d.offset < n && !d.fill(n) {
+		return make([]byte, n)
+	}
+	b := d.buf[d.offset : d.offset+n]
+	d.offset += n
+	return b
+}
+
+// expect tells d that the next n bytes of input will be consumed,
+// so they may be read ahead.
+func (d *decoder) expect(n int) {
+	if more := n - (len(d.buf) - d.offset); more > d.ahead {
+		d.ahead = more
+	}
+}
+
+// fill reads from d.r until at least n bytes are buffered. It reads ahead
+// no more than d.ahead bytes, so nothing past the value is consumed.
+func (d *decoder) fill(n int) bool {
+	if d.err != nil {
+		return false
+	}
+	if max := d.c.MaxBytes; max > 0 && d.pos()+n > max {
+		d.fail(&LimitError{Limit: "MaxBytes", Offset: d.pos()})
+		return false
+	}
+	if d.r == nil {
+		d.fail(io.ErrUnexpectedEOF)
+		return false
+	}
+
+	avail := copy(d.buf, d.buf[d.offset:])
+	d.base += d.offset
+	d.offset = 0
+	if cap(d.buf) < n {
+		buf := make([]byte, avail, n)
+		copy(buf, d.buf)
+		d.buf = buf
+	}
+
+	want := n - avail
+	limit := want
+	if d.ahead > limit {
+		limit = d.ahead
+	}
+	if room := cap(d.buf) - avail; limit > room {
+		limit = room
+	}
+	if max := d.c.MaxBytes; max > 0 && d.base+avail+limit > max {
+		limit = max - d.base - avail
+	}
+	m, err := io.ReadAtLeast(d.r, d.buf[avail:avail+limit], want)
+	d.buf = d.buf[:avail+m]
+	if d.ahead -= m; d.ahead < 0 {
+		d.ahead = 0
+	}
+	if err != nil {
+		if err == io.EOF && d.base+avail > 0 {
+			err = io.ErrUnexpectedEOF
+		}
+		d.fail(err)
+		return false
+	}
+	return true
+}
+
+// top encodes the top-level value v and flushes the output.
+// The length of a top-level slice is not encoded.
+func (e *encoder) top(v reflect.Value) error {
+	if v.Kind() != reflect.Slice {
+		e.value(v)
+	} else {
+		for i, l := 0, v.Len(); i < l && e.err == nil; i++ {
+			e.value(v.Index(i))
+		}
+	}
+	if e.w == nil {
+		return e.err
+	}
+	e.flush()
+	if e.err != nil && v.Kind() == reflect.Slice {
+		if size := e.c.sizeof(v.Type().Elem()); size > 0 {
+			return partial(e.err, e.base/size)
+		}
+	}
+	return e.err
+}
+
+// next returns the next n bytes of output for the caller to fill.
+func (e *encoder) next(n int) []byte {
+	l := len(e.buf)
+	if cap(e.buf)-l < n {
+		e.reserve(n)
+		l = len(e.buf)
+	}
+	e.buf = e.buf[:l+n]
+	return e.buf[l:]
+}
+
+// reserve makes room for n more bytes of output, flushing it if possible.
+func (e *encoder) reserve(n int) {
+	if e.w != nil {
+		e.flush()
+	}
+	if cap(e.buf)-len(e.buf) < n {
+		e.buf, _ = grow(e.buf, n)
+		e.buf = e.buf[:len(e.buf)-n]
+	}
+}
+
+// flush writes the buffered output to e.w.
+// After an error the output is discarded.
+func (e *encoder) flush() {
+	if e.err == nil && len(e.buf) > 0 {
+		n, err := e.w.Write(e.buf)
+		e.base += n
+		if err != nil {
+			e.fail(err)
+		}
+	}
+	e.buf = e.buf[:0]
+}
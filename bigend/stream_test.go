@@ -0,0 +1,108 @@
+package bigend
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+)
+
+// shortWriter accepts n bytes, then fails.
+type shortWriter struct{ n int }
+
+func (w *shortWriter) Write(p []byte) (int, error) {
+	if len(p) > w.n {
+		n := w.n
+		w.n = 0
+		return n, io.ErrShortWrite
+	}
+	w.n -= len(p)
+	return len(p), nil
+}
+
+type streamRec struct {
+	A uint32
+	B [3]byte
+	C bool
+}
+
+func TestStreamSlices(t *testing.T) {
+	xs := make([]uint64, 40000)
+	var want []byte
+	for i := range xs {
+		xs[i] = uint64(i) << 20
+		want = AppendUint64(want, xs[i])
+	}
+	var buf bytes.Buffer
+	if err := Write(&buf, xs); err != nil || !bytes.Equal(buf.Bytes(), want) {
+		t.Fatalf("Write = %v", err)
+	}
+	ys := make([]uint64, len(xs))
+	if err := Read(bytes.NewReader(want), ys); err != nil {
+		t.Fatal(err)
+	}
+	for i := range ys {
+		if ys[i] != xs[i] {
+			t.Fatalf("Read: element %d = %x, want %x", i, ys[i], xs[i])
+		}
+	}
+
+	rs := make([]streamRec, 20000)
+	for i := range rs {
+		rs[i] = streamRec{uint32(i), [3]byte{1, 2, byte(i)}, i%2 == 0}
+	}
+	buf.Reset()
+	if err := Write(&buf, rs); err != nil || buf.Len() != 8*len(rs) {
+		t.Fatalf("Write = %v, %d bytes", err, buf.Len())
+	}
+	buf.WriteString("tail")
+	r := bytes.NewReader(buf.Bytes())
+	got := make([]streamRec, len(rs))
+	if err := Read(r, got); err != nil || r.Len() != 4 {
+		t.Fatalf("Read = %v, %d bytes left", err, r.Len())
+	}
+	for i := range got {
+		if got[i] != rs[i] {
+			t.Fatalf("Read: element %d = %v, want %v", i, got[i], rs[i])
+		}
+	}
+}
+
+func TestStreamPartial(t *testing.T) {
+	xs := make([]uint64, 40000)
+	for i := range xs {
+		xs[i] = uint64(i + 1)
+	}
+	b, _ := Append(nil, xs)
+	ys := make([]uint64, len(xs))
+	err := Read(bytes.NewReader(b[:8*9000+3]), ys)
+	var pe *PartialError
+	if !errors.As(err, &pe) || pe.N != 9000 || !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Fatalf("Read of a short input = %v", err)
+	}
+	for i := 0; i < pe.N; i++ {
+		if ys[i] != xs[i] {
+			t.Fatalf("Read: element %d = %d, want %d", i, ys[i], xs[i])
+		}
+	}
+
+	rs := make([]streamRec, 3000)
+	b, _ = Append(nil, rs)
+	err = Read(bytes.NewReader(b[:8*1000+3]), make([]streamRec, len(rs)))
+	if !errors.As(err, &pe) || pe.N != 1000 || !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("Read of a short input = %v", err)
+	}
+
+	err = Write(&shortWriter{n: 8*10000 + 5}, xs)
+	if !errors.As(err, &pe) || pe.N != 10000 || !errors.Is(err, io.ErrShortWrite) {
+		t.Errorf("Write to a short writer = %v", err)
+	}
+	err = Write(&shortWriter{n: 8*2000 + 5}, rs)
+	if !errors.As(err, &pe) || pe.N != 2000 {
+		t.Errorf("Write to a short writer = %v", err)
+	}
+
+	if err := Read(bytes.NewReader(nil), ys); err != io.EOF {
+		t.Errorf("Read of no input = %v, want EOF", err)
+	}
+}
@@ -0,0 +1,111 @@
+package bigend
+
+import (
+	"bytes"
+	"io"
+	"math"
+	"reflect"
+	"testing"
+)
+
+type swapInner struct {
+	A uint16
+	B [2]int32
+}
+
+type swapRec struct {
+	X  uint8
+	F  uint8  `binary:"bits=3"`
+	G  uint16 `binary:"bits=9"`
+	H  bool   `binary:"bits=1"`
+	_  uint8  `binary:"bits=3"`
+	Y  uint64
+	Z  float32
+	In [2]swapInner
+	P  *swapInner
+	N  int
+	S  string `binary:"fixed=4,utf16"`
+	T  string `binary:"fixed=3"`
+}
+
+func TestSwapStruct(t *testing.T) {
+	v := swapRec{X: 1, F: 5, G: 300, H: true, Y: 0x0102030405060708, Z: 1.5,
+		In: [2]swapInner{{1, [2]int32{-1, 2}}, {3, [2]int32{4, 5}}},
+		P:  &swapInner{6, [2]int32{7, 8}}, N: -7, S: "hé", T: "ab"}
+
+	// Build the encoding of v in both byte orders.
+	var le, be []byte
+	put := func(x uint64, n int) {
+		for i := 0; i < n; i++ {
+			le = append(le, byte(x>>(8*i)))
+			be = append(be, byte(x>>(8*(n-1-i))))
+		}
+	}
+	putInner := func(in swapInner) {
+		put(uint64(in.A), 2)
+		put(uint64(uint32(in.B[0])), 4)
+		put(uint64(uint32(in.B[1])), 4)
+	}
+	put(1, 1)
+	le = append(le, 0x65, 0x19) // F, G and H packed from the least significant bit
+	be = append(be, 0xb2, 0xc8)
+	put(v.Y, 8)
+	put(uint64(math.Float32bits(v.Z)), 4)
+	putInner(v.In[0])
+	putInner(v.In[1])
+	putInner(*v.P)
+	put(uint64(uint32(v.N)), 4)
+	put('h', 2)
+	put(0xe9, 2)
+	le = append(le, 'a', 'b', 0)
+	be = append(be, 'a', 'b', 0)
+	native, other := le, be
+	if bigEndian {
+		native, other = be, le
+	}
+
+	c := Codec{IntSize: 4}
+	if b, err := c.Append(nil, v); err != nil || !bytes.Equal(b, native) {
+		t.Fatalf("Append = %x, %v, want %x", b, err, native)
+	}
+	b := append([]byte(nil), other...)
+	if err := c.SwapStruct(reflect.TypeOf(v), b); err != nil || !bytes.Equal(b, native) {
+		t.Errorf("SwapStruct = %x, %v, want %x", b, err, native)
+	}
+	if err := c.SwapStruct(reflect.TypeOf(v), b[:10]); err != io.ErrUnexpectedEOF {
+		t.Errorf("SwapStruct of a short buffer = %v", err)
+	}
+	if err := SwapStruct(reflect.TypeOf(v), b); err == nil {
+		t.Error("SwapStruct of an int without IntSize succeeded")
+	}
+}
+
+func TestSwapUnits(t *testing.T) {
+	for n := 0; n < 40; n++ {
+		x := make([]byte, n)
+		for i := range x {
+			x[i] = byte(i)
+		}
+		for _, tt := range []struct {
+			unit int
+			swap func([]byte)
+		}{
+			{2, Swap16s},
+			{4, Swap32s},
+			{8, Swap64s},
+		} {
+			y := append([]byte(nil), x...)
+			tt.swap(y)
+			for i := range y {
+				want := x[i]
+				if u := i / tt.unit * tt.unit; u+tt.unit <= n {
+					want = x[u+tt.unit-1-(i-u)]
+				}
+				if y[i] != want {
+					t.Errorf("Swap%ds(%x) = %x", 8*tt.unit, x, y)
+					break
+				}
+			}
+		}
+	}
+}
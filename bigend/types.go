@@ -0,0 +1,30 @@
+package bigend
+
+// U16 is a big-endian uint16 kept in its encoded form.
+// Its in-memory layout is the wire layout, so structs made of these types
+// can be used on raw buffers without a decode step.
+type U16 [2]byte
+
+// Get returns the value of u.
+func (u U16) Get() uint16 { return Uint16(u[:]) }
+
+// Set sets the value of u to v.
+func (u *U16) Set(v uint16) { PutUint16(u[:], v) }
+
+// U32 is a big-endian uint32 kept in its encoded form.
+type U32 [4]byte
+
+// Get returns the value of u.
+func (u U32) Get() uint32 { return Uint32(u[:]) }
+
+// Set sets the value of u to v.
+func (u *U32) Set(v uint32) { PutUint32(u[:], v) }
+
+// U64 is a big-endian uint64 kept in its encoded form.
+type U64 [8]byte
+
+// Get returns the value of u.
+func (u U64) Get() uint64 { return Uint64(u[:]) }
+
+// Set sets the value of u to v.
+func (u *U64) Set(v uint64) { PutUint64(u[:], v) }
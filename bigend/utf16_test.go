@@ -0,0 +1,76 @@
+package bigend
+
+import (
+	"bytes"
+	"testing"
+)
+
+type utf16Hdr struct {
+	NLen  uint16
+	BSize uint8
+	Name  string `binary:"utf16,len=NLen"`
+	Blob  string `binary:"size=BSize,utf16"`
+	Fixed string `binary:"fixed=8,utf16,truncate"`
+	C     string `binary:"cstring,utf16"`
+	P     string `binary:"utf16"`
+	U     string `binary:"ucs2"`
+}
+
+func appendUnits(b []byte, units ...uint16) []byte {
+	for _, u := range units {
+		b = AppendUint16(b, u)
+	}
+	return b
+}
+
+func TestUTF16(t *testing.T) {
+	const s = "a😀é"
+	want := appendUnits(nil, 'a', 0xd83d, 0xde00, 0xe9)
+	b := AppendUTF16(nil, s)
+	if !bytes.Equal(b, want) {
+		t.Fatalf("AppendUTF16 = %x, want %x", b, want)
+	}
+	for _, tt := range []struct {
+		in   []byte
+		want string
+	}{
+		{b, s},
+		{b[:len(b)-1], "a😀�"},
+		{appendUnits(nil, 0xd83d, 'A'), "�A"},
+	} {
+		if got := UTF16String(tt.in); got != tt.want {
+			t.Errorf("UTF16String(%x) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+	// The byte order mark overrides the byte order of the package.
+	be := []byte{0xfe, 0xff, 0, 'a', 0xd8, 0x3d, 0xde, 0x00, 0, 0xe9}
+	le := []byte{0xff, 0xfe, 'a', 0, 0x3d, 0xd8, 0x00, 0xde, 0xe9, 0}
+	for _, in := range [][]byte{be, le, want} {
+		if got := UTF16StringBOM(in); got != s {
+			t.Errorf("UTF16StringBOM(%x) = %q, want %q", in, got, s)
+		}
+	}
+
+	c := Codec{LenSize: 1}
+	h := utf16Hdr{Name: "n😀", Blob: "xy", Fixed: "abc😀", C: "zz", P: "p", U: "é"}
+	want = append(AppendUint16(nil, 3), 4)
+	want = appendUnits(want, 'n', 0xd83d, 0xde00, 'x', 'y')
+	want = appendUnits(want, 'a', 'b', 'c', 0) // the pair does not fit
+	want = appendUnits(want, 'z', 'z', 0)
+	want = appendUnits(append(want, 1), 'p')
+	want = appendUnits(append(want, 1), 0xe9)
+	b, err := c.Append(nil, h)
+	if err != nil || !bytes.Equal(b, want) || c.Size(h) != len(want) {
+		t.Fatalf("Append = %x, %v, want %x", b, err, want)
+	}
+	var got utf16Hdr
+	dec := h
+	dec.NLen, dec.BSize, dec.Fixed = 3, 4, "abc"
+	if n, err := c.Decode(b, &got); err != nil || n != len(b) || got != dec {
+		t.Errorf("Decode = %d, %+v, %v", n, got, err)
+	}
+	h.U = "😀"
+	if _, err := c.Append(nil, h); err == nil {
+		t.Error("Append of a rune outside UCS-2 succeeded")
+	}
+}
@@ -0,0 +1,123 @@
+package bigend
+
+import (
+	"errors"
+	"reflect"
+	"strconv"
+	"sync"
+)
+
+// variants holds the types registered for an interface type.
+type variants struct {
+	types map[uint64]reflect.Type
+	tags  map[reflect.Type]uint64
+}
+
+var (
+	variantsMu sync.RWMutex
+	variantsOf = map[reflect.Type]*variants{} // by interface type
+)
+
+// RegisterVariant registers T as the variant with the given tag of the
+// interface type I, for struct fields of type I tagged `binary:"union=Kind"`.
+// Such a field holds a T, or a *T if T is registered as a pointer type.
+// It is encoded as the T alone, and Kind, an earlier integer field of the
+// struct, holds the tag: Write sets it from the type of the variant and
+// Read picks the type of the variant from it.
+//
+// RegisterVariant panics if T does not implement I or if the tag or T is
+// already registered for I. It is meant to be called from init functions.
+func RegisterVariant[I, T any](tag uint64) {
+	it, t := reflect.TypeOf((*I)(nil)).Elem(), reflect.TypeOf((*T)(nil)).Elem()
+	if it.Kind() != reflect.Interface || !t.Implements(it) {
+		panic("binary: RegisterVariant: " + t.String() + " does not implement " + it.String())
+	}
+
+	variantsMu.Lock()
+	defer variantsMu.Unlock()
+	vs := variantsOf[it]
+	if vs == nil {
+		vs = &variants{types: map[uint64]reflect.Type{}, tags: map[reflect.Type]uint64{}}
+		variantsOf[it] = vs
+	}
+	if _, ok := vs.types[tag]; ok {
+		panic("binary: RegisterVariant: duplicate tag " + strconv.FormatUint(tag, 10) + " for " + it.String())
+	}
+	if _, ok := vs.tags[t]; ok {
+		panic("binary: RegisterVariant: duplicate variant " + t.String() + " for " + it.String())
+	}
+	vs.types[tag] = t
+	vs.tags[t] = tag
+}
+
+// VariantType returns the type registered with RegisterVariant as the
+// variant with the given tag of the interface type it.
+func VariantType(it reflect.Type, tag uint64) (reflect.Type, bool) {
+	variantsMu.RLock()
+	defer variantsMu.RUnlock()
+	t, ok := variantsOf[it].lookupType(tag)
+	return t, ok
+}
+
+// variantTag returns the tag of the variant held by the interface value v.
+func variantTag(v reflect.Value) (uint64, error) {
+	if v.IsNil() {
+		return 0, errors.New("binary: nil variant " + v.Type().String())
+	}
+	variantsMu.RLock()
+	defer variantsMu.RUnlock()
+	t := v.Elem().Type()
+	tag, ok := variantsOf[v.Type()].lookupTag(t)
+	if !ok {
+		return 0, errors.New("binary: unregistered variant " + t.String() + " for " + v.Type().String())
+	}
+	return tag, nil
+}
+
+func (vs *variants) lookupType(tag uint64) (reflect.Type, bool) {
+	if vs == nil {
+		return nil, false
+	}
+	t, ok := vs.types[tag]
+	return t, ok
+}
+
+func (vs *variants) lookupTag(t reflect.Type) (uint64, bool) {
+	if vs == nil {
+		return 0, false
+	}
+	tag, ok := vs.tags[t]
+	return tag, ok
+}
+
+// variant decodes into the union field v the variant selected by the
+// tag already decoded into the field kind.
+func (d *decoder) variant(v, kind reflect.Value) {
+	tag := fieldUint(kind)
+	t, ok := VariantType(v.Type(), tag)
+	if !ok {
+		d.fail(errors.New("binary: unknown variant tag " + strconv.FormatUint(tag, 10) + " for " + v.Type().String()))
+		return
+	}
+	if d.c.sizeof(t) == -1 {
+		d.fail(errors.New("binary: invalid variant type " + t.String()))
+		return
+	}
+	x := reflect.New(t).Elem()
+	d.value(x)
+	v.Set(x)
+}
+
+// variant encodes the variant held by the union field v.
+func (e *encoder) variant(v reflect.Value) {
+	if v.IsNil() {
+		// The error was reported when encoding the tag.
+		return
+	}
+	x := v.Elem()
+	if e.c.sizeof(x.Type()) == -1 {
+		e.fail(errors.New("binary: invalid variant type " + x.Type().String()))
+		return
+	}
+	e.value(x)
+}
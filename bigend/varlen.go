@@ -0,0 +1,364 @@
+package bigend
+
+import (
+	"errors"
+	"io"
+	"math"
+	"reflect"
+	"strings"
+
+	"github.com/go-perf/encoding/internal/wire"
+)
+
+// variable is the size of types whose encoded size depends on the value,
+// such as slices, maps and strings nested in a struct.
+const variable = -2
+
+var (
+	errLenOverflow    = errors.New("binary: length overflows Codec.LenSize")
+	errLenOverflowInt = errors.New("binary: length prefix overflows int")
+)
+
+// hasLen reports whether c encodes length-prefixed slices and strings.
+func (c Codec) hasLen() bool {
+	return sizeIndex(c.LenSize) != 0
+}
+
+// valueSize returns the encoded size of v, or -1 if v cannot be encoded.
+func (c Codec) valueSize(v reflect.Value) int {
+	s := c.sizeof(v.Type())
+	if s != variable {
+		return s
+	}
+	switch v.Kind() {
+	case reflect.Struct:
+		si := c.cachedStruct(v.Type())
+		size := 0
+		for _, f := range si.fields {
+			if f.cond != nil && !f.cond.present(v) {
+				continue
+			}
+			size = wire.AlignUp(size, f.align)
+			if f.size != variable {
+				size += f.size
+				continue
+			}
+			s := c.fieldSize(v, &f)
+			if s == -1 {
+				return -1
+			}
+			size += s
+		}
+		return wire.AlignUp(size, si.align)
+	case reflect.Array:
+		return c.elemsSize(v)
+	case reflect.Pointer:
+		if v.IsNil() {
+			if !c.NilAsZero {
+				return -1
+			}
+			return c.valueSize(reflect.Zero(v.Type().Elem()))
+		}
+		return c.valueSize(v.Elem())
+	case reflect.Slice:
+		if s := c.elemsSize(v); s != -1 {
+			return c.LenSize + s
+		}
+	case reflect.Map:
+		size := c.LenSize
+		for it := v.MapRange(); it.Next(); {
+			k, e := c.valueSize(it.Key()), c.valueSize(it.Value())
+			if k == -1 || e == -1 {
+				return -1
+			}
+			size += k + e
+		}
+		return size
+	case reflect.String:
+		return c.LenSize + v.Len()
+	}
+	return -1
+}
+
+// fieldSize returns the encoded size of the variable-size field f of the
+// struct v, or -1 if it cannot be encoded.
+func (c Codec) fieldSize(v reflect.Value, f *field) int {
+	fv := v.Field(f.index)
+	if f.str != nil {
+		size := f.str.encodedLen(fv.String())
+		if f.str.CString {
+			size += f.str.Unit()
+		} else if f.ref == wire.RefNone {
+			size += c.LenSize
+		}
+		return size
+	}
+	switch f.ref {
+	case wire.RefNone:
+		return c.valueSize(fv)
+	case wire.RefTag:
+		if fv.IsNil() {
+			return -1
+		}
+		return c.valueSize(fv.Elem())
+	}
+	return c.countedSize(fv)
+}
+
+// elemsSize returns the encoded size of the elements of the array or slice v,
+// or -1 if they cannot be encoded.
+func (c Codec) elemsSize(v reflect.Value) int {
+	s := c.sizeof(v.Type().Elem())
+	if s >= 0 {
+		return s * v.Len()
+	}
+	if s == -1 {
+		return -1
+	}
+	size := 0
+	for i, l := 0, v.Len(); i < l; i++ {
+		s := c.valueSize(v.Index(i))
+		if s == -1 {
+			return -1
+		}
+		size += s
+	}
+	return size
+}
+
+// minSize returns the smallest encoded size of values of type t.
+func (c Codec) minSize(t reflect.Type) int {
+	p := planner{c: c}
+	return p.minSize(t)
+}
+
+func (p *planner) minSize(t reflect.Type) int {
+	if s := p.sizeof(t); s != variable {
+		return s
+	}
+	switch t.Kind() {
+	case reflect.Struct:
+		return p.structInfo(t).min
+	case reflect.Array:
+		return t.Len() * p.minSize(t.Elem())
+	case reflect.Pointer:
+		return p.minSize(t.Elem())
+	}
+	return p.c.LenSize
+}
+
+// length decodes a length prefix.
+func (d *decoder) length() int {
+	var n uint64
+	switch d.c.LenSize {
+	case 1:
+		n = uint64(d.uint8())
+	case 2:
+		n = uint64(d.uint16())
+	case 4:
+		n = uint64(d.uint32())
+	default:
+		n = d.uint64()
+	}
+	if n > math.MaxInt {
+		d.fail(errLenOverflowInt)
+		return 0
+	}
+	return int(n)
+}
+
+// length encodes a length prefix.
+func (e *encoder) length(n int) {
+	switch e.c.LenSize {
+	case 1:
+		if n > math.MaxUint8 {
+			e.fail(errLenOverflow)
+		}
+		e.uint8(uint8(n))
+	case 2:
+		if n > math.MaxUint16 {
+			e.fail(errLenOverflow)
+		}
+		e.uint16(uint16(n))
+	case 4:
+		if uint64(n) > math.MaxUint32 {
+			e.fail(errLenOverflow)
+		}
+		e.uint32(uint32(n))
+	default:
+		e.uint64(uint64(n))
+	}
+}
+
+// checkLen checks the length n of a value made of elements of at least
+// size bytes against the limits, before anything is allocated for it.
+// Elements of no size are charged a byte each against MaxBytes, so that
+// it bounds their number too.
+func (d *decoder) checkLen(n, size int) bool {
+	if max := d.c.MaxLen; max > 0 && n > max {
+		d.fail(&LimitError{Limit: "MaxLen", Offset: d.pos()})
+		return false
+	}
+	charge := size
+	if charge == 0 {
+		charge = 1
+	}
+	if max := d.c.MaxBytes; max > 0 && n > (max-d.pos())/charge {
+		d.fail(&LimitError{Limit: "MaxBytes", Offset: d.pos()})
+		return false
+	}
+	if size == 0 {
+		return true
+	}
+	if d.r == nil && n > (len(d.buf)-d.offset)/size {
+		d.fail(io.ErrUnexpectedEOF)
+		return false
+	}
+	return true
+}
+
+// enter descends into a nested value. It reports false if that exceeds MaxDepth.
+func (d *decoder) enter() bool {
+	if d.depth >= d.c.MaxDepth {
+		d.fail(&LimitError{Limit: "MaxDepth", Offset: d.pos()})
+		return false
+	}
+	d.depth++
+	return true
+}
+
+func (d *decoder) leave() { d.depth-- }
+
+func (d *decoder) slice(v reflect.Value) {
+	if n := d.length(); d.err == nil {
+		d.sliceLen(v, n)
+	}
+}
+
+// sliceLen decodes n elements into the slice v.
+func (d *decoder) sliceLen(v reflect.Value, n int) {
+	elem := v.Type().Elem()
+	if !d.checkLen(n, d.c.minSize(elem)) {
+		return
+	}
+	s := d.c.sizeof(elem)
+	if s == 0 && elem.Size() == 0 {
+		// Nothing is decoded for elements of no size, however many
+		// there are, and they take no memory.
+		if v.Cap() >= n {
+			v.SetLen(n)
+		} else {
+			v.Set(reflect.MakeSlice(v.Type(), n, n))
+		}
+		return
+	}
+	if s > 0 {
+		d.expect(n * s)
+	}
+	if v.Cap() >= n {
+		v.SetLen(n)
+		d.elems(v, 0, n)
+		return
+	}
+	step := n
+	if size := int(elem.Size()); d.r != nil && size > 0 && n > chunkSize/size {
+		// A stream may end long before a hostile length is reached, so
+		// the slice grows as its elements arrive rather than up front.
+		step = chunkSize / size
+	}
+	v.Set(reflect.MakeSlice(v.Type(), step, step))
+	for i := 0; i < n && d.err == nil; {
+		j := i + step
+		if j > n {
+			j = n
+		}
+		if j > v.Cap() {
+			c := 2 * v.Cap()
+			if c > n {
+				c = n
+			}
+			nv := reflect.MakeSlice(v.Type(), j, c)
+			reflect.Copy(nv, v)
+			v.Set(nv)
+		} else {
+			v.SetLen(j)
+		}
+		d.elems(v, i, j)
+		i = j
+	}
+}
+
+// elems decodes the elements i to j of the slice v.
+func (d *decoder) elems(v reflect.Value, i, j int) {
+	if v.Type().Elem() == byteType {
+		for b := v.Bytes()[i:j]; len(b) > 0 && d.err == nil; {
+			k := copy(b, d.next(chunkLen(len(b))))
+			b = b[k:]
+		}
+		return
+	}
+	for ; i < j && d.err == nil; i++ {
+		d.value(v.Index(i))
+	}
+}
+
+func (e *encoder) slice(v reflect.Value) {
+	e.length(v.Len())
+	e.sliceElems(v)
+}
+
+// sliceElems encodes the elements of the slice v.
+func (e *encoder) sliceElems(v reflect.Value) {
+	l := v.Len()
+	if v.Type().Elem() == byteType {
+		for b := v.Bytes(); len(b) > 0 && e.err == nil; {
+			k := copy(e.next(chunkLen(len(b))), b)
+			b = b[k:]
+		}
+		return
+	}
+	for i := 0; i < l && e.err == nil; i++ {
+		e.value(v.Index(i))
+	}
+}
+
+func (d *decoder) string(v reflect.Value) {
+	if n := d.length(); d.err == nil {
+		d.stringLen(v, n)
+	}
+}
+
+// stringLen decodes a string of n bytes into v.
+func (d *decoder) stringLen(v reflect.Value, n int) {
+	if !d.checkLen(n, 1) {
+		return
+	}
+	d.expect(n)
+	var sb strings.Builder
+	if d.r == nil || n <= chunkSize {
+		sb.Grow(n)
+	} else {
+		// The builder grows as the bytes of the stream arrive.
+		sb.Grow(chunkSize)
+	}
+	for n > 0 && d.err == nil {
+		k := chunkLen(n)
+		sb.Write(d.next(k))
+		n -= k
+	}
+	v.SetString(sb.String())
+}
+
+func (e *encoder) string(v reflect.Value) {
+	s := v.String()
+	e.length(len(s))
+	e.stringBytes(s)
+}
+
+// stringBytes encodes the bytes of s.
+func (e *encoder) stringBytes(s string) {
+	for len(s) > 0 && e.err == nil {
+		k := copy(e.next(chunkLen(len(s))), s)
+		s = s[k:]
+	}
+}
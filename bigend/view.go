@@ -0,0 +1,67 @@
+package bigend
+
+import (
+	"errors"
+	"io"
+	"reflect"
+	"sync"
+	"unsafe"
+)
+
+// View returns a pointer to a T overlaid on the first Size(T) bytes of b.
+// The result aliases b: changes to one are visible through the other.
+//
+// T must be a struct whose memory layout is its wire layout, that is
+// a struct built only from byte arrays, U16, U32, U64 and nested structs
+// and arrays of those, without binary tags.
+func View[T any](b []byte) (*T, error) {
+	t := reflect.TypeOf((*T)(nil)).Elem()
+	size := cachedViewSize(t)
+	if size < 0 {
+		return nil, errors.New("binary.View: invalid type " + t.String())
+	}
+	if len(b) < size {
+		return nil, io.ErrUnexpectedEOF
+	}
+	if size == 0 {
+		return new(T), nil
+	}
+	return (*T)(unsafe.Pointer(&b[0])), nil
+}
+
+var viewSizes sync.Map // map[reflect.Type]int
+
+func cachedViewSize(t reflect.Type) int {
+	if size, ok := viewSizes.Load(t); ok {
+		return size.(int)
+	}
+	size := -1
+	if t.Kind() == reflect.Struct && isOverlay(t) {
+		size = Codec{}.sizeof(t)
+	}
+	viewSizes.Store(t, size)
+	return size
+}
+
+// isOverlay reports whether values of type t have alignment 1 and
+// no padding, so their memory layout matches the encoded layout.
+func isOverlay(t reflect.Type) bool {
+	if t.Align() != 1 {
+		return false
+	}
+	switch t.Kind() {
+	case reflect.Uint8, reflect.Int8:
+		return true
+	case reflect.Array:
+		return isOverlay(t.Elem())
+	case reflect.Struct:
+		for i, n := 0, t.NumField(); i < n; i++ {
+			f := t.Field(i)
+			if f.Tag.Get("binary") != "" || !isOverlay(f.Type) {
+				return false
+			}
+		}
+		return uintptr(Codec{}.sizeof(t)) == t.Size()
+	}
+	return false
+}
@@ -0,0 +1,266 @@
+// Package bincodec implements the bincodec command, which decodes,
+// encodes and annotates binary data, for commands that register the Go
+// types of their data:
+//
+//	func main() {
+//		bincodec.Register("pkt.Header", reflect.TypeOf(pkt.Header{}))
+//		bincodec.Main()
+//	}
+//
+// Usage:
+//
+//	bincodec -schema=file.json|-type=name [flags] dump|decode|encode [file]
+//
+// The format of the data is described by the JSON schema in file.json, as
+// parsed by schema.Parse, or is the encoding of a Go type registered with
+// Register by the litend or bigend Codec. The -order, -intsize, -lensize
+// and -natural flags set the options of that Codec; a schema sets its own.
+// A Go type is decoded and encoded by the Codec itself, so bincodec fails
+// where Codec.Read fails, and dumped by Codec.Dump. Its union fields take
+// the variants registered with the RegisterVariant of the Codec's package.
+//
+// The commands read the file, or standard input, and write to the file
+// named by -o, or standard output:
+//
+//	dump    writes a hex dump of binary data, with the offset, path and
+//	        value of each field, and its length prefixes and padding
+//	decode  converts binary data to JSON
+//	encode  converts JSON to binary data
+//
+// Decoded values are written as JSON as described in package schema:
+// structs are objects, maps are lists of [key, value] pairs, complex
+// numbers are [re, im] lists and NaN and infinities are strings.
+package bincodec
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/go-perf/encoding/bigend"
+	"github.com/go-perf/encoding/litend"
+	"github.com/go-perf/encoding/schema"
+)
+
+var (
+	mu      sync.Mutex
+	goTypes = make(map[string]reflect.Type) // the Go types -type can name
+)
+
+// Register makes the Go type t the type of the data named name by the
+// -type flag. It panics if name is already registered.
+func Register(name string, t reflect.Type) {
+	mu.Lock()
+	defer mu.Unlock()
+	if _, dup := goTypes[name]; dup {
+		panic("bincodec: Register called twice for type " + name)
+	}
+	goTypes[name] = t
+}
+
+// flags are the command-line flags of Main.
+type flags struct {
+	schemaFile string
+	typeName   string
+	output     string
+	order      string
+	intSize    int
+	lenSize    int
+	natural    bool
+}
+
+// Main runs the bincodec command with the command-line arguments in
+// os.Args. If the command fails, it exits the program with status 1,
+// or 2 for a usage error.
+func Main() {
+	var fl flags
+	fs := flag.NewFlagSet(os.Args[0], flag.ExitOnError)
+	fs.StringVar(&fl.schemaFile, "schema", "", "JSON schema `file` of the data")
+	fs.StringVar(&fl.typeName, "type", "", "registered Go type of the data")
+	fs.StringVar(&fl.output, "o", "", "output file; default standard output")
+	fs.StringVar(&fl.order, "order", "little", "byte order of -type: little or big")
+	fs.IntVar(&fl.intSize, "intsize", 0, "encoded size of int and uint fields of -type, as Codec.IntSize")
+	fs.IntVar(&fl.lenSize, "lensize", 0, "encoded size of length prefixes of -type, as Codec.LenSize")
+	fs.BoolVar(&fl.natural, "natural", false, "lay out -type as Codec.NaturalAlign does")
+	usage := func() {
+		fmt.Fprintf(os.Stderr, "usage: %s -schema=file.json|-type=name [flags] dump|decode|encode [file]\n", fs.Name())
+		fs.PrintDefaults()
+		os.Exit(2)
+	}
+	fs.Usage = usage
+	fs.Parse(os.Args[1:])
+	if fs.NArg() < 1 || fs.NArg() > 2 || (fl.schemaFile == "") == (fl.typeName == "") ||
+		fl.order != "little" && fl.order != "big" {
+		usage()
+	}
+	if fl.schemaFile != "" {
+		fs.Visit(func(f *flag.Flag) {
+			switch f.Name {
+			case "order", "intsize", "lensize", "natural":
+				usage()
+			}
+		})
+	}
+
+	var run func(f *format, w io.Writer, in []byte) error
+	switch fs.Arg(0) {
+	case "dump":
+		run = (*format).dump
+	case "decode":
+		run = (*format).decodeJSON
+	case "encode":
+		run = (*format).encodeJSON
+	default:
+		usage()
+	}
+
+	f, err := fl.loadFormat()
+	var in []byte
+	if err == nil {
+		if fs.NArg() == 2 {
+			in, err = os.ReadFile(fs.Arg(1))
+		} else {
+			in, err = io.ReadAll(os.Stdin)
+		}
+	}
+	if err == nil {
+		w := os.Stdout
+		if fl.output != "" {
+			w, err = os.Create(fl.output)
+		}
+		if err == nil {
+			// A dump is written up to the error, so run writes
+			// its output before returning one.
+			err = run(f, w, in)
+			if cerr := w.Close(); err == nil {
+				err = cerr
+			}
+		}
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "bincodec:", err)
+		os.Exit(1)
+	}
+}
+
+// codec is implemented by litend.Codec and bigend.Codec.
+type codec interface {
+	Decode(b []byte, data any) (int, error)
+	Append(b []byte, data any) ([]byte, error)
+	Dump(w io.Writer, data any) error
+}
+
+// format is the format of the data.
+type format struct {
+	s *schema.Schema
+
+	// For a registered Go type, typ is the type, codec its Codec and
+	// variant the VariantType function of the Codec's package.
+	typ     reflect.Type
+	codec   codec
+	variant func(it reflect.Type, tag uint64) (reflect.Type, bool)
+}
+
+// loadFormat returns the format set by the flags.
+func (fl *flags) loadFormat() (*format, error) {
+	if fl.schemaFile != "" {
+		data, err := os.ReadFile(fl.schemaFile)
+		if err != nil {
+			return nil, err
+		}
+		s, err := schema.Parse(data)
+		if err != nil {
+			return nil, err
+		}
+		return &format{s: s}, nil
+	}
+
+	mu.Lock()
+	t, ok := goTypes[fl.typeName]
+	var names []string
+	for name := range goTypes {
+		names = append(names, name)
+	}
+	mu.Unlock()
+	if !ok {
+		if len(names) == 0 {
+			return nil, errors.New("unknown type " + fl.typeName + "; no types are registered")
+		}
+		sort.Strings(names)
+		return nil, errors.New("unknown type " + fl.typeName + "; registered types are " + strings.Join(names, ", "))
+	}
+	return typeFormat(t, fl.order, fl.intSize, fl.lenSize, fl.natural), nil
+}
+
+// typeFormat returns the format of the Go type t with the given Codec options.
+func typeFormat(t reflect.Type, order string, intSize, lenSize int, natural bool) *format {
+	f := &format{typ: t}
+	if order == "big" {
+		f.codec, f.variant = bigend.Codec{IntSize: intSize, LenSize: lenSize, NaturalAlign: natural}, bigend.VariantType
+	} else {
+		f.codec, f.variant = litend.Codec{IntSize: intSize, LenSize: lenSize, NaturalAlign: natural}, litend.VariantType
+	}
+	return f
+}
+
+// decode decodes the value encoded in b, calling fn, if not nil, with
+// the spans of b when the format is a schema. The whole of b must hold
+// the value.
+func (f *format) decode(b []byte, fn func(schema.Span)) (any, error) {
+	var v any
+	var n int
+	var err error
+	if f.typ != nil {
+		var p reflect.Value
+		if p, n, err = f.decodeType(b); err == nil {
+			v = treeValue(f.codec, p.Elem())
+		}
+	} else {
+		v, n, err = f.s.DecodeSpans(b, fn)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if n < len(b) {
+		return nil, trailing(b, n)
+	}
+	return v, nil
+}
+
+// decodeType decodes the value of the Go type from the start of b with
+// the Codec. It returns a pointer to the value and its size.
+func (f *format) decodeType(b []byte) (reflect.Value, int, error) {
+	p := reflect.New(f.typ)
+	n, err := f.codec.Decode(b, p.Interface())
+	if err != nil {
+		return p, 0, fmt.Errorf("%s: %v", f.typ, err)
+	}
+	return p, n, nil
+}
+
+// trailing returns the error for the bytes of b after a value of n bytes.
+func trailing(b []byte, n int) error {
+	return fmt.Errorf("%d bytes after the value at offset %d", len(b)-n, n)
+}
+
+// encode returns the encoding of the value v.
+func (f *format) encode(v any) ([]byte, error) {
+	if f.typ == nil {
+		return f.s.Encode(v)
+	}
+	p := reflect.New(f.typ)
+	if err := setTree(p.Elem(), v, f.variant); err != nil {
+		return nil, fmt.Errorf("%s: %v", f.typ, err)
+	}
+	b, err := f.codec.Append(nil, p.Interface())
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", f.typ, err)
+	}
+	return b, nil
+}
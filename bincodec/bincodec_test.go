@@ -0,0 +1,223 @@
+package bincodec
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/go-perf/encoding/bigend"
+	"github.com/go-perf/encoding/litend"
+	"github.com/go-perf/encoding/schema"
+)
+
+const testSchema = `{"lenSize": 1, "naturalAlign": true, "root": {"fields": [
+	{"name": "A", "type": "uint8", "binary": "bits=3"},
+	{"name": "_", "type": "uint8", "binary": "bits=5"},
+	{"name": "B", "type": "uint16"},
+	{"name": "S", "type": "string"},
+	{"name": "L", "type": {"slice": "float32"}}
+]}}`
+
+var testData = []byte{0x02, 0, 1, 2, 5, 'h', 'e', 'l', 'l', 'o', 2, 0, 0, 0xc0, 0x7f, 0, 0, 0x80, 0x3f, 0}
+
+const testDump = `00000000  02                                               A = 2 (bits 0..2)
+00000000                                                   _: padding (bits 3..7)
+00000001  00                                               padding
+00000002  01 02                                            B = 513
+00000004  05                                               S: length 5
+00000005  68 65 6c 6c 6f                                   S = "hello"
+0000000a  02                                               L: length 2
+0000000b  00 00 c0 7f                                      L[0] = "NaN"
+0000000f  00 00 80 3f                                      L[1] = 1
+00000013  00                                               padding
+`
+
+const testJSON = `{
+	"A": 2,
+	"B": 513,
+	"L": [
+		"NaN",
+		1
+	],
+	"S": "hello"
+}
+`
+
+func TestSchema(t *testing.T) {
+	s, err := schema.Parse([]byte(testSchema))
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := &format{s: s}
+
+	var b bytes.Buffer
+	if err := f.dump(&b, testData); err != nil || b.String() != testDump {
+		t.Errorf("dump = %v\n%s\nwant\n%s", err, b.String(), testDump)
+	}
+
+	b.Reset()
+	if err := f.decodeJSON(&b, testData); err != nil || b.String() != testJSON {
+		t.Errorf("decode = %v\n%s\nwant\n%s", err, b.String(), testJSON)
+	}
+
+	b.Reset()
+	if err := f.encodeJSON(&b, []byte(testJSON)); err != nil || !bytes.Equal(b.Bytes(), testData) {
+		t.Errorf("encode = %x, %v, want %x", b.Bytes(), err, testData)
+	}
+
+	// The dump stops at an error.
+	b.Reset()
+	err = f.dump(&b, testData[:12])
+	want := strings.Join(strings.SplitAfter(testDump, "\n")[:7], "") + "0000000b  00                                               (not decoded)\n"
+	if err == nil || b.String() != want {
+		t.Errorf("dump of truncated data = %v\n%s\nwant\n%s", err, b.String(), want)
+	}
+}
+
+type testStruct struct {
+	Int8      int8
+	Int16     int16
+	Uint64    uint64
+	Float64   float64
+	Complex64 complex64
+	Array     [4]uint8
+	BoolArray [4]bool
+}
+
+func TestType(t *testing.T) {
+	v := testStruct{Int16: -2, Uint64: 1 << 40, Float64: 0.5, Complex64: complex(1, -1), Array: [4]uint8{1, 2, 3, 4}, BoolArray: [4]bool{true}}
+	for _, order := range []string{"little", "big"} {
+		for _, natural := range []bool{false, true} {
+			f := typeFormat(reflect.TypeOf(v), order, 0, 0, natural)
+			data, err := f.codec.Append(nil, &v)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var j, b bytes.Buffer
+			if err := f.decodeJSON(&j, data); err != nil {
+				t.Fatalf("%s natural=%v: decode: %v", order, natural, err)
+			}
+			if err := f.encodeJSON(&b, j.Bytes()); err != nil || !bytes.Equal(b.Bytes(), data) {
+				t.Errorf("%s natural=%v: encode = %x, %v, want %x", order, natural, b.Bytes(), err, data)
+			}
+		}
+	}
+
+	f := typeFormat(reflect.TypeOf(v), "little", 0, 0, false)
+	data, _ := litend.Append(nil, &v)
+	if err := f.decodeJSON(new(bytes.Buffer), append(data, 0)); err == nil {
+		t.Errorf("decode with a trailing byte succeeded")
+	}
+	if err := f.encodeJSON(new(bytes.Buffer), []byte(`{"Int8": 200}`)); err == nil {
+		t.Errorf("encode of an int8 of 200 succeeded")
+	}
+}
+
+type testShape interface{ isTestShape() }
+
+type testRect struct{ W, H uint16 }
+
+func (testRect) isTestShape() {}
+
+type testLine struct{ Len uint8 }
+
+func (testLine) isTestShape() {}
+
+func init() {
+	litend.RegisterVariant[testShape, testRect](1)
+	litend.RegisterVariant[testShape, testLine](2)
+}
+
+type testUnion struct {
+	Kind  uint8
+	Shape testShape `binary:"union=Kind"`
+	Tags  map[uint8]string
+}
+
+const testUnionDump = `00000000  01                                               Kind = 1
+00000001  02 00                                            Shape.W = 2
+00000003  03 00                                            Shape.H = 3
+00000005  02 00 00 00 02 03 00 00 00 74 77 6f 03 03 00 00  Tags = map[uint8]string of length 2
+00000015  00 6f 6e 65
+`
+
+const testUnionJSON = `{
+	"Kind": 1,
+	"Shape": {
+		"H": 3,
+		"W": 2
+	},
+	"Tags": [
+		[
+			2,
+			"two"
+		],
+		[
+			3,
+			"one"
+		]
+	]
+}
+`
+
+func TestUnion(t *testing.T) {
+	f := typeFormat(reflect.TypeOf(testUnion{}), "little", 0, 4, false)
+	v := testUnion{Shape: testRect{2, 3}, Tags: map[uint8]string{3: "one", 2: "two"}}
+	data, err := f.codec.Append(nil, &v)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var b bytes.Buffer
+	if err := f.dump(&b, data); err != nil || b.String() != testUnionDump {
+		t.Errorf("dump = %v\n%s\nwant\n%s", err, b.String(), testUnionDump)
+	}
+
+	b.Reset()
+	if err := f.decodeJSON(&b, data); err != nil || b.String() != testUnionJSON {
+		t.Errorf("decode = %v\n%s\nwant\n%s", err, b.String(), testUnionJSON)
+	}
+
+	b.Reset()
+	if err := f.encodeJSON(&b, []byte(testUnionJSON)); err != nil || !bytes.Equal(b.Bytes(), data) {
+		t.Errorf("encode = %x, %v, want %x", b.Bytes(), err, data)
+	}
+	line := `{"Kind": 2, "Shape": {"Len": 7}, "Tags": []}`
+	b.Reset()
+	if err := f.encodeJSON(&b, []byte(line)); err != nil || !bytes.Equal(b.Bytes(), []byte{2, 7, 0, 0, 0, 0}) {
+		t.Errorf("encode of %s = %x, %v", line, b.Bytes(), err)
+	}
+	if err := f.encodeJSON(new(bytes.Buffer), []byte(`{"Kind": 3, "Shape": {}}`)); err == nil {
+		t.Error("encode of an unregistered variant succeeded")
+	}
+
+	// The bytes after the value are dumped as such.
+	b.Reset()
+	if err := f.dump(&b, append(data, 0)); err == nil || !strings.HasSuffix(b.String(), "(not decoded)\n") {
+		t.Errorf("dump with a trailing byte = %v\n%s", err, b.String())
+	}
+}
+
+func TestRegister(t *testing.T) {
+	fl := flags{typeName: "bincodec.testStruct", order: "big"}
+	if _, err := fl.loadFormat(); err == nil || !strings.Contains(err.Error(), "unknown type") {
+		t.Errorf("loadFormat of an unregistered type = %v", err)
+	}
+	Register("bincodec.testStruct", reflect.TypeOf(testStruct{}))
+	defer delete(goTypes, "bincodec.testStruct")
+	f, err := fl.loadFormat()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, big := f.codec.(bigend.Codec); f.typ != reflect.TypeOf(testStruct{}) || !big {
+		t.Errorf("loadFormat = %+v", f)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("second Register of a name did not panic")
+		}
+	}()
+	Register("bincodec.testStruct", reflect.TypeOf(0))
+}
@@ -0,0 +1,121 @@
+package bincodec
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+
+	"github.com/go-perf/encoding/schema"
+)
+
+// bytesPerLine is the number of bytes on a line of a dump.
+const bytesPerLine = 16
+
+// dump writes a hex dump of b to w, annotated with the spans of the
+// value encoded in b. If b cannot be decoded, the dump stops at the
+// error and is followed by the bytes left.
+func (f *format) dump(w io.Writer, b []byte) error {
+	if f.typ != nil {
+		return f.dumpType(w, b)
+	}
+	bw := bufio.NewWriter(w)
+	end := 0
+	var last schema.Span
+	_, err := f.decode(b, func(s schema.Span) {
+		if s.Bits > 0 && last.Bits > 0 && s.Offset == last.Offset {
+			// The bit fields of a run share their bytes.
+			fmt.Fprintf(bw, "%08x  %-*s  %s\n", s.Offset, 3*bytesPerLine-1, "", note(s))
+		} else {
+			dumpBytes(bw, b, s.Offset, s.Offset+s.Size, note(s))
+		}
+		end, last = s.Offset+s.Size, s
+	})
+	if end < len(b) {
+		dumpBytes(bw, b, end, len(b), "(not decoded)")
+	}
+	if ferr := bw.Flush(); err == nil {
+		err = ferr
+	}
+	return err
+}
+
+// dumpType writes the dump of the value of the Go type encoded in b, as
+// Codec.Dump writes it, followed by the bytes left.
+func (f *format) dumpType(w io.Writer, b []byte) error {
+	p, n, err := f.decodeType(b)
+	if err != nil {
+		dumpBytes(w, b, 0, len(b), "(not decoded)")
+		return err
+	}
+	if err := f.codec.Dump(w, p.Interface()); err != nil {
+		return err
+	}
+	if enc, err := f.codec.Append(nil, p.Interface()); err != nil || !bytes.Equal(enc, b[:n]) {
+		// Decoding ignores such bytes as nonzero padding, which the
+		// dump of the value shows as zeros.
+		return fmt.Errorf("%s: the dump differs from the input, which has bytes the Codec ignores", f.typ)
+	}
+	if n < len(b) {
+		dumpBytes(w, b, n, len(b), "(not decoded)")
+		return trailing(b, n)
+	}
+	return nil
+}
+
+// dumpBytes writes the bytes of b from start to end, with the note on
+// their first line.
+func dumpBytes(w io.Writer, b []byte, start, end int, note string) {
+	for off := start; off < end; off += bytesPerLine {
+		line := b[off:min(off+bytesPerLine, end)]
+		hex := make([]byte, 0, 3*bytesPerLine)
+		for i, c := range line {
+			if i > 0 {
+				hex = append(hex, ' ')
+			}
+			hex = append(hex, "0123456789abcdef"[c>>4], "0123456789abcdef"[c&15])
+		}
+		if note == "" {
+			fmt.Fprintf(w, "%08x  %s\n", off, hex)
+		} else {
+			fmt.Fprintf(w, "%08x  %-*s  %s\n", off, 3*bytesPerLine-1, hex, note)
+			note = ""
+		}
+	}
+}
+
+// note returns the annotation of the span s.
+func note(s schema.Span) string {
+	var n string
+	switch s.Kind {
+	case schema.LengthSpan:
+		n = "length " + strconv.FormatUint(s.Value.(uint64), 10)
+	case schema.PaddingSpan:
+		n = "padding"
+	default:
+		v, err := json.Marshal(jsonValue(s.Value))
+		if err != nil {
+			v = []byte(fmt.Sprint(s.Value))
+		}
+		n = string(v)
+	}
+	if s.Bits > 0 {
+		n += " (bits " + strconv.Itoa(s.BitOffset) + ".." + strconv.Itoa(s.BitOffset+s.Bits-1) + ")"
+	}
+	if s.Path == "" {
+		return n
+	}
+	if s.Kind == schema.ValueSpan {
+		return s.Path + " = " + n
+	}
+	return s.Path + ": " + n
+}
+
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,278 @@
+package bincodec
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+
+	"github.com/go-perf/encoding/internal/wire"
+)
+
+// This file converts between Go values and the trees of package schema,
+// so that values of registered Go types are written and read as JSON
+// like the values of a schema.
+
+// treeValue returns the Go value v as a tree, as schema.Decode returns
+// values. Map entries are sorted by the key encoding of c, as c encodes
+// them.
+func treeValue(c codec, v reflect.Value) any {
+	switch v.Kind() {
+	case reflect.Bool:
+		return v.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int()
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return v.Uint()
+	case reflect.Float32, reflect.Float64:
+		return v.Float()
+	case reflect.Complex64, reflect.Complex128:
+		return v.Complex()
+	case reflect.String:
+		return v.String()
+
+	case reflect.Pointer, reflect.Interface:
+		if v.IsNil() {
+			if v.Kind() == reflect.Interface {
+				return nil
+			}
+			return treeValue(c, reflect.Zero(v.Type().Elem()))
+		}
+		return treeValue(c, v.Elem())
+
+	case reflect.Array, reflect.Slice:
+		l := make([]any, v.Len())
+		for i := range l {
+			l[i] = treeValue(c, v.Index(i))
+		}
+		return l
+
+	case reflect.Map:
+		type entry struct {
+			key  []byte
+			pair []any
+		}
+		entries := make([]entry, 0, v.Len())
+		for it := v.MapRange(); it.Next(); {
+			k := reflect.New(it.Key().Type())
+			k.Elem().Set(it.Key())
+			key, _ := c.Append(nil, k.Interface())
+			entries = append(entries, entry{key, []any{treeValue(c, it.Key()), treeValue(c, it.Value())}})
+		}
+		sort.Slice(entries, func(i, j int) bool { return bytes.Compare(entries[i].key, entries[j].key) < 0 })
+		l := make([]any, len(entries))
+		for i, e := range entries {
+			l[i] = e.pair
+		}
+		return l
+
+	case reflect.Struct:
+		m := make(map[string]any)
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			if sf := t.Field(i); sf.Name != "_" && sf.IsExported() {
+				m[sf.Name] = treeValue(c, v.Field(i))
+			}
+		}
+		return m
+	}
+	return nil
+}
+
+// setTree sets the Go value v from the tree x, as schema.Encode accepts
+// trees. The variants of union fields are looked up with variant.
+func setTree(v reflect.Value, x any, variant func(reflect.Type, uint64) (reflect.Type, bool)) error {
+	mismatch := func() error {
+		return fmt.Errorf("%T value for %s", x, v.Type())
+	}
+	switch v.Kind() {
+	case reflect.Bool:
+		b, ok := x.(bool)
+		if !ok {
+			return mismatch()
+		}
+		v.SetBool(b)
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, ok := x.(json.Number)
+		if !ok {
+			return mismatch()
+		}
+		i, err := strconv.ParseInt(string(n), 10, v.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("%s: %v", v.Type(), err)
+		}
+		v.SetInt(i)
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		n, ok := x.(json.Number)
+		if !ok {
+			return mismatch()
+		}
+		u, err := strconv.ParseUint(string(n), 10, v.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("%s: %v", v.Type(), err)
+		}
+		v.SetUint(u)
+
+	case reflect.Float32, reflect.Float64:
+		f, ok := floatTree(x)
+		if !ok {
+			return mismatch()
+		}
+		v.SetFloat(f)
+
+	case reflect.Complex64, reflect.Complex128:
+		l, ok := x.([]any)
+		if !ok || len(l) != 2 {
+			return mismatch()
+		}
+		re, ok1 := floatTree(l[0])
+		im, ok2 := floatTree(l[1])
+		if !ok1 || !ok2 {
+			return mismatch()
+		}
+		v.SetComplex(complex(re, im))
+
+	case reflect.String:
+		s, ok := x.(string)
+		if !ok {
+			return mismatch()
+		}
+		v.SetString(s)
+
+	case reflect.Pointer:
+		p := reflect.New(v.Type().Elem())
+		if err := setTree(p.Elem(), x, variant); err != nil {
+			return err
+		}
+		v.Set(p)
+
+	case reflect.Array, reflect.Slice:
+		l, ok := x.([]any)
+		if !ok {
+			return mismatch()
+		}
+		if v.Kind() == reflect.Slice {
+			v.Set(reflect.MakeSlice(v.Type(), len(l), len(l)))
+		} else if len(l) != v.Len() {
+			return fmt.Errorf("list of %d elements for %s", len(l), v.Type())
+		}
+		for i, e := range l {
+			if err := setTree(v.Index(i), e, variant); err != nil {
+				return err
+			}
+		}
+
+	case reflect.Map:
+		l, ok := x.([]any)
+		if !ok {
+			return mismatch()
+		}
+		v.Set(reflect.MakeMapWithSize(v.Type(), len(l)))
+		for _, e := range l {
+			pair, ok := e.([]any)
+			if !ok || len(pair) != 2 {
+				return errors.New("map entry is not a [key, value] pair")
+			}
+			key, val := reflect.New(v.Type().Key()).Elem(), reflect.New(v.Type().Elem()).Elem()
+			if err := setTree(key, pair[0], variant); err != nil {
+				return err
+			}
+			if err := setTree(val, pair[1], variant); err != nil {
+				return err
+			}
+			v.SetMapIndex(key, val)
+		}
+
+	case reflect.Struct:
+		m, ok := x.(map[string]any)
+		if !ok {
+			return mismatch()
+		}
+		t := v.Type()
+		for name := range m {
+			if sf, ok := t.FieldByName(name); !ok || len(sf.Index) != 1 || !sf.IsExported() {
+				return errors.New("unknown field " + name + " of " + t.String())
+			}
+		}
+		// The fields are set in order, so the field holding the tag
+		// of a union is set before the union.
+		for i := 0; i < t.NumField(); i++ {
+			sf := t.Field(i)
+			fx, ok := m[sf.Name]
+			if !ok || sf.Name == "_" {
+				continue
+			}
+			if sf.Type.Kind() == reflect.Interface {
+				if err := setVariant(v, i, fx, variant); err != nil {
+					return err
+				}
+				continue
+			}
+			if err := setTree(v.Field(i), fx, variant); err != nil {
+				return fmt.Errorf("%s: %v", sf.Name, err)
+			}
+		}
+
+	default:
+		return errors.New("unsupported type " + v.Type().String())
+	}
+	return nil
+}
+
+// setVariant sets the union field i of the struct v from the tree x,
+// with the variant selected by the tag in the field named by union=.
+func setVariant(v reflect.Value, i int, x any, variant func(reflect.Type, uint64) (reflect.Type, bool)) error {
+	sf := v.Type().Field(i)
+	if x == nil {
+		return nil
+	}
+	tag, ok := wire.ParseTag(sf.Tag.Get("binary"))
+	if !ok || tag.Ref != wire.RefTag {
+		return errors.New(sf.Name + ": interface field without a union= tag")
+	}
+	kind := v.FieldByName(tag.From)
+	var k uint64
+	switch kind.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		k = uint64(kind.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		k = kind.Uint()
+	default:
+		return errors.New(sf.Name + ": invalid union field " + tag.From)
+	}
+	vt, ok := variant(sf.Type, k)
+	if !ok {
+		return fmt.Errorf("%s: no variant %d of %s", sf.Name, k, sf.Type)
+	}
+	vv := reflect.New(vt).Elem()
+	if err := setTree(vv, x, variant); err != nil {
+		return fmt.Errorf("%s: %v", sf.Name, err)
+	}
+	v.Field(i).Set(vv)
+	return nil
+}
+
+// floatTree returns the number x, or NaN, +Inf or -Inf, as a float64.
+func floatTree(x any) (float64, bool) {
+	switch x := x.(type) {
+	case json.Number:
+		f, err := x.Float64()
+		return f, err == nil
+	case string:
+		switch x {
+		case "NaN":
+			return math.NaN(), true
+		case "+Inf":
+			return math.Inf(1), true
+		case "-Inf":
+			return math.Inf(-1), true
+		}
+	}
+	return 0, false
+}
@@ -0,0 +1,73 @@
+package bincodec
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"math"
+)
+
+// decodeJSON writes the value encoded in b to w as JSON.
+func (f *format) decodeJSON(w io.Writer, b []byte) error {
+	v, err := f.decode(b, nil)
+	if err != nil {
+		return err
+	}
+	out, err := json.MarshalIndent(jsonValue(v), "", "\t")
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(out, '\n'))
+	return err
+}
+
+// encodeJSON writes the encoding of the JSON value in b to w.
+func (f *format) encodeJSON(w io.Writer, b []byte) error {
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return err
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return errors.New("data after the JSON value")
+	}
+	out, err := f.encode(v)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(out)
+	return err
+}
+
+// jsonValue returns the decoded value v with the numbers JSON cannot
+// represent replaced by the forms schema.Encode accepts for them.
+func jsonValue(v any) any {
+	switch v := v.(type) {
+	case float64:
+		switch {
+		case math.IsNaN(v):
+			return "NaN"
+		case math.IsInf(v, 1):
+			return "+Inf"
+		case math.IsInf(v, -1):
+			return "-Inf"
+		}
+	case complex128:
+		return []any{jsonValue(real(v)), jsonValue(imag(v))}
+	case []any:
+		l := make([]any, len(v))
+		for i, x := range v {
+			l[i] = jsonValue(x)
+		}
+		return l
+	case map[string]any:
+		m := make(map[string]any, len(v))
+		for k, x := range v {
+			m[k] = jsonValue(x)
+		}
+		return m
+	}
+	return v
+}
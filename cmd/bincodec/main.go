@@ -0,0 +1,21 @@
+// Bincodec decodes, encodes and annotates binary data described by
+// a JSON schema, as documented in package bincodec.
+//
+// Usage:
+//
+//	bincodec -schema=file.json dump|decode|encode [file]
+//
+// This command has no registered Go types. To inspect the encodings of
+// Go types with -type, build a command that registers them:
+//
+//	func main() {
+//		bincodec.Register("pkt.Header", reflect.TypeOf(pkt.Header{}))
+//		bincodec.Main()
+//	}
+package main
+
+import "github.com/go-perf/encoding/bincodec"
+
+func main() {
+	bincodec.Main()
+}
@@ -0,0 +1,470 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"go/types"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/go-perf/encoding/internal/wire"
+)
+
+// cgen generates a C header declaring Go struct types.
+type cgen struct {
+	natural bool
+	intSize int
+	order   string // "little" or "big"
+	guard   string // include guard macro
+	command string // command line, for the generated code comment
+	types   []types.Type
+
+	structs map[*types.Struct]*cstruct
+	emitted map[*types.Named]bool
+	body    bytes.Buffer
+}
+
+// maxPointerChain is the longest chain of pointers the codecs follow.
+const maxPointerChain = 16
+
+// cstruct is the layout of a struct type, as planned by the codecs.
+type cstruct struct {
+	fields []cfield
+	size   int
+	align  int
+}
+
+// cfield is a struct field, or a bit field.
+type cfield struct {
+	name    string // C name, empty for blank bit fields
+	typ     types.Type
+	off     int // offset in the struct; for a bit field, of its run
+	bitOff  int // bit field offset in the bits of its run
+	size    int
+	align   int
+	aligned bool // align= field
+	bits    int  // bit field width, or 0
+	fixed   int  // fixed= string size, or 0
+	utf16   bool
+}
+
+func (g *cgen) header() ([]byte, error) {
+	g.structs = make(map[*types.Struct]*cstruct)
+	g.emitted = make(map[*types.Named]bool)
+	for _, t := range g.types {
+		named, ok := t.(*types.Named)
+		if !ok {
+			return nil, errors.New(t.String() + " is not a named type")
+		}
+		if _, ok := named.Underlying().(*types.Struct); !ok {
+			return nil, errors.New(t.String() + " is not a struct type")
+		}
+		if err := g.emit(named); err != nil {
+			return nil, err
+		}
+	}
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "// Code generated by \"%s\"; DO NOT EDIT.\n\n", g.command)
+	fmt.Fprintf(&b, "#ifndef %s\n#define %s\n\n", g.guard, g.guard)
+	b.WriteString("#include <stdbool.h>\n#include <stddef.h>\n#include <stdint.h>\n\n")
+	fmt.Fprintf(&b, "#if defined(__BYTE_ORDER__) && __BYTE_ORDER__ != __ORDER_%s_ENDIAN__\n", strings.ToUpper(g.order))
+	fmt.Fprintf(&b, "#error \"these structs are encoded %s-endian\"\n#endif\n", g.order)
+	b.Write(g.body.Bytes())
+	fmt.Fprintf(&b, "\n#endif // %s\n", g.guard)
+	return b.Bytes(), nil
+}
+
+// emit declares the struct type t, after the struct types it contains.
+func (g *cgen) emit(t *types.Named) error {
+	if g.emitted[t] {
+		return nil
+	}
+	g.emitted[t] = true
+	cs, err := g.structLayout(t.Underlying().(*types.Struct), t.Obj().Name())
+	if err != nil {
+		return err
+	}
+	if err := g.emitDeps(cs); err != nil {
+		return err
+	}
+
+	name := "struct " + t.Obj().Name()
+	packed := !g.natural && cs.align > 1
+	if !g.natural && !packed {
+		g.body.WriteString("\n#pragma pack(push, 1)")
+	}
+	g.body.WriteString("\n")
+	g.writeStructType(t.Obj().Name(), cs, packed, "")
+	g.body.WriteString(";\n")
+	if !g.natural && !packed {
+		g.body.WriteString("#pragma pack(pop)\n")
+	}
+	fmt.Fprintf(&g.body, "\n_Static_assert(sizeof(%s) == %d, \"size of %s\");\n", name, cs.size, name)
+	g.writeOffsets(name, cs, "", 0)
+	return nil
+}
+
+// writeOffsets asserts the offsets of the fields of cs in the struct type
+// name, where cs is laid out at offset base and its fields are members of
+// prefix. Bit fields have no offset in C.
+func (g *cgen) writeOffsets(name string, cs *cstruct, prefix string, base int) {
+	for _, f := range cs.fields {
+		if f.bits != 0 {
+			continue
+		}
+		member := prefix + f.name
+		fmt.Fprintf(&g.body, "_Static_assert(offsetof(%s, %s) == %d, \"offset of %s in %s\");\n",
+			name, member, base+f.off, member, name)
+		if st, ok := f.typ.(*types.Struct); ok {
+			g.writeOffsets(name, g.structs[st], member+".", base+f.off)
+		}
+	}
+}
+
+// emitDeps emits the named struct types of the fields of cs.
+func (g *cgen) emitDeps(cs *cstruct) error {
+	for _, f := range cs.fields {
+		t := elemType(f.typ)
+		if named, ok := t.(*types.Named); ok {
+			if _, ok := named.Underlying().(*types.Struct); ok {
+				if err := g.emit(named); err != nil {
+					return err
+				}
+				continue
+			}
+		}
+		if st, ok := t.Underlying().(*types.Struct); ok {
+			if err := g.emitDeps(g.structs[st]); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// elemType returns the type of the elements of arrays of t, and of the
+// values pointed to by pointers t.
+func elemType(t types.Type) types.Type {
+	for {
+		switch u := t.Underlying().(type) {
+		case *types.Array:
+			t = u.Elem()
+		case *types.Pointer:
+			t = u.Elem()
+		default:
+			return t
+		}
+	}
+}
+
+// writeStructType writes the struct type cs named name, or anonymous if
+// name is empty.
+func (g *cgen) writeStructType(name string, cs *cstruct, packed bool, indent string) {
+	g.body.WriteString("struct ")
+	if packed {
+		g.body.WriteString("__attribute__((packed)) ")
+	}
+	if name != "" {
+		g.body.WriteString(name + " ")
+	}
+	g.body.WriteString("{\n")
+	for _, f := range cs.fields {
+		g.body.WriteString(indent + "\t")
+		switch {
+		case f.aligned && g.natural:
+			fmt.Fprintf(&g.body, "_Alignas(%d) ", f.align)
+		case f.align > 1 && !g.natural:
+			fmt.Fprintf(&g.body, "_Alignas(%d) ", f.align)
+		}
+		switch {
+		case f.bits != 0:
+			g.writeDecl(f.typ, f.name, packed, indent+"\t")
+			fmt.Fprintf(&g.body, " : %d", f.bits)
+		case f.fixed != 0 && f.utf16:
+			fmt.Fprintf(&g.body, "uint16_t %s[%d]", f.name, f.fixed/2)
+		case f.fixed != 0:
+			fmt.Fprintf(&g.body, "char %s[%d]", f.name, f.fixed)
+		default:
+			g.writeDecl(f.typ, f.name, packed, indent+"\t")
+		}
+		g.body.WriteString(";\n")
+	}
+	g.body.WriteString(indent + "}")
+}
+
+// writeDecl writes the declaration of name as a value of type t.
+func (g *cgen) writeDecl(t types.Type, name string, packed bool, indent string) {
+	suffix := ""
+	for {
+		if arr, ok := t.Underlying().(*types.Array); ok {
+			suffix += "[" + strconv.FormatInt(arr.Len(), 10) + "]"
+			t = arr.Elem()
+		} else if ptr, ok := t.Underlying().(*types.Pointer); ok {
+			t = ptr.Elem()
+		} else {
+			break
+		}
+	}
+	switch u := t.Underlying().(type) {
+	case *types.Basic:
+		g.body.WriteString(g.basicType(u))
+	case *types.Struct:
+		if named, ok := t.(*types.Named); ok {
+			g.body.WriteString("struct " + named.Obj().Name())
+		} else {
+			g.writeStructType("", g.structs[u], packed, indent)
+		}
+	}
+	if name != "" {
+		g.body.WriteString(" " + name)
+	}
+	g.body.WriteString(suffix)
+}
+
+func (g *cgen) basicType(t *types.Basic) string {
+	switch t.Kind() {
+	case types.Bool:
+		return "bool"
+	case types.Int8:
+		return "int8_t"
+	case types.Int16:
+		return "int16_t"
+	case types.Int32:
+		return "int32_t"
+	case types.Int64:
+		return "int64_t"
+	case types.Uint8:
+		return "uint8_t"
+	case types.Uint16:
+		return "uint16_t"
+	case types.Uint32:
+		return "uint32_t"
+	case types.Uint64:
+		return "uint64_t"
+	case types.Int:
+		return "int" + strconv.Itoa(8*g.intSize) + "_t"
+	case types.Uint:
+		return "uint" + strconv.Itoa(8*g.intSize) + "_t"
+	case types.Float32:
+		return "float"
+	case types.Float64:
+		return "double"
+	case types.Complex64:
+		return "float _Complex"
+	case types.Complex128:
+		return "double _Complex"
+	}
+	panic("unsupported basic type " + t.String())
+}
+
+// layout returns the size and alignment of values of type t.
+// The what argument names the value in errors.
+func (g *cgen) layout(t types.Type, what string) (size, align int, err error) {
+	switch u := t.Underlying().(type) {
+	case *types.Basic:
+		size, align = g.basicLayout(u)
+		if size == 0 && (u.Kind() == types.Int || u.Kind() == types.Uint) {
+			return 0, 0, errors.New(what + ": type " + t.String() + " needs -intsize")
+		}
+		if size == 0 {
+			return 0, 0, errors.New(what + ": type " + t.String() + " has no fixed-size encoding")
+		}
+		if !g.natural {
+			align = 1
+		}
+		return size, align, nil
+	case *types.Array:
+		size, align, err = g.layout(u.Elem(), what)
+		return size * int(u.Len()), align, err
+	case *types.Pointer:
+		// Pointers are encoded as the value they point to.
+		e := u.Elem()
+		for n := 1; ; n++ {
+			p, ok := e.Underlying().(*types.Pointer)
+			if !ok {
+				break
+			}
+			if n == maxPointerChain {
+				return 0, 0, errors.New(what + ": type " + t.String() + " has no fixed-size encoding")
+			}
+			e = p.Elem()
+		}
+		return g.layout(e, what)
+	case *types.Struct:
+		name := what
+		if named, ok := t.(*types.Named); ok {
+			name = named.Obj().Name()
+		}
+		cs, err := g.structLayout(u, name)
+		if err != nil {
+			return 0, 0, err
+		}
+		return cs.size, cs.align, nil
+	}
+	return 0, 0, errors.New(what + ": type " + t.String() + " has no fixed-size encoding")
+}
+
+// basicLayout returns the natural size and alignment of values of type t,
+// or zeros if t cannot be declared in C.
+func (g *cgen) basicLayout(t *types.Basic) (size, align int) {
+	switch t.Kind() {
+	case types.Bool, types.Int8, types.Uint8:
+		return 1, 1
+	case types.Int16, types.Uint16:
+		return 2, 2
+	case types.Int32, types.Uint32, types.Float32:
+		return 4, 4
+	case types.Int64, types.Uint64, types.Float64:
+		return 8, 8
+	case types.Complex64:
+		return 8, 4
+	case types.Complex128:
+		return 16, 8
+	case types.Int, types.Uint:
+		if g.intSize == 4 || g.intSize == 8 {
+			return g.intSize, g.intSize
+		}
+	}
+	return 0, 0
+}
+
+// structLayout lays out the struct type st named name as the planner of
+// the codecs does.
+func (g *cgen) structLayout(st *types.Struct, name string) (*cstruct, error) {
+	if cs, ok := g.structs[st]; ok {
+		if cs == nil {
+			return nil, errors.New(name + " contains itself")
+		}
+		return cs, nil
+	}
+	g.structs[st] = nil
+
+	cs := &cstruct{align: 1}
+	var run wire.BitRun // the bit field run being laid out, if inRun
+	inRun, runOff := false, 0
+	reserved := 0 // number of blank fields so far
+	for i := 0; i < st.NumFields(); i++ {
+		sf := st.Field(i)
+		what := name + "." + sf.Name()
+		tag := reflect.StructTag(st.Tag(i)).Get("binary")
+		opts, ok := wire.ParseTag(tag)
+		if !ok {
+			return nil, errors.New(what + ": invalid tag " + strconv.Quote(tag))
+		}
+		if opts.Ref != wire.RefNone || opts.Cond != nil || opts.Str != nil && opts.Str.Fixed == 0 {
+			return nil, errors.New(what + ": tag " + strconv.Quote(tag) + " has no fixed-size C declaration")
+		}
+		f := cfield{name: cName(sf.Name()), typ: sf.Type()}
+		if sf.Name() == "_" {
+			f.name = "reserved" + strconv.Itoa(reserved)
+			reserved++
+		}
+
+		if opts.Bits != 0 {
+			size := bitFieldSize(sf.Type())
+			if size == 0 || opts.Bits > 8*size || opts.Align != 0 ||
+				size == 1 && opts.Bits != 1 && isBool(sf.Type()) {
+				return nil, errors.New(what + ": invalid bit field")
+			}
+			if !inRun {
+				run, inRun, runOff = wire.NewBitRun(cs.size), true, cs.size
+			}
+			if g.natural {
+				f.bitOff = run.Add(opts.Bits, size)
+			} else {
+				f.bitOff = run.Add(opts.Bits, 0)
+			}
+			f.off, f.bits, f.align = runOff, opts.Bits, 1
+			if sf.Name() == "_" {
+				f.name = ""
+			} else if g.natural && size > cs.align {
+				cs.align = size
+			}
+			cs.fields = append(cs.fields, f)
+			continue
+		}
+		if inRun {
+			cs.size += run.Size()
+			inRun = false
+		}
+
+		switch {
+		case opts.Str != nil:
+			if b, ok := sf.Type().Underlying().(*types.Basic); !ok || b.Kind() != types.String {
+				return nil, errors.New(what + ": fixed= field is not a string")
+			}
+			f.fixed, f.utf16, f.size, f.align = opts.Str.Fixed, opts.Str.UTF16, opts.Str.Fixed, 1
+			if g.natural {
+				f.align = opts.Str.Unit()
+			}
+		default:
+			var err error
+			f.size, f.align, err = g.layout(sf.Type(), what)
+			if err != nil {
+				return nil, err
+			}
+		}
+		if opts.Align > f.align {
+			f.align = opts.Align
+			f.aligned = true
+		}
+		if f.align > cs.align {
+			cs.align = f.align
+		}
+		cs.size = wire.AlignUp(cs.size, f.align)
+		f.off = cs.size
+		cs.size += f.size
+		cs.fields = append(cs.fields, f)
+	}
+	if inRun {
+		cs.size += run.Size()
+	}
+	cs.size = wire.AlignUp(cs.size, cs.align)
+	g.structs[st] = cs
+	return cs, nil
+}
+
+// bitFieldSize returns the size of the type t of a bit field, or 0 if
+// t cannot hold bit fields.
+func bitFieldSize(t types.Type) int {
+	b, ok := t.Underlying().(*types.Basic)
+	if !ok {
+		return 0
+	}
+	switch b.Kind() {
+	case types.Bool, types.Int8, types.Uint8:
+		return 1
+	case types.Int16, types.Uint16:
+		return 2
+	case types.Int32, types.Uint32:
+		return 4
+	case types.Int64, types.Uint64:
+		return 8
+	}
+	return 0
+}
+
+func isBool(t types.Type) bool {
+	b, ok := t.Underlying().(*types.Basic)
+	return ok && b.Kind() == types.Bool
+}
+
+// cKeywords are the C keywords that are valid Go identifiers.
+var cKeywords = map[string]bool{
+	"auto": true, "char": true, "double": true, "enum": true, "extern": true,
+	"float": true, "inline": true, "int": true, "long": true, "register": true,
+	"restrict": true, "short": true, "signed": true, "sizeof": true, "static": true,
+	"typedef": true, "union": true, "unsigned": true, "void": true, "volatile": true,
+	"while": true, "do": true, "bool": true, "true": true, "false": true,
+}
+
+// cName returns the C name of the Go field name.
+func cName(name string) string {
+	if cKeywords[name] {
+		return name + "_"
+	}
+	return name
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"bytes"
+	"go/types"
+	"os/exec"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/go-perf/encoding/litend"
+)
+
+var wireTypes = []reflect.Type{
+	reflect.TypeOf(Header{}),
+	reflect.TypeOf(Entry{}),
+	reflect.TypeOf(Aligned{}),
+}
+
+func TestEmitC(t *testing.T) {
+	pkg, err := loadPackage(".", []string{"wire_test.go"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, natural := range []bool{false, true} {
+		g := &cgen{natural: natural, intSize: 8, order: "little", guard: "WIRE_H", command: "encodinggen -emit=c"}
+		for _, rt := range wireTypes {
+			g.types = append(g.types, pkg.Scope().Lookup(rt.Name()).Type())
+		}
+		header, err := g.header()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		c := litend.Codec{IntSize: 8, NaturalAlign: natural}
+		for i, rt := range wireTypes {
+			cs := g.structs[g.types[i].Underlying().(*types.Struct)]
+			if want := c.Size(reflect.New(rt).Interface()); cs.size != want {
+				t.Errorf("natural=%v: size of %s = %d, want %d", natural, rt.Name(), cs.size, want)
+			}
+		}
+
+		// The C compiler checks the static assertions.
+		cc, err := exec.LookPath("cc")
+		if err != nil {
+			continue
+		}
+		cmd := exec.Command(cc, "-std=c11", "-fsyntax-only", "-x", "c", "-")
+		cmd.Stdin = bytes.NewReader(header)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Errorf("natural=%v: %v\n%s\n%s", natural, err, out, header)
+		}
+	}
+}
+
+// TestCOffsets checks the offsets of the fields of the C structs, and the
+// positions of their bit fields, against Codec.Layout.
+func TestCOffsets(t *testing.T) {
+	pkg, err := loadPackage(".", []string{"wire_test.go"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, natural := range []bool{false, true} {
+		g := &cgen{natural: natural, intSize: 8, order: "little", guard: "WIRE_H", command: "encodinggen -emit=c"}
+		for _, rt := range wireTypes {
+			g.types = append(g.types, pkg.Scope().Lookup(rt.Name()).Type())
+		}
+		if _, err := g.header(); err != nil {
+			t.Fatal(err)
+		}
+
+		c := litend.Codec{IntSize: 8, NaturalAlign: natural}
+		for i, rt := range wireTypes {
+			layout, err := c.Layout(rt)
+			if err != nil {
+				t.Fatal(err)
+			}
+			cs := g.structs[g.types[i].Underlying().(*types.Struct)]
+			for j, f := range cs.fields {
+				name := rt.Field(j).Name
+				if name == "_" {
+					continue
+				}
+				// The first value laid out in the field is at its start.
+				var want *litend.FieldLayout
+				for k := range layout {
+					if p := layout[k].Path; p == name || strings.HasPrefix(p, name+".") || strings.HasPrefix(p, name+"[") {
+						want = &layout[k]
+						break
+					}
+				}
+				switch {
+				case want == nil:
+					t.Errorf("natural=%v: %s.%s is not laid out", natural, rt.Name(), name)
+				case f.off != want.Offset:
+					t.Errorf("natural=%v: offset of %s.%s = %d, want %d", natural, rt.Name(), name, f.off, want.Offset)
+				case f.bits != want.Bits || f.bits != 0 && f.bitOff != want.BitOffset:
+					t.Errorf("natural=%v: bits of %s.%s = %d at %d, want %d at %d",
+						natural, rt.Name(), name, f.bits, f.bitOff, want.Bits, want.BitOffset)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,819 @@
+package main
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/go-perf/encoding/internal/wire"
+)
+
+// This file parses the subset of C headers declaring wire structs:
+// struct and typedef declarations of integer, floating-point, bool and
+// char types, enums, fixed arrays and bit fields, with the GCC packed
+// and aligned attributes, _Alignas and #pragma pack. Other declarations
+// are skipped, as are structs with fields of other types, and other
+// preprocessor directives than #pragma pack and integer #defines are
+// ignored.
+
+// htype is a C type.
+type htype struct {
+	name  string   // C name of basic and typedef types
+	goTyp string   // Go type of basic types
+	size  int      // size of basic types
+	elem  *htype   // array element type
+	n     int      // array length
+	st    *hstruct // struct type
+	def   *htype   // type named by a typedef
+	skip  bool     // struct skipped for an unsupported field
+}
+
+// hstruct is a C struct type.
+type hstruct struct {
+	name   string // struct tag, or empty
+	fields []hfield
+	packed bool // __attribute__((packed))
+	pack   int  // #pragma pack in effect at the definition, or 0
+	align  int  // __attribute__((aligned(N))), or 0
+
+	// Layout computed by layout.
+	size    int
+	natural int // alignment
+	laidOut bool
+}
+
+// hfield is a field of a C struct.
+type hfield struct {
+	name    string // empty for unnamed bit fields
+	typ     *htype
+	bits    int // bit field width, or -1
+	alignas int // _Alignas or aligned attribute, or 0
+
+	off int // offset in bits from the start of the struct
+}
+
+// hdecl is a named type declared at the top level of a header.
+type hdecl struct {
+	name string // struct tag or typedef name
+	typ  *htype
+}
+
+var basicTypes = map[string]*htype{
+	"int8_t":   {goTyp: "int8", size: 1},
+	"int16_t":  {goTyp: "int16", size: 2},
+	"int32_t":  {goTyp: "int32", size: 4},
+	"int64_t":  {goTyp: "int64", size: 8},
+	"uint8_t":  {goTyp: "uint8", size: 1},
+	"uint16_t": {goTyp: "uint16", size: 2},
+	"uint32_t": {goTyp: "uint32", size: 4},
+	"uint64_t": {goTyp: "uint64", size: 8},
+	"bool":     {goTyp: "bool", size: 1},
+	"_Bool":    {goTyp: "bool", size: 1},
+	"char":     {goTyp: "byte", size: 1},
+	"float":    {goTyp: "float32", size: 4},
+	"double":   {goTyp: "float64", size: 8},
+	"size_t":   {goTyp: "uint64", size: 8},
+	"ssize_t":  {goTyp: "int64", size: 8},
+
+	// Combinations of signed, unsigned, short, int and long, with the
+	// sizes of LP64 platforms.
+	"signed char":        {goTyp: "int8", size: 1},
+	"unsigned char":      {goTyp: "uint8", size: 1},
+	"short":              {goTyp: "int16", size: 2},
+	"unsigned short":     {goTyp: "uint16", size: 2},
+	"int":                {goTyp: "int32", size: 4},
+	"unsigned int":       {goTyp: "uint32", size: 4},
+	"long":               {goTyp: "int64", size: 8},
+	"unsigned long":      {goTyp: "uint64", size: 8},
+	"long long":          {goTyp: "int64", size: 8},
+	"unsigned long long": {goTyp: "uint64", size: 8},
+}
+
+// hparser parses a C header.
+type hparser struct {
+	toks   []htoken
+	pos    int
+	consts map[string]int64 // integer #defines
+	pack   []int            // #pragma pack stack, innermost last
+	tags   map[string]*htype
+	types  map[string]*htype // typedefs
+	decls  []hdecl
+	depth  int      // nesting of struct definitions
+	warns  []string // structs skipped
+}
+
+type htoken struct {
+	text string
+	line int
+}
+
+// parseHeader parses the C header src. It also returns a warning for
+// each struct skipped for an unsupported field.
+func parseHeader(src string) ([]hdecl, []string, error) {
+	p := &hparser{
+		consts: make(map[string]int64),
+		tags:   make(map[string]*htype),
+		types:  make(map[string]*htype),
+	}
+	if err := p.tokenize(src); err != nil {
+		return nil, nil, err
+	}
+	for p.pos < len(p.toks) {
+		if err := p.topLevel(); err != nil {
+			return nil, nil, err
+		}
+	}
+	return p.decls, p.warns, nil
+}
+
+// tokenize splits src into tokens, handling comments and preprocessor
+// directives. A #pragma pack directive becomes a single token.
+func (p *hparser) tokenize(src string) error {
+	src = stripComments(src)
+	src = strings.ReplaceAll(src, "\\\n", " ")
+	for i, line := range strings.Split(src, "\n") {
+		if t := strings.TrimSpace(line); strings.HasPrefix(t, "#") {
+			p.directive(strings.TrimSpace(t[1:]), i+1)
+			continue
+		}
+		for s := line; ; {
+			s = strings.TrimLeftFunc(s, unicode.IsSpace)
+			if s == "" {
+				break
+			}
+			n := 1
+			switch c := s[0]; {
+			case isIdentByte(c):
+				for n < len(s) && isIdentByte(s[n]) {
+					n++
+				}
+			case c == '"':
+				end := strings.IndexByte(s[1:], '"')
+				if end < 0 {
+					return errors.New("line " + strconv.Itoa(i+1) + ": unterminated string")
+				}
+				n = end + 2
+			case strings.IndexByte("{}[]();,:*=+-/<>&|~!.", c) < 0:
+				return errors.New("line " + strconv.Itoa(i+1) + ": unexpected character " + strconv.Quote(s[:1]))
+			}
+			p.toks = append(p.toks, htoken{s[:n], i + 1})
+			s = s[n:]
+		}
+	}
+	return nil
+}
+
+func isIdentByte(c byte) bool {
+	return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9'
+}
+
+// stripComments replaces the comments of src with spaces, keeping newlines.
+func stripComments(src string) string {
+	var b strings.Builder
+	for i := 0; i < len(src); i++ {
+		switch {
+		case strings.HasPrefix(src[i:], "//"):
+			for i < len(src) && src[i] != '\n' {
+				i++
+			}
+			if i < len(src) {
+				b.WriteByte('\n')
+			}
+		case strings.HasPrefix(src[i:], "/*"):
+			end := strings.Index(src[i+2:], "*/")
+			if end < 0 {
+				end = len(src) - i - 2
+			}
+			b.WriteString(strings.Repeat("\n", strings.Count(src[i:i+2+end], "\n")))
+			b.WriteByte(' ')
+			i += end + 3
+		default:
+			b.WriteByte(src[i])
+		}
+	}
+	return b.String()
+}
+
+// directive handles the preprocessor directive d.
+func (p *hparser) directive(d string, line int) {
+	f := strings.Fields(d)
+	switch {
+	case len(f) > 0 && f[0] == "pragma":
+		args := strings.Join(f[1:], "")
+		if strings.HasPrefix(args, "pack(") && strings.HasSuffix(args, ")") {
+			p.toks = append(p.toks, htoken{"#pack " + args[len("pack("):len(args)-1], line})
+		}
+	case len(f) == 3 && f[0] == "define":
+		if n, err := parseCInt(strings.Trim(f[2], "()")); err == nil {
+			p.consts[f[1]] = n
+		}
+	}
+}
+
+// parseCInt parses a C integer literal.
+func parseCInt(s string) (int64, error) {
+	s = strings.TrimRight(s, "uUlL")
+	if len(s) > 1 && s[0] == '0' && s[1] != 'x' && s[1] != 'X' {
+		s = "0o" + s[1:]
+	}
+	return strconv.ParseInt(s, 0, 64)
+}
+
+func (p *hparser) peek() string {
+	if p.pos < len(p.toks) {
+		return p.toks[p.pos].text
+	}
+	return ""
+}
+
+func (p *hparser) next() string {
+	t := p.peek()
+	p.pos++
+	return t
+}
+
+func (p *hparser) error(msg string) error {
+	line := 0
+	if p.pos < len(p.toks) {
+		line = p.toks[p.pos].line
+	} else if len(p.toks) > 0 {
+		line = p.toks[len(p.toks)-1].line
+	}
+	return errors.New("line " + strconv.Itoa(line) + ": " + msg)
+}
+
+func (p *hparser) expect(tok string) error {
+	if p.peek() != tok {
+		return p.error("expected " + tok + ", found " + strconv.Quote(p.peek()))
+	}
+	p.pos++
+	return nil
+}
+
+// topLevel parses a top-level declaration.
+func (p *hparser) topLevel() error {
+	tok := p.peek()
+	switch {
+	case strings.HasPrefix(tok, "#pack "):
+		p.pos++
+		return p.pragmaPack(strings.TrimPrefix(tok, "#pack "))
+	case tok == "struct" || tok == "typedef":
+		typedef := tok == "typedef"
+		if typedef {
+			p.pos++
+		}
+		t, err := p.typeSpec()
+		if err != nil {
+			return err
+		}
+		if !typedef {
+			// A struct definition or declaration.
+			return p.expect(";")
+		}
+		for {
+			name, typ, err := p.declarator(t)
+			if err != nil {
+				return err
+			}
+			if name == "" {
+				return p.error("typedef without a name")
+			}
+			if typ.st == nil || typ.st.name != "" || typ.n != 0 {
+				typ = &htype{name: name, def: typ}
+			}
+			p.types[name] = typ
+			if !typ.skipped() {
+				p.decls = append(p.decls, hdecl{name, typ})
+			}
+			if p.peek() != "," {
+				break
+			}
+			p.pos++
+		}
+		return p.expect(";")
+	}
+	// Skip other declarations, such as function prototypes and enum
+	// definitions.
+	for depth := 0; p.pos < len(p.toks); {
+		switch p.next() {
+		case "{":
+			depth++
+		case "}":
+			depth--
+		case ";":
+			if depth == 0 {
+				return nil
+			}
+		}
+	}
+	return nil
+}
+
+// pragmaPack handles #pragma pack with the arguments args.
+func (p *hparser) pragmaPack(args string) error {
+	f := strings.Split(args, ",")
+	switch {
+	case args == "":
+		p.pack = append(p.pack[:0], 0)
+	case f[0] == "pop":
+		if len(p.pack) > 0 {
+			p.pack = p.pack[:len(p.pack)-1]
+		}
+	case f[0] == "push":
+		n := p.currentPack()
+		if len(f) > 1 {
+			v, err := parseCInt(f[len(f)-1])
+			if err != nil {
+				return p.error("invalid #pragma pack(" + args + ")")
+			}
+			n = int(v)
+		}
+		p.pack = append(p.pack, n)
+	default:
+		v, err := parseCInt(f[0])
+		if err != nil {
+			return p.error("invalid #pragma pack(" + args + ")")
+		}
+		if len(p.pack) == 0 {
+			p.pack = append(p.pack, 0)
+		}
+		p.pack[len(p.pack)-1] = int(v)
+	}
+	return nil
+}
+
+func (p *hparser) currentPack() int {
+	if len(p.pack) == 0 {
+		return 0
+	}
+	return p.pack[len(p.pack)-1]
+}
+
+// typeSpec parses a type specifier.
+func (p *hparser) typeSpec() (*htype, error) {
+	for p.peek() == "const" || p.peek() == "volatile" {
+		p.pos++
+	}
+	tok := p.peek()
+	switch tok {
+	case "struct":
+		p.pos++
+		return p.structSpec()
+	case "enum":
+		// Enums have the type int with GCC on amd64 and arm64, as they
+		// have no values out of its range.
+		p.pos++
+		name := "enum"
+		if tok := p.peek(); tok != "{" && isIdentByte(tok[0]) {
+			name += " " + tok
+			p.pos++
+		}
+		if p.peek() == "{" {
+			for depth := 0; ; {
+				if p.pos >= len(p.toks) {
+					return nil, p.error("unterminated enum")
+				}
+				switch p.next() {
+				case "{":
+					depth++
+				case "}":
+					depth--
+				}
+				if depth == 0 {
+					break
+				}
+			}
+		}
+		return &htype{name: name, goTyp: "int32", size: 4}, nil
+	case "union":
+		return nil, p.error("union types are not supported")
+	case "signed", "unsigned", "short", "long":
+		var words []string
+		for {
+			switch w := p.peek(); w {
+			case "signed", "unsigned", "short", "long", "int", "char":
+				words = append(words, w)
+				p.pos++
+				continue
+			}
+			break
+		}
+		name := strings.Join(words, " ")
+		if name != "signed char" {
+			name = strings.TrimPrefix(name, "signed ")
+		}
+		switch name = strings.TrimSuffix(name, " int"); name {
+		case "signed":
+			name = "int"
+		case "unsigned":
+			name = "unsigned int"
+		}
+		t, ok := basicTypes[name]
+		if !ok {
+			return nil, p.error("unsupported type " + strings.Join(words, " "))
+		}
+		return &htype{name: name, goTyp: t.goTyp, size: t.size}, nil
+	}
+	p.pos++
+	if t, ok := basicTypes[tok]; ok {
+		return &htype{name: tok, goTyp: t.goTyp, size: t.size}, nil
+	}
+	if t, ok := p.types[tok]; ok {
+		if t.skipped() {
+			p.pos--
+			return nil, p.error("type " + tok + " is skipped")
+		}
+		return t, nil
+	}
+	p.pos--
+	return nil, p.error("unknown type " + strconv.Quote(tok))
+}
+
+// structSpec parses a struct specifier after the struct keyword.
+func (p *hparser) structSpec() (*htype, error) {
+	st := &hstruct{}
+	if err := p.attributes(st, nil); err != nil {
+		return nil, err
+	}
+	if tok := p.peek(); tok != "{" {
+		if !isIdentByte(tok[0]) {
+			return nil, p.error("expected struct name, found " + strconv.Quote(tok))
+		}
+		st.name = tok
+		p.pos++
+	}
+	if err := p.attributes(st, nil); err != nil {
+		return nil, err
+	}
+	if p.peek() != "{" {
+		if t, ok := p.tags[st.name]; ok {
+			if t.skip {
+				return nil, p.error("struct " + st.name + " is skipped")
+			}
+			return t, nil
+		}
+		return nil, p.error("incomplete struct " + st.name)
+	}
+	p.pos++
+	body := p.pos
+	st.pack = p.currentPack()
+	for p.peek() != "}" {
+		if p.pos >= len(p.toks) {
+			return nil, p.error("unterminated struct")
+		}
+		p.depth++
+		err := p.fieldDecl(st)
+		p.depth--
+		if err != nil {
+			if p.depth > 0 {
+				return nil, err
+			}
+			return p.skipStruct(st, body, err)
+		}
+	}
+	p.pos++
+	if err := p.attributes(st, nil); err != nil {
+		return nil, err
+	}
+	t := &htype{st: st}
+	if st.name != "" {
+		p.tags[st.name] = t
+		p.decls = append(p.decls, hdecl{st.name, t})
+	}
+	return t, nil
+}
+
+// skipStruct skips the body of the top-level struct st, which starts at
+// the token body, for the error err in one of its fields.
+func (p *hparser) skipStruct(st *hstruct, body int, err error) (*htype, error) {
+	for depth := 1; depth > 0; {
+		if body >= len(p.toks) {
+			return nil, err
+		}
+		switch p.toks[body].text {
+		case "{":
+			depth++
+		case "}":
+			depth--
+		}
+		body++
+	}
+	p.pos = body
+	if err := p.attributes(st, nil); err != nil {
+		return nil, err
+	}
+	what := "struct"
+	if st.name != "" {
+		what += " " + st.name
+	}
+	p.warns = append(p.warns, "skipping "+what+": "+err.Error())
+	t := &htype{st: st, skip: true}
+	if st.name != "" {
+		p.tags[st.name] = t
+	}
+	return t, nil
+}
+
+// fieldDecl parses a struct field declaration.
+func (p *hparser) fieldDecl(st *hstruct) error {
+	var f hfield
+	if err := p.attributes(nil, &f); err != nil {
+		return err
+	}
+	t, err := p.typeSpec()
+	if err != nil {
+		return err
+	}
+	for {
+		f := f
+		if p.peek() == ":" {
+			f.typ = t
+		} else if f.name, f.typ, err = p.declarator(t); err != nil {
+			return err
+		}
+		f.bits = -1
+		if p.peek() == ":" {
+			p.pos++
+			n, err := p.constExpr()
+			if err != nil {
+				return err
+			}
+			f.bits = int(n)
+			if f.typ.goTyp == "" || f.typ.goTyp == "float32" || f.typ.goTyp == "float64" ||
+				f.bits > 8*f.typ.size || f.bits == 0 && f.name != "" {
+				return p.error("invalid bit field " + f.name)
+			}
+		}
+		if err := p.attributes(nil, &f); err != nil {
+			return err
+		}
+		st.fields = append(st.fields, f)
+		if p.peek() != "," {
+			break
+		}
+		p.pos++
+	}
+	return p.expect(";")
+}
+
+// declarator parses a declarator of type t: a name followed by array
+// dimensions.
+func (p *hparser) declarator(t *htype) (string, *htype, error) {
+	if p.peek() == "*" {
+		return "", nil, p.error("pointers have no wire encoding")
+	}
+	name := p.next()
+	if name == "" || !isIdentByte(name[0]) || name[0] >= '0' && name[0] <= '9' {
+		p.pos--
+		return "", nil, p.error("expected name, found " + strconv.Quote(name))
+	}
+	var dims []int
+	for p.peek() == "[" {
+		p.pos++
+		n, err := p.constExpr()
+		if err != nil {
+			return "", nil, err
+		}
+		if n <= 0 {
+			return "", nil, p.error("invalid array length of " + name)
+		}
+		dims = append(dims, int(n))
+		if err := p.expect("]"); err != nil {
+			return "", nil, err
+		}
+	}
+	for i := len(dims) - 1; i >= 0; i-- {
+		t = &htype{elem: t, n: dims[i]}
+	}
+	return name, t, nil
+}
+
+// attributes parses GCC attributes and _Alignas specifiers, recording
+// them in st or f.
+func (p *hparser) attributes(st *hstruct, f *hfield) error {
+	for {
+		switch p.peek() {
+		case "_Alignas", "alignas":
+			p.pos++
+			if err := p.expect("("); err != nil {
+				return err
+			}
+			n, err := p.constExpr()
+			if err != nil {
+				return err
+			}
+			if f != nil && int(n) > f.alignas {
+				f.alignas = int(n)
+			}
+			if err := p.expect(")"); err != nil {
+				return err
+			}
+		case "__attribute__", "__attribute":
+			p.pos++
+			for _, tok := range []string{"(", "("} {
+				if err := p.expect(tok); err != nil {
+					return err
+				}
+			}
+			for p.peek() != ")" {
+				attr := strings.Trim(p.next(), "_")
+				n := int64(0)
+				if p.peek() == "(" {
+					p.pos++
+					var err error
+					if n, err = p.constExpr(); err != nil {
+						return err
+					}
+					if err := p.expect(")"); err != nil {
+						return err
+					}
+				}
+				switch attr {
+				case "packed":
+					if st != nil {
+						st.packed = true
+					}
+				case "aligned":
+					if n == 0 {
+						n = 16 // the largest alignment on amd64 and arm64
+					}
+					if st != nil && int(n) > st.align {
+						st.align = int(n)
+					}
+					if f != nil && int(n) > f.alignas {
+						f.alignas = int(n)
+					}
+				}
+				if p.peek() == "," {
+					p.pos++
+				}
+			}
+			for _, tok := range []string{")", ")"} {
+				if err := p.expect(tok); err != nil {
+					return err
+				}
+			}
+		default:
+			return nil
+		}
+	}
+}
+
+// constExpr parses an integer constant expression of literals, #define
+// constants, parentheses and the + - * / operators.
+func (p *hparser) constExpr() (int64, error) {
+	x, err := p.constTerm()
+	for err == nil && (p.peek() == "+" || p.peek() == "-") {
+		op := p.next()
+		var y int64
+		if y, err = p.constTerm(); op == "+" {
+			x += y
+		} else {
+			x -= y
+		}
+	}
+	return x, err
+}
+
+func (p *hparser) constTerm() (int64, error) {
+	x, err := p.constFactor()
+	for err == nil && (p.peek() == "*" || p.peek() == "/") {
+		op := p.next()
+		var y int64
+		if y, err = p.constFactor(); err == nil {
+			if op == "*" {
+				x *= y
+			} else if y == 0 {
+				err = p.error("division by zero")
+			} else {
+				x /= y
+			}
+		}
+	}
+	return x, err
+}
+
+func (p *hparser) constFactor() (int64, error) {
+	tok := p.next()
+	switch {
+	case tok == "(":
+		x, err := p.constExpr()
+		if err == nil {
+			err = p.expect(")")
+		}
+		return x, err
+	case tok == "-":
+		x, err := p.constFactor()
+		return -x, err
+	case tok != "" && tok[0] >= '0' && tok[0] <= '9':
+		if n, err := parseCInt(tok); err == nil {
+			return n, nil
+		}
+	default:
+		if n, ok := p.consts[tok]; ok {
+			return n, nil
+		}
+	}
+	p.pos--
+	return 0, p.error("expected integer constant, found " + strconv.Quote(tok))
+}
+
+// alignof returns the alignment of values of type t.
+func (t *htype) alignof() int {
+	switch {
+	case t.def != nil:
+		return t.def.alignof()
+	case t.elem != nil:
+		return t.elem.alignof()
+	case t.st != nil:
+		t.st.layout()
+		return t.st.natural
+	}
+	return t.size
+}
+
+// sizeof returns the size of values of type t.
+func (t *htype) sizeof() int {
+	switch {
+	case t.def != nil:
+		return t.def.sizeof()
+	case t.elem != nil:
+		return t.n * t.elem.sizeof()
+	case t.st != nil:
+		t.st.layout()
+		return t.st.size
+	}
+	return t.size
+}
+
+// skipped reports whether t is or contains a skipped struct.
+func (t *htype) skipped() bool {
+	for t.def != nil || t.elem != nil {
+		if t.def != nil {
+			t = t.def
+		} else {
+			t = t.elem
+		}
+	}
+	return t.skip
+}
+
+// basic returns t without its typedef names.
+func (t *htype) basic() *htype {
+	for t.def != nil {
+		t = t.def
+	}
+	return t
+}
+
+// layout computes the field offsets, size and alignment of st, as GCC
+// does on amd64 and arm64.
+func (st *hstruct) layout() {
+	if st.laidOut {
+		return
+	}
+	st.laidOut = true
+	st.natural = 1
+	pos := 0 // in bits
+	for i := range st.fields {
+		f := &st.fields[i]
+		a := f.typ.alignof()
+		switch {
+		case st.packed:
+			a = 1
+		case st.pack > 0 && a > st.pack:
+			a = st.pack
+		}
+		if f.alignas > a && (st.pack == 0 || st.packed) {
+			a = f.alignas
+		}
+
+		if f.bits < 0 {
+			pos = wire.AlignUp(pos, 8*a)
+			f.off = pos
+			pos += 8 * f.typ.sizeof()
+		} else {
+			unit := 8 * f.typ.basic().size
+			switch {
+			case f.bits == 0:
+				pos = wire.AlignUp(pos, unit)
+			case st.packed || st.pack == 1:
+			case pos/(8*a) != (pos+f.bits-1)/(8*a) || pos/unit != (pos+f.bits-1)/unit:
+				pos = wire.AlignUp(pos, 8*a)
+			}
+			f.off = pos
+			pos += f.bits
+			if f.name == "" {
+				continue // Unnamed bit fields do not align the struct.
+			}
+		}
+		if a > st.natural {
+			st.natural = a
+		}
+	}
+	if st.align > st.natural {
+		st.natural = st.align
+	}
+	st.size = wire.AlignUp(pos, 8*st.natural) / 8
+}
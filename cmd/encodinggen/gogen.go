@@ -0,0 +1,214 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"go/format"
+	"os"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// emitGo returns Go source declaring the struct types and typedefs of
+// the C header file in package pkg, and warnings for the structs it
+// skips.
+func emitGo(file, pkg string) ([]byte, []string, error) {
+	src, err := os.ReadFile(file)
+	if err != nil {
+		return nil, nil, err
+	}
+	decls, warns, err := parseHeader(string(src))
+	if err != nil {
+		return nil, nil, errors.New(file + ": " + err.Error())
+	}
+	for i, w := range warns {
+		warns[i] = file + ": " + w
+	}
+	g := &gogen{
+		names:   make(map[*htype]string),
+		structs: make(map[*hstruct]string),
+		used:    make(map[string]bool),
+	}
+	fmt.Fprintf(&g.b, "// Code generated by \"encodinggen %s\"; DO NOT EDIT.\n\npackage %s\n", strings.Join(os.Args[1:], " "), pkg)
+	for _, d := range decls {
+		g.decl(d)
+	}
+	out, err := format.Source(g.b.Bytes())
+	return out, warns, err
+}
+
+// gogen generates Go declarations of C types.
+type gogen struct {
+	names   map[*htype]string   // Go names of typedefs
+	structs map[*hstruct]string // Go names of struct types
+	used    map[string]bool     // Go names declared so far
+	b       bytes.Buffer
+}
+
+// decl declares the C type d in Go.
+func (g *gogen) decl(d hdecl) {
+	if d.typ.st != nil {
+		st := d.typ.st
+		if _, ok := g.structs[st]; ok {
+			return
+		}
+		st.layout()
+		name := g.newName(goName(d.name, true))
+		what := "struct " + d.name
+		if st.name == "" {
+			what = d.name
+		}
+		g.structs[st] = name
+		fmt.Fprintf(&g.b, "\n// %s is %s, of %d bytes.\ntype %s ", name, what, st.size, name)
+		g.structType(st)
+		g.b.WriteString("\n")
+		return
+	}
+
+	// A typedef of another type.
+	if st := d.typ.def.st; st != nil && g.structs[st] == goName(d.name, true) {
+		g.names[d.typ] = g.structs[st]
+		return
+	}
+	name := g.newName(goName(d.name, true))
+	g.names[d.typ] = name
+	fmt.Fprintf(&g.b, "\n// %s is %s.\n", name, d.name)
+	if d.typ.def.st != nil {
+		fmt.Fprintf(&g.b, "type %s = %s\n", name, g.goType(d.typ.def))
+	} else {
+		fmt.Fprintf(&g.b, "type %s %s\n", name, g.goType(d.typ.def))
+	}
+}
+
+// newName returns name, or name with a numeric suffix if name is
+// already declared.
+func (g *gogen) newName(name string) string {
+	for i := 2; g.used[name]; i++ {
+		name = strings.TrimRight(name, "0123456789") + strconv.Itoa(i)
+	}
+	g.used[name] = true
+	return name
+}
+
+// goType returns the Go type of the C type t.
+func (g *gogen) goType(t *htype) string {
+	switch {
+	case t.def != nil:
+		return g.names[t]
+	case t.elem != nil:
+		return "[" + strconv.Itoa(t.n) + "]" + g.goType(t.elem)
+	case t.st != nil:
+		if name, ok := g.structs[t.st]; ok {
+			return name
+		}
+		var b bytes.Buffer
+		b, g.b = g.b, b
+		t.st.layout()
+		g.structType(t.st)
+		b, g.b = g.b, b
+		return b.String()
+	}
+	return t.goTyp
+}
+
+// structType writes the Go struct type declaring the fields of st, with
+// blank fields for its padding.
+func (g *gogen) structType(st *hstruct) {
+	g.b.WriteString("struct {\n")
+	used := make(map[string]bool)
+	cur := 0       // offset of the end of the fields written so far, in bits
+	inRun := false // the last field written is a bit field
+	pad := func(to int) {
+		if n := to/8 - (cur+7)/8; n > 0 {
+			fmt.Fprintf(&g.b, "_ [%d]byte\n", n)
+		}
+		cur = to
+	}
+	for i := range st.fields {
+		f := &st.fields[i]
+		name := "_"
+		if f.name != "" {
+			name = goName(f.name, false)
+			for k := 2; used[name]; k++ {
+				name = goName(f.name, false) + strconv.Itoa(k)
+			}
+			used[name] = true
+		}
+
+		if f.bits < 0 {
+			pad(f.off)
+			if isCharArray(f.typ) {
+				fmt.Fprintf(&g.b, "%s string `binary:\"fixed=%d\"`\n", name, f.typ.n)
+			} else {
+				fmt.Fprintf(&g.b, "%s %s\n", name, g.goType(f.typ))
+			}
+			cur = f.off + 8*f.typ.sizeof()
+			inRun = false
+			continue
+		}
+		if f.bits == 0 {
+			continue
+		}
+		if !inRun {
+			// A bit field run starts at the next byte.
+			pad(f.off / 8 * 8)
+			inRun = true
+		}
+		for gap := f.off - cur; gap > 0; {
+			n := gap
+			if n > 64 {
+				n = 64
+			}
+			fmt.Fprintf(&g.b, "_ %s `binary:\"bits=%d\"`\n", uintType(n), n)
+			gap -= n
+		}
+		fmt.Fprintf(&g.b, "%s %s `binary:\"bits=%d\"`\n", name, f.typ.basic().goTyp, f.bits)
+		cur = f.off + f.bits
+	}
+	pad(8 * st.size)
+	g.b.WriteString("}")
+}
+
+// isCharArray reports whether t is an array of char, declared as a
+// fixed-size string in Go.
+func isCharArray(t *htype) bool {
+	return t.def == nil && t.elem != nil && t.elem.def == nil && t.elem.name == "char"
+}
+
+// uintType returns the smallest unsigned integer type of at least n bits.
+func uintType(n int) string {
+	switch {
+	case n <= 8:
+		return "uint8"
+	case n <= 16:
+		return "uint16"
+	case n <= 32:
+		return "uint32"
+	}
+	return "uint64"
+}
+
+// goName returns the exported Go name of the C name, in camel case,
+// without the _t suffix of type names.
+func goName(name string, isType bool) string {
+	if isType {
+		name = strings.TrimSuffix(name, "_t")
+	}
+	var b strings.Builder
+	for _, part := range strings.Split(name, "_") {
+		if part == "" {
+			continue
+		}
+		r, n := utf8.DecodeRuneInString(part)
+		b.WriteRune(unicode.ToUpper(r))
+		b.WriteString(part[n:])
+	}
+	s := b.String()
+	if s == "" || s[0] >= '0' && s[0] <= '9' {
+		s = "X" + s
+	}
+	return s
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testHeader = `#include <stdint.h>
+#include <stdbool.h>
+
+#define NAME_LEN 8
+
+typedef uint8_t mac_t[6];
+
+struct entry {
+	int8_t tag;
+	double value;
+	int16_t pos[3];
+	unsigned short count;
+};
+
+typedef struct {
+	uint8_t x;
+	uint32_t a : 4, b : 30;
+	uint8_t y;
+	unsigned : 0;
+	uint8_t z : 3;
+	bool flag : 1;
+} bits_t;
+
+#pragma pack(push, 1)
+struct packed_hdr {
+	uint8_t version;
+	uint32_t length;
+	mac_t mac;
+	char name[NAME_LEN * 2];
+	uint16_t f1 : 3;
+	uint16_t f2 : 15;
+};
+#pragma pack(pop)
+
+struct __attribute__((packed)) apacked {
+	uint8_t a;
+	uint64_t b;
+	uint8_t c __attribute__((aligned(4)));
+};
+
+typedef struct msg_header {
+	uint16_t kind;
+	struct entry entries[2];
+	_Alignas(16) uint8_t al;
+	struct { uint8_t u; uint32_t v; } sub;
+} msg_header_t;
+
+enum color { RED, GREEN = 4, BLUE };
+typedef enum { SMALL, LARGE } size_kind_t;
+
+struct colored {
+	enum color color;
+	uint8_t shade;
+	size_kind_t kind;
+	enum { ON, OFF } state : 2;
+};
+
+struct with_union {
+	uint8_t kind;
+	union { uint32_t u; float f; } value;
+};
+
+struct uses_union {
+	struct with_union w;
+};
+
+int encode(struct entry *e);
+`
+
+// goSizes maps the C types of testHeader to their Go types and sizes.
+var goSizes = []struct {
+	c, goName string
+	size      int
+}{
+	{"struct entry", "Entry", 24},
+	{"bits_t", "Bits", 16},
+	{"struct packed_hdr", "PackedHdr", 30},
+	{"struct apacked", "Apacked", 16},
+	{"msg_header_t", "MsgHeader", 80},
+	{"struct colored", "Colored", 16},
+}
+
+func TestEmitGo(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "wire.h")
+	if err := os.WriteFile(file, []byte(testHeader), 0o666); err != nil {
+		t.Fatal(err)
+	}
+	src, warns, err := emitGo(file, "wire")
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantWarns := []string{
+		file + ": skipping struct with_union: line 60: union types are not supported",
+		file + ": skipping struct uses_union: line 64: struct with_union is skipped",
+	}
+	if strings.Join(warns, "\n") != strings.Join(wantWarns, "\n") {
+		t.Errorf("warnings:\n%s\nwant:\n%s", strings.Join(warns, "\n"), strings.Join(wantWarns, "\n"))
+	}
+
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "wire.go", src, 0)
+	if err != nil {
+		t.Fatalf("%v\n%s", err, src)
+	}
+	pkg, err := new(types.Config).Check("wire", fset, []*ast.File{f}, nil)
+	if err != nil {
+		t.Fatalf("%v\n%s", err, src)
+	}
+
+	for _, name := range []string{"WithUnion", "UsesUnion"} {
+		if pkg.Scope().Lookup(name) != nil {
+			t.Errorf("skipped struct declared as %s in\n%s", name, src)
+		}
+	}
+
+	// The packed layout of the Go types must match the C layout.
+	g := &cgen{structs: make(map[*types.Struct]*cstruct)}
+	var asserts bytes.Buffer
+	for _, s := range goSizes {
+		obj := pkg.Scope().Lookup(s.goName)
+		if obj == nil {
+			t.Errorf("no type %s in\n%s", s.goName, src)
+			continue
+		}
+		size, _, err := g.layout(obj.Type(), s.goName)
+		if err != nil {
+			t.Errorf("%s: %v", s.goName, err)
+			continue
+		}
+		if size != s.size {
+			t.Errorf("size of %s = %d, want %d", s.goName, size, s.size)
+		}
+		fmt.Fprintf(&asserts, "_Static_assert(sizeof(%s) == %d, \"%s\");\n", s.c, s.size, s.c)
+	}
+
+	cc, err := exec.LookPath("cc")
+	if err != nil {
+		return
+	}
+	cmd := exec.Command(cc, "-std=c11", "-fsyntax-only", "-x", "c", "-")
+	cmd.Stdin = io.MultiReader(strings.NewReader(testHeader), &asserts)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Errorf("%v\n%s", err, out)
+	}
+}
@@ -0,0 +1,216 @@
+// Encodinggen generates declarations matching the binary encoding of Go
+// struct types.
+//
+// Usage:
+//
+//	encodinggen -emit=c -type=T[,T...] [flags] [dir]
+//
+// With -emit=c, it reads the Go package in dir, the current directory by
+// default, and writes a C header declaring the named struct types, and the
+// struct types they contain, with the layout Codec.Size reports for them.
+// Each struct is followed by _Static_asserts on its size and on the offset
+// of each of its fields other than bit fields.
+//
+// Structs are declared with #pragma pack(push, 1) unless -natural is set.
+// Packed structs with align= fields are declared with the GCC packed and
+// aligned attributes instead, since the pragma caps field alignment.
+// Only fixed-size structs can be declared: fields must be fixed-size
+// numbers, bools, arrays, pointers, structs, bit fields and fixed= strings.
+//
+// With -emit=go, it reads the C header file instead, and writes Go
+// declarations of its struct types and typedefs, in the package named by
+// -pkg or the package in the current directory. Padding is declared with
+// blank (_) fields, so the structs decode with the packed layout of the
+// default Codec. The header can declare structs and typedefs of
+// fixed-size integer, floating-point, bool, char and enum types, fixed
+// arrays and bit fields, with the GCC packed and aligned attributes,
+// _Alignas and #pragma pack, as laid out by GCC on amd64 and arm64.
+// Arrays of char are declared as fixed= strings, and enums as int32.
+// Other declarations are skipped, as are structs with fields of other
+// types, with a warning.
+//
+//	encodinggen -emit=go [-pkg=name] [-o file] header.h
+//
+// Typical use is from a go:generate directive:
+//
+//	//go:generate encodinggen -emit=c -type=Header,Record -o wire.h
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"go/ast"
+	"go/build"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+var (
+	emit     = flag.String("emit", "", "output language: c or go")
+	typeList = flag.String("type", "", "comma-separated list of struct type names")
+	output   = flag.String("o", "", "output file; default standard output")
+	natural  = flag.Bool("natural", false, "lay out structs as Codec.NaturalAlign does")
+	intSize  = flag.Int("intsize", 0, "encoded size of int and uint fields, as Codec.IntSize")
+	order    = flag.String("order", "little", "byte order of the encoding: little or big")
+	pkgName  = flag.String("pkg", "", "package name of -emit=go output")
+)
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "usage: encodinggen -emit=c -type=T[,T...] [flags] [dir]\n")
+	fmt.Fprintf(os.Stderr, "       encodinggen -emit=go [-pkg=name] [-o file] header.h\n")
+	flag.PrintDefaults()
+	os.Exit(2)
+}
+
+func main() {
+	flag.Usage = usage
+	flag.Parse()
+	if *order != "little" && *order != "big" {
+		usage()
+	}
+
+	var out []byte
+	var err error
+	switch *emit {
+	case "c":
+		if *typeList == "" || flag.NArg() > 1 {
+			usage()
+		}
+		dir := "."
+		if flag.NArg() == 1 {
+			dir = flag.Arg(0)
+		}
+		out, err = emitC(dir, strings.Split(*typeList, ","))
+	case "go":
+		if *typeList != "" || flag.NArg() != 1 {
+			usage()
+		}
+		pkg := *pkgName
+		if pkg == "" {
+			pkg = defaultPackage(filepath.Dir(*output))
+		}
+		var warns []string
+		out, warns, err = emitGo(flag.Arg(0), pkg)
+		for _, w := range warns {
+			fmt.Fprintln(os.Stderr, "encodinggen:", w)
+		}
+	default:
+		usage()
+	}
+	if err == nil {
+		if *output == "" {
+			_, err = os.Stdout.Write(out)
+		} else {
+			err = os.WriteFile(*output, out, 0o666)
+		}
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "encodinggen:", err)
+		os.Exit(1)
+	}
+}
+
+// emitC returns a C header declaring the struct types names of the
+// package in dir.
+func emitC(dir string, names []string) ([]byte, error) {
+	pkg, err := loadPackage(dir, nil)
+	if err != nil {
+		return nil, err
+	}
+	g := &cgen{
+		natural: *natural,
+		intSize: *intSize,
+		order:   *order,
+		guard:   headerGuard(pkg.Name(), *output),
+		command: "encodinggen " + strings.Join(os.Args[1:], " "),
+	}
+	for _, name := range names {
+		obj, ok := pkg.Scope().Lookup(name).(*types.TypeName)
+		if !ok {
+			return nil, errors.New("no type " + name + " in package " + pkg.Name())
+		}
+		g.types = append(g.types, obj.Type())
+	}
+	return g.header()
+}
+
+// loadPackage type-checks the Go files of the package in dir, or only
+// the given files of dir if files is not nil.
+func loadPackage(dir string, files []string) (*types.Package, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	if files == nil {
+		bp, err := build.ImportDir(dir, 0)
+		if err != nil {
+			return nil, err
+		}
+		files = bp.GoFiles
+	}
+
+	fset := token.NewFileSet()
+	var syntax []*ast.File
+	for _, name := range files {
+		f, err := parser.ParseFile(fset, filepath.Join(dir, name), nil, parser.ParseComments)
+		if err != nil {
+			return nil, err
+		}
+		syntax = append(syntax, f)
+	}
+	if len(syntax) == 0 {
+		return nil, errors.New("no Go files in " + dir)
+	}
+
+	// Imports are resolved from the module of dir.
+	build.Default.Dir = dir
+	conf := types.Config{Importer: importer.ForCompiler(fset, "source", nil)}
+	return conf.Check(syntax[0].Name.Name, fset, syntax, nil)
+}
+
+// defaultPackage returns the name of the package in dir, or a name
+// derived from the name of dir if it has no Go files.
+func defaultPackage(dir string) string {
+	if bp, err := build.ImportDir(dir, 0); err == nil {
+		return bp.Name
+	}
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return "main"
+	}
+	name := strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= '0' && r <= '9' {
+			return r
+		}
+		return -1
+	}, strings.ToLower(filepath.Base(abs)))
+	if name == "" || name[0] >= '0' && name[0] <= '9' {
+		return "main"
+	}
+	return name
+}
+
+// headerGuard returns the include guard macro of the header written to
+// the file output, or of package pkg if output is empty.
+func headerGuard(pkg, output string) string {
+	name := pkg + ".h"
+	if output != "" {
+		name = filepath.Base(output)
+	}
+	var b bytes.Buffer
+	for _, r := range strings.ToUpper(name) {
+		if r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' {
+			b.WriteRune(r)
+		} else {
+			b.WriteByte('_')
+		}
+	}
+	return b.String()
+}
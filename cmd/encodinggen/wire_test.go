@@ -0,0 +1,42 @@
+package main
+
+import "github.com/go-perf/encoding/litend"
+
+// Types declared in C by the tests.
+
+type Header struct {
+	Magic   litend.U32
+	Version uint8
+	Flags   uint8  `binary:"bits=3"`
+	Kind    uint16 `binary:"bits=9"`
+	Long    uint32 `binary:"bits=30"`
+	Last    bool   `binary:"bits=1"`
+	_       uint8  `binary:"bits=2"`
+	Length  uint32
+	Entries [2]Entry
+	Name    string `binary:"fixed=6"`
+	Label   string `binary:"fixed=8,utf16"`
+	Next    *Entry
+}
+
+type Entry struct {
+	Tag   int8
+	Value float64
+	Pos   [3]int16
+	_     [3]byte
+	Count int
+}
+
+type Aligned struct {
+	A   uint8
+	B   uint8 `binary:"align=8"`
+	In  Entry
+	C   complex64
+	Sub struct {
+		X uint16
+		Y bool
+	}
+	D uint8  `binary:"bits=5"`
+	E uint16 `binary:"bits=12"`
+	F uint32 `binary:"align=4"`
+}
@@ -837,3 +837,94 @@ func BenchmarkWriteSlice1000Uint8s(b *testing.B) {
 		}
 	})
 }
+
+func BenchmarkViewStruct(b *testing.B) {
+	buf := make([]byte, binary.Size(Packed{}))
+	b.Run("stdlib", func(b *testing.B) {
+		bsr := &byteSliceReader{}
+		var p Packed
+		b.SetBytes(int64(len(buf)))
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			bsr.remain = buf
+			binary.Read(bsr, binary.BigEndian, &p)
+		}
+	})
+	b.Run("litend", func(b *testing.B) {
+		b.SetBytes(int64(len(buf)))
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			litend.View[Packed](buf)
+		}
+	})
+	b.Run("bigend", func(b *testing.B) {
+		b.SetBytes(int64(len(buf)))
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			bigend.View[Packed](buf)
+		}
+	})
+}
+
+func BenchmarkSwapSlice1000Uint32s(b *testing.B) {
+	buf := make([]byte, 4000)
+	b.Run("stdlib", func(b *testing.B) {
+		b.SetBytes(int64(len(buf)))
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			for j := 0; j < len(buf); j += 4 {
+				binary.LittleEndian.PutUint32(buf[j:], binary.BigEndian.Uint32(buf[j:]))
+			}
+		}
+	})
+	b.Run("litend", func(b *testing.B) {
+		b.SetBytes(int64(len(buf)))
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			litend.Swap32s(buf)
+		}
+	})
+	b.Run("bigend", func(b *testing.B) {
+		b.SetBytes(int64(len(buf)))
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			bigend.Swap32s(buf)
+		}
+	})
+}
+
+func BenchmarkFieldUint64(b *testing.B) {
+	buf := make([]byte, binary.Size(Struct{}))
+	b.Run("stdlib", func(b *testing.B) {
+		bsr := &byteSliceReader{}
+		var t Struct
+		b.SetBytes(int64(len(buf)))
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			bsr.remain = buf
+			binary.Read(bsr, binary.BigEndian, &t)
+		}
+	})
+	b.Run("litend", func(b *testing.B) {
+		f, err := litend.Field[uint64](reflect.TypeOf(Struct{}), "Uint64")
+		if err != nil {
+			b.Fatal(err)
+		}
+		b.SetBytes(int64(len(buf)))
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			f.Get(buf)
+		}
+	})
+	b.Run("bigend", func(b *testing.B) {
+		f, err := bigend.Field[uint64](reflect.TypeOf(Struct{}), "Uint64")
+		if err != nil {
+			b.Fatal(err)
+		}
+		b.SetBytes(int64(len(buf)))
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			f.Get(buf)
+		}
+	})
+}
@@ -111,3 +111,15 @@ var (
 	res    = []int32{0x01020304, 0x05060708}
 	putbuf = []byte{0, 0, 0, 0, 0, 0, 0, 0}
 )
+
+// Packed is a struct whose memory layout is its wire layout.
+type Packed struct {
+	SrcPort [2]byte
+	DstPort [2]byte
+	Seq     [4]byte
+	Ack     [4]byte
+	Flags   [2]byte
+	Window  [2]byte
+	Sum     [2]byte
+	Urgent  [2]byte
+}
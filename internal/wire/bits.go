@@ -0,0 +1,81 @@
+package wire
+
+// GetBitsLSB returns width bits of b starting at bit off, LSB-first, as
+// litend packs bit fields: bit 0 is the least significant bit of b[0].
+func GetBitsLSB(b []byte, off, width int) uint64 {
+	var x uint64
+	for i := off + width - 1; i >= off; i-- {
+		x = x<<1 | uint64(b[i>>3]>>(i&7)&1)
+	}
+	return x
+}
+
+// PutBitsLSB stores the low width bits of x into b starting at bit off,
+// LSB-first. The destination bits must be zero.
+func PutBitsLSB(b []byte, off, width int, x uint64) {
+	for i := off; i < off+width; i++ {
+		b[i>>3] |= byte(x&1) << (i & 7)
+		x >>= 1
+	}
+}
+
+// GetBitsMSB returns width bits of b starting at bit off, MSB-first, as
+// bigend packs bit fields: bit 0 is the most significant bit of b[0].
+func GetBitsMSB(b []byte, off, width int) uint64 {
+	var x uint64
+	for i := off; i < off+width; i++ {
+		x = x<<1 | uint64(b[i>>3]>>(7-i&7)&1)
+	}
+	return x
+}
+
+// PutBitsMSB stores the low width bits of x into b starting at bit off,
+// MSB-first. The destination bits must be zero.
+func PutBitsMSB(b []byte, off, width int, x uint64) {
+	for i := off + width - 1; i >= off; i-- {
+		b[i>>3] |= byte(x&1) << (7 - i&7)
+		x >>= 1
+	}
+}
+
+// AlignUp rounds n up to a multiple of align.
+func AlignUp(n, align int) int {
+	if align <= 1 {
+		return n
+	}
+	return (n + align - 1) / align * align
+}
+
+// BitRun lays out a run of consecutive bit fields sharing the same bytes.
+type BitRun struct {
+	base int // bit offset of the run in its 8-byte unit
+	pos  int // bit offset after the last field, from the unit
+}
+
+// NewBitRun returns a run starting at the byte offset off, or at an
+// unknown offset if off is negative.
+func NewBitRun(off int) BitRun {
+	base := 0
+	if off >= 0 {
+		base = 8 * (off % 8)
+	}
+	return BitRun{base: base, pos: base}
+}
+
+// Add lays out a bit field of the given width after the fields of r and
+// returns its offset in bits from the start of the run. If size is not
+// 0, the field does not straddle a unit of size bytes, as C compilers
+// lay out a bit field of a type of that size.
+func (r *BitRun) Add(width, size int) int {
+	if size > 0 && r.pos/(8*size) != (r.pos+width-1)/(8*size) {
+		r.pos = AlignUp(r.pos, 8*size)
+	}
+	off := r.pos - r.base
+	r.pos += width
+	return off
+}
+
+// Size returns the size in bytes of the run.
+func (r *BitRun) Size() int {
+	return (r.pos - r.base + 7) / 8
+}
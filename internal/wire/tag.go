@@ -0,0 +1,174 @@
+// Package wire holds the parts of the encoding shared by the codecs,
+// package schema and encodinggen: the options of `binary:"..."` struct
+// tags, the packing of bit fields and the layout of bit field runs.
+package wire
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Ref is what an integer field holds of a later field of the same
+// struct. Such a field is encoded from the later field, and the later
+// field is decoded according to it.
+type Ref uint8
+
+const (
+	RefNone Ref = iota
+	RefTag      // union=: the variant tag of a union field
+	RefLen      // len=: the number of elements of a slice or string
+	RefSize     // size=: the encoded size in bytes of a slice or string
+)
+
+var refs = map[string]Ref{"union": RefTag, "len": RefLen, "size": RefSize}
+
+// Cond is the presence condition of a struct field declared with an
+// if= or since= option, which depends on an earlier field.
+type Cond struct {
+	On    string // name of the earlier field
+	Mask  uint64 // if=: the field is present if the earlier field & Mask != 0
+	Since uint64 // since=: the field is present if the earlier field >= Since
+}
+
+// Present reports whether a field with condition c is present if the
+// earlier field is x.
+func (c *Cond) Present(x uint64) bool {
+	if c.Mask != 0 {
+		return x&c.Mask != 0
+	}
+	return x >= c.Since
+}
+
+// StringFormat is the encoding of a string field declared with a fixed=,
+// cstring, utf16 or ucs2 option.
+type StringFormat struct {
+	Fixed    int  // encoded size, padded with NUL bytes, or 0
+	CString  bool // terminated by a NUL byte, or a NUL code unit for UTF-16
+	Truncate bool // truncate strings that do not fit instead of failing
+	UTF16    bool // UTF-16 text, whose lengths are in code units
+	UCS2     bool // UTF-16 text without surrogates
+}
+
+// Unit returns the size of a character unit of the format.
+func (sf *StringFormat) Unit() int {
+	if sf.UTF16 {
+		return 2
+	}
+	return 1
+}
+
+// Tag holds the options of a struct field.
+type Tag struct {
+	Bits  int    // bits=: bit field width
+	Align int    // align=: minimum alignment
+	Ref   Ref    // union=, len= or size=
+	From  string // name of the field holding the variant tag or length
+
+	Cond *Cond         // if= or since=, with version=
+	Str  *StringFormat // fixed=, cstring, truncate, utf16 and ucs2
+}
+
+// ParseTag parses a comma-separated list of options, as in a
+// `binary:"..."` struct tag. It reports false if the tag is malformed.
+func ParseTag(tag string) (Tag, bool) {
+	var opts Tag
+	if tag == "" {
+		return opts, true
+	}
+	var version string
+	for _, opt := range strings.Split(tag, ",") {
+		key, val, _ := strings.Cut(strings.TrimSpace(opt), "=")
+		switch key {
+		case "bits":
+			n, err := strconv.Atoi(val)
+			if err != nil || n <= 0 {
+				return opts, false
+			}
+			opts.Bits = n
+		case "align":
+			n, err := strconv.Atoi(val)
+			if err != nil || n <= 0 || n&(n-1) != 0 {
+				return opts, false
+			}
+			opts.Align = n
+		case "if":
+			name, mask, ok := parseCondition(val)
+			if !ok || opts.Cond != nil {
+				return opts, false
+			}
+			opts.Cond = &Cond{On: name, Mask: mask}
+		case "since":
+			n, err := strconv.ParseUint(val, 0, 64)
+			if err != nil || opts.Cond != nil {
+				return opts, false
+			}
+			opts.Cond = &Cond{Since: n}
+		case "fixed":
+			n, err := strconv.Atoi(val)
+			if err != nil || n <= 0 {
+				return opts, false
+			}
+			opts.format().Fixed = n
+		case "cstring":
+			opts.format().CString = true
+		case "truncate":
+			opts.format().Truncate = true
+		case "utf16":
+			opts.format().UTF16 = true
+		case "ucs2":
+			opts.format().UTF16 = true
+			opts.format().UCS2 = true
+		case "version":
+			if val == "" || version != "" {
+				return opts, false
+			}
+			version = val
+		case "union", "len", "size":
+			if val == "" || opts.Ref != RefNone {
+				return opts, false
+			}
+			opts.Ref = refs[key]
+			opts.From = val
+		default:
+			return opts, false
+		}
+	}
+	if version != "" {
+		if opts.Cond == nil || opts.Cond.Mask != 0 {
+			return opts, false
+		}
+		opts.Cond.On = version
+	}
+	if opts.Cond != nil && (opts.Cond.On == "" || opts.Bits != 0) {
+		return opts, false
+	}
+	if f := opts.Str; f != nil {
+		switch {
+		case f.Fixed == 0 && !f.CString && !f.UTF16,
+			f.Fixed == 0 && f.Truncate,
+			f.Fixed%f.Unit() != 0,
+			opts.Bits != 0,
+			opts.Ref != RefNone && (f.Fixed != 0 || f.CString):
+			return opts, false
+		}
+	}
+	return opts, opts.Bits == 0 || opts.Ref == RefNone
+}
+
+// format returns the string format of opts, allocating it if needed.
+func (opts *Tag) format() *StringFormat {
+	if opts.Str == nil {
+		opts.Str = &StringFormat{}
+	}
+	return opts.Str
+}
+
+// parseCondition parses the if= option Name or Name&Mask.
+func parseCondition(val string) (name string, mask uint64, ok bool) {
+	name, m, hasMask := strings.Cut(val, "&")
+	if !hasMask {
+		return name, ^uint64(0), name != ""
+	}
+	mask, err := strconv.ParseUint(m, 0, 64)
+	return name, mask, err == nil && name != "" && mask != 0
+}
@@ -0,0 +1,89 @@
+package wire
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseTag(t *testing.T) {
+	for _, tt := range []struct {
+		tag  string
+		want Tag
+	}{
+		{"", Tag{}},
+		{"bits=3", Tag{Bits: 3}},
+		{" bits=12 ", Tag{Bits: 12}},
+		{"align=8", Tag{Align: 8}},
+		{"len=N", Tag{Ref: RefLen, From: "N"}},
+		{"union=Kind", Tag{Ref: RefTag, From: "Kind"}},
+		{"size=N", Tag{Ref: RefSize, From: "N"}},
+		{"if=Flags&0x4", Tag{Cond: &Cond{On: "Flags", Mask: 4}}},
+		{"if=Ok", Tag{Cond: &Cond{On: "Ok", Mask: ^uint64(0)}}},
+		{"since=2, version=V", Tag{Cond: &Cond{On: "V", Since: 2}}},
+		{"fixed=8,truncate", Tag{Str: &StringFormat{Fixed: 8, Truncate: true}}},
+		{"cstring", Tag{Str: &StringFormat{CString: true}}},
+		{"fixed=8,utf16,truncate", Tag{Str: &StringFormat{Fixed: 8, UTF16: true, Truncate: true}}},
+		{"ucs2,size=N", Tag{Ref: RefSize, From: "N", Str: &StringFormat{UTF16: true, UCS2: true}}},
+	} {
+		got, ok := ParseTag(tt.tag)
+		if !ok || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ParseTag(%q) = %+v, %v, want %+v", tt.tag, got, ok, tt.want)
+		}
+	}
+
+	for _, tag := range []string{
+		"bits=0", "bits=-1", "bits", "bits=x",
+		"align=3", "align=0",
+		"len=", "len=N,size=M", "bits=2,len=N", "bits=2,union=K",
+		"if=", "if=A&0", "since=1", "since=1,if=A", "version=V", "if=A,version=V", "if=A,bits=1",
+		"truncate", "fixed=4,bits=2", "fixed=4,len=N", "cstring,len=N",
+		"fixed=3,utf16", "utf16,bits=2",
+		"nope",
+	} {
+		if _, ok := ParseTag(tag); ok {
+			t.Errorf("ParseTag(%q) succeeded", tag)
+		}
+	}
+}
+
+func TestBits(t *testing.T) {
+	b := make([]byte, 3)
+	PutBitsLSB(b, 3, 9, 0x1a5)
+	if want := []byte{0x28, 0x0d, 0}; string(b) != string(want) {
+		t.Errorf("PutBitsLSB = %x, want %x", b, want)
+	}
+	if x := GetBitsLSB(b, 3, 9); x != 0x1a5 {
+		t.Errorf("GetBitsLSB = %#x, want 0x1a5", x)
+	}
+
+	b = make([]byte, 3)
+	PutBitsMSB(b, 3, 9, 0x1a5)
+	if want := []byte{0x1a, 0x50, 0}; string(b) != string(want) {
+		t.Errorf("PutBitsMSB = %x, want %x", b, want)
+	}
+	if x := GetBitsMSB(b, 3, 9); x != 0x1a5 {
+		t.Errorf("GetBitsMSB = %#x, want 0x1a5", x)
+	}
+}
+
+func TestBitRun(t *testing.T) {
+	// A run at offset 3 of its 8-byte unit: the 16-bit field does not
+	// straddle a 2-byte unit, so it starts at bit 32 of the unit.
+	run := NewBitRun(3)
+	if off := run.Add(4, 1); off != 0 {
+		t.Errorf("first field at bit %d, want 0", off)
+	}
+	if off := run.Add(16, 2); off != 8 {
+		t.Errorf("second field at bit %d, want 8", off)
+	}
+	if s := run.Size(); s != 3 {
+		t.Errorf("Size = %d, want 3", s)
+	}
+
+	// Without units, the fields are packed.
+	run = NewBitRun(3)
+	run.Add(4, 0)
+	if off := run.Add(16, 0); off != 4 || run.Size() != 3 {
+		t.Errorf("packed field at bit %d, Size %d, want 4 and 3", off, run.Size())
+	}
+}
@@ -0,0 +1,85 @@
+package litend
+
+import (
+	"bytes"
+	"testing"
+)
+
+type countQ struct {
+	NameLen uint8
+	Name    string `binary:"len=NameLen"`
+	Type    uint16
+}
+
+type countMsg struct {
+	ID      uint16
+	QDCount uint16
+	ANCount uint16
+	Qs      []countQ `binary:"len=QDCount"`
+	An      []uint32 `binary:"size=ANCount"`
+}
+
+type countOpts struct {
+	Ver  uint8 `binary:"bits=4"`
+	N    uint8 `binary:"bits=4"`
+	Size uint16
+	Vs   [][]byte `binary:"size=Size"`
+	Os   []uint16 `binary:"len=N"`
+}
+
+func TestCountFields(t *testing.T) {
+	m := countMsg{ID: 7, Qs: []countQ{{Name: "a.b", Type: 1}, {Name: "xyz", Type: 28}}, An: []uint32{5, 6}}
+	// Write sets the counts: QDCount to the length of Qs, ANCount to the size of An.
+	want := AppendUint16(AppendUint16(AppendUint16(nil, 7), 2), 8)
+	want = AppendUint16(append(want, 3, 'a', '.', 'b'), 1)
+	want = AppendUint16(append(want, 3, 'x', 'y', 'z'), 28)
+	want = AppendUint32(AppendUint32(want, 5), 6)
+	if n := Size(m); n != len(want) {
+		t.Errorf("Size = %d, want %d", n, len(want))
+	}
+	var buf bytes.Buffer
+	if err := Write(&buf, &m); err != nil || !bytes.Equal(buf.Bytes(), want) {
+		t.Fatalf("Write = %x, %v, want %x", buf.Bytes(), err, want)
+	}
+	var got countMsg
+	if err := Read(&buf, &got); err != nil || got.QDCount != 2 || got.ANCount != 8 || len(got.Qs) != 2 ||
+		got.Qs[1].Name != "xyz" || got.Qs[1].Type != 28 || len(got.An) != 2 || got.An[1] != 6 {
+		t.Errorf("Read = %+v, %v", got, err)
+	}
+
+	// A count set by the caller must match.
+	m.QDCount = 3
+	if err := Write(&buf, &m); err == nil {
+		t.Error("Write with a mismatched count succeeded")
+	}
+
+	// The size of An must be a multiple of its element size.
+	odd := AppendUint16(AppendUint16(AppendUint16(nil, 7), 0), 3)
+	if err := Read(bytes.NewReader(append(odd, 0, 0, 0)), &got); err == nil {
+		t.Error("Read of an odd size succeeded")
+	}
+
+	c := Codec{LenSize: 1}
+	o := countOpts{Ver: 1, Vs: [][]byte{{1, 2}, {3}}, Os: []uint16{9}}
+	want = AppendUint16([]byte{0x11}, 5)
+	want = AppendUint16(append(want, 2, 1, 2, 1, 3), 9)
+	b, err := c.Append(nil, o)
+	if err != nil || !bytes.Equal(b, want) || c.Size(o) != len(want) {
+		t.Fatalf("Append = %x, %v, want %x", b, err, want)
+	}
+	var oo countOpts
+	if n, err := c.Decode(b, &oo); err != nil || n != len(b) || oo.N != 1 || len(oo.Vs) != 2 || oo.Os[0] != 9 {
+		t.Errorf("Decode = %d, %+v, %v", n, oo, err)
+	}
+	PutUint16(b[1:], 4)
+	if _, err := c.Decode(b, &oo); err == nil {
+		t.Error("Decode of elements overrunning their size succeeded")
+	}
+	if _, err := Append(nil, countOpts{}); err == nil {
+		t.Error("Append of a variable size element without LenSize succeeded")
+	}
+	o.Os = make([]uint16, 16)
+	if _, err := c.Append(nil, o); err == nil {
+		t.Error("Append of a length overflowing its count field succeeded")
+	}
+}
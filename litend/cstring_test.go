@@ -0,0 +1,53 @@
+package litend
+
+import (
+	"bytes"
+	"io"
+	"testing"
+	"testing/iotest"
+)
+
+type cstrHdr struct {
+	Magic uint32
+	Name  string `binary:"fixed=8"`
+	Short string `binary:"fixed=4,cstring,truncate"`
+	Path  string `binary:"cstring"`
+	End   uint16
+}
+
+func TestStringFormats(t *testing.T) {
+	h := cstrHdr{Magic: 1, Name: "abcdefgh", Short: "héllo", Path: "/usr/bin", End: 0xffff}
+	want := append(AppendUint32(nil, 1), "abcdefgh"...)
+	want = append(want, "h\xc3\xa9\x00/usr/bin\x00"...) // truncated on a rune boundary
+	want = AppendUint16(want, 0xffff)
+	if n := Size(h); n != len(want) {
+		t.Errorf("Size = %d, want %d", n, len(want))
+	}
+	var buf bytes.Buffer
+	if err := Write(&buf, h); err != nil || !bytes.Equal(buf.Bytes(), want) {
+		t.Fatalf("Write = %x, %v, want %x", buf.Bytes(), err, want)
+	}
+	dec := h
+	dec.Short = "hé"
+	var got cstrHdr
+	if err := Read(iotest.OneByteReader(&buf), &got); err != nil || got != dec {
+		t.Errorf("Read = %q, %v", got, err)
+	}
+	got = cstrHdr{}
+	if n, err := Decode(want, &got); err != nil || n != len(want) || got != dec {
+		t.Errorf("Decode = %d, %q, %v", n, got, err)
+	}
+
+	for _, name := range []string{"abcdefghi", "a\x00b"} {
+		h.Name = name
+		if err := Write(&buf, h); err == nil {
+			t.Errorf("Write of Name %q succeeded", name)
+		}
+	}
+	if _, err := Decode(want[:20], &got); err != io.ErrUnexpectedEOF {
+		t.Errorf("Decode of an unterminated cstring = %v", err)
+	}
+	if _, err := (Codec{DecodeOptions: DecodeOptions{MaxLen: 3}}).Decode(want, &got); err == nil {
+		t.Error("Decode of a cstring longer than MaxLen succeeded")
+	}
+}
@@ -0,0 +1,250 @@
+package litend
+
+import (
+	"errors"
+	"math"
+	"reflect"
+
+	"github.com/go-perf/encoding/internal/wire"
+)
+
+// Accessor reads and writes a number, bool or bit field of type T in
+// place in an encoding, without decoding the rest of it.
+type Accessor[T any] struct {
+	off, size    int
+	bitOff, bits int // bit field position, if bits > 0
+	kind         reflect.Kind
+}
+
+// Field is like CodecField with the zero Codec.
+func Field[T any](t reflect.Type, path string) (Accessor[T], error) {
+	return CodecField[T](Codec{}, t, path)
+}
+
+// CodecField returns an Accessor of the field at path, as reported by
+// Layout, in the encodings by c of values of the fixed-size type t.
+// The field must be a number, bool or bit field of the kind of T, or
+// a U16, U32 or U64 field, accessed as an integer T of its size.
+func CodecField[T any](c Codec, t reflect.Type, path string) (Accessor[T], error) {
+	l := c.cachedLayout(t)
+	if l == nil {
+		return Accessor[T]{}, errors.New("binary.Field: invalid type " + t.String())
+	}
+	typ := reflect.TypeOf((*T)(nil)).Elem()
+	kind := typ.Kind()
+	for i, f := range l.fields {
+		if f.Path != path {
+			continue
+		}
+		ok := f.Kind == kind && kind != reflect.String
+		if f.Kind == reflect.Array {
+			ok = isWireType(l.types[i]) && isInteger(kind) && int(typ.Size()) == f.Size
+		}
+		if !ok {
+			return Accessor[T]{}, errors.New("binary.Field: field " + path + " of " + t.String() + " is not a " + kind.String())
+		}
+		return Accessor[T]{off: f.Offset, size: f.Size, bitOff: f.BitOffset, bits: f.Bits, kind: kind}, nil
+	}
+	return Accessor[T]{}, errors.New("binary.Field: no field " + path + " in " + t.String())
+}
+
+// isWireType reports whether t is U16, U32 or U64.
+func isWireType(t reflect.Type) bool {
+	switch t {
+	case reflect.TypeOf(U16{}), reflect.TypeOf(U32{}), reflect.TypeOf(U64{}):
+		return true
+	}
+	return false
+}
+
+// isInteger reports whether k is the kind of an integer type.
+func isInteger(k reflect.Kind) bool {
+	switch k {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return true
+	}
+	return false
+}
+
+// Get returns the value of the field in the encoding at the start of b.
+// It panics if b is too short.
+func (a Accessor[T]) Get(b []byte) T {
+	p := b[a.off : a.off+a.size]
+	var v T
+	if a.kind == reflect.Complex64 || a.kind == reflect.Complex128 {
+		h := a.size / 2
+		re, im := getUint(p[:h]), getUint(p[h:])
+		if h == 4 {
+			reflect.ValueOf(&v).Elem().SetComplex(complex(float64(math.Float32frombits(uint32(re))), float64(math.Float32frombits(uint32(im)))))
+		} else {
+			reflect.ValueOf(&v).Elem().SetComplex(complex(math.Float64frombits(re), math.Float64frombits(im)))
+		}
+		return v
+	}
+
+	var x uint64
+	width := 8 * a.size
+	if a.bits > 0 {
+		x, width = wire.GetBitsLSB(p, a.bitOff, a.bits), a.bits
+	} else {
+		x = getUint(p)
+	}
+	switch a.kind {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		shift := 64 - width
+		x = uint64(int64(x<<shift) >> shift)
+	}
+
+	switch p := any(&v).(type) {
+	case *bool:
+		*p = x != 0
+	case *int:
+		*p = int(x)
+	case *int8:
+		*p = int8(x)
+	case *int16:
+		*p = int16(x)
+	case *int32:
+		*p = int32(x)
+	case *int64:
+		*p = int64(x)
+	case *uint:
+		*p = uint(x)
+	case *uint8:
+		*p = uint8(x)
+	case *uint16:
+		*p = uint16(x)
+	case *uint32:
+		*p = uint32(x)
+	case *uint64:
+		*p = x
+	case *float32:
+		*p = math.Float32frombits(uint32(x))
+	case *float64:
+		*p = math.Float64frombits(x)
+	default:
+		rv := reflect.ValueOf(p).Elem()
+		switch a.kind {
+		case reflect.Bool:
+			rv.SetBool(x != 0)
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			rv.SetInt(int64(x))
+		case reflect.Float32:
+			rv.SetFloat(float64(math.Float32frombits(uint32(x))))
+		case reflect.Float64:
+			rv.SetFloat(math.Float64frombits(x))
+		default:
+			rv.SetUint(x)
+		}
+	}
+	return v
+}
+
+// Set sets the field in the encoding at the start of b to v, truncated
+// to the size of the field. It panics if b is too short.
+func (a Accessor[T]) Set(b []byte, v T) {
+	p := b[a.off : a.off+a.size]
+	if a.kind == reflect.Complex64 || a.kind == reflect.Complex128 {
+		c := reflect.ValueOf(&v).Elem().Complex()
+		h := a.size / 2
+		if h == 4 {
+			putUint(p[:h], uint64(math.Float32bits(float32(real(c)))))
+			putUint(p[h:], uint64(math.Float32bits(float32(imag(c)))))
+		} else {
+			putUint(p[:h], math.Float64bits(real(c)))
+			putUint(p[h:], math.Float64bits(imag(c)))
+		}
+		return
+	}
+
+	var x uint64
+	switch p := any(&v).(type) {
+	case *bool:
+		if *p {
+			x = 1
+		}
+	case *int:
+		x = uint64(*p)
+	case *int8:
+		x = uint64(*p)
+	case *int16:
+		x = uint64(*p)
+	case *int32:
+		x = uint64(*p)
+	case *int64:
+		x = uint64(*p)
+	case *uint:
+		x = uint64(*p)
+	case *uint8:
+		x = uint64(*p)
+	case *uint16:
+		x = uint64(*p)
+	case *uint32:
+		x = uint64(*p)
+	case *uint64:
+		x = *p
+	case *float32:
+		x = uint64(math.Float32bits(*p))
+	case *float64:
+		x = math.Float64bits(*p)
+	default:
+		rv := reflect.ValueOf(p).Elem()
+		switch a.kind {
+		case reflect.Bool:
+			if rv.Bool() {
+				x = 1
+			}
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			x = uint64(rv.Int())
+		case reflect.Float32:
+			x = uint64(math.Float32bits(float32(rv.Float())))
+		case reflect.Float64:
+			x = math.Float64bits(rv.Float())
+		default:
+			x = rv.Uint()
+		}
+	}
+
+	if a.bits == 0 {
+		putUint(p, x)
+		return
+	}
+	// wire.PutBitsLSB only sets bits, so the bits of the field are cleared
+	// first, with a mask of them laid out in the bit order of p.
+	p = p[a.bitOff/8:]
+	off := a.bitOff % 8
+	var mask [16]byte
+	wire.PutBitsLSB(mask[:], off, a.bits, math.MaxUint64)
+	for i := 0; i < (off+a.bits+7)/8; i++ {
+		p[i] &^= mask[i]
+	}
+	wire.PutBitsLSB(p, off, a.bits, x)
+}
+
+// getUint returns the unsigned integer of 1, 2, 4 or 8 bytes in b.
+func getUint(b []byte) uint64 {
+	switch len(b) {
+	case 1:
+		return uint64(b[0])
+	case 2:
+		return uint64(Uint16(b))
+	case 4:
+		return uint64(Uint32(b))
+	}
+	return Uint64(b)
+}
+
+// putUint stores x in the 1, 2, 4 or 8 bytes of b.
+func putUint(b []byte, x uint64) {
+	switch len(b) {
+	case 1:
+		b[0] = byte(x)
+	case 2:
+		PutUint16(b, uint16(x))
+	case 4:
+		PutUint32(b, uint32(x))
+	default:
+		PutUint64(b, x)
+	}
+}
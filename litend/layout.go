@@ -0,0 +1,292 @@
+package litend
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"reflect"
+	"strconv"
+	"sync"
+
+	"github.com/go-perf/encoding/internal/wire"
+)
+
+// FieldLayout is the position of a value in an encoding.
+type FieldLayout struct {
+	Path   string       // path of the value, such as Hdr.Seq or Array[2]
+	Offset int          // offset of the first byte
+	Size   int          // size in bytes
+	Kind   reflect.Kind // kind of the Go value
+	Order  string       // "little" if the value depends on the byte order, or ""
+
+	// BitOffset and Bits are the position and width of a bit field in
+	// the bits of its bytes, LSB-first. Bits is 0 for other values.
+	BitOffset, Bits int
+}
+
+func Layout(t reflect.Type) ([]FieldLayout, error) {
+	return Codec{}.Layout(t)
+}
+
+// Layout returns the positions of the numbers, bools, strings, byte
+// arrays and bit fields in the encoding of the fixed-size type t, in
+// encoding order. Blank (_) fields and padding are left out.
+func (c Codec) Layout(t reflect.Type) ([]FieldLayout, error) {
+	l := c.cachedLayout(t)
+	if l == nil {
+		return nil, errors.New("binary.Layout: invalid type " + t.String())
+	}
+	return append([]FieldLayout(nil), l.fields...), nil
+}
+
+var layouts [numLayouts]sync.Map // map[reflect.Type]*layouter
+
+// cachedLayout returns the layout of t, or nil if t has no fixed size.
+func (c Codec) cachedLayout(t reflect.Type) *layouter {
+	m := &layouts[c.layout()]
+	if l, ok := m.Load(t); ok {
+		return l.(*layouter)
+	}
+	var l *layouter
+	if c.sizeof(t) >= 0 {
+		l = &layouter{c: c, fields: []FieldLayout{}}
+		l.value(t, reflect.Value{}, "", 0)
+	}
+	v, _ := m.LoadOrStore(t, l)
+	return v.(*layouter)
+}
+
+// layouter lists the values of an encoding.
+type layouter struct {
+	c      Codec
+	fields []FieldLayout
+	types  []reflect.Type  // types of the fields
+	values []reflect.Value // values of the fields, when laid out from a value
+}
+
+// add appends the field f of type t with the value v, which is invalid
+// when only a type is laid out.
+func (l *layouter) add(f FieldLayout, t reflect.Type, v reflect.Value) {
+	l.fields = append(l.fields, f)
+	l.types = append(l.types, t)
+	if v.IsValid() {
+		l.values = append(l.values, v)
+	}
+}
+
+// order returns the Order of a value encoded in units of size bytes.
+func order(size int) string {
+	if size > 1 {
+		return "little"
+	}
+	return ""
+}
+
+// value lays out a value of type t at offset off and returns the offset
+// after it. v is the value, or invalid if t has a fixed size and only
+// the type is laid out.
+func (l *layouter) value(t reflect.Type, v reflect.Value, path string, off int) int {
+	switch t.Kind() {
+	case reflect.Pointer:
+		if v.IsValid() {
+			if v.IsNil() {
+				v = reflect.Zero(t.Elem())
+			} else {
+				v = v.Elem()
+			}
+		}
+		return l.value(t.Elem(), v, path, off)
+
+	case reflect.Array:
+		if t.Elem() == byteType {
+			// Byte arrays, such as U32, are laid out whole.
+			l.add(FieldLayout{Path: path, Offset: off, Size: t.Len(), Kind: reflect.Array}, t, v)
+			return off + t.Len()
+		}
+		for i := 0; i < t.Len(); i++ {
+			var ev reflect.Value
+			if v.IsValid() {
+				ev = v.Index(i)
+			}
+			off = l.value(t.Elem(), ev, path+"["+strconv.Itoa(i)+"]", off)
+		}
+		return off
+
+	case reflect.Struct:
+		return l.structValue(t, v, path, off)
+
+	case reflect.Slice, reflect.Map, reflect.String:
+		// Values of variable size are laid out whole.
+		size := l.c.valueSize(v)
+		l.add(FieldLayout{Path: path, Offset: off, Size: size, Kind: t.Kind(), Order: order(l.c.LenSize)}, t, v)
+		return off + size
+	}
+
+	size := l.c.sizeof(t)
+	unit := size
+	if t.Kind() == reflect.Complex64 || t.Kind() == reflect.Complex128 {
+		unit /= 2
+	}
+	l.add(FieldLayout{Path: path, Offset: off, Size: size, Kind: t.Kind(), Order: order(unit)}, t, v)
+	return off + size
+}
+
+func (l *layouter) structValue(t reflect.Type, v reflect.Value, path string, off int) int {
+	if path != "" {
+		path += "."
+	}
+	si := l.c.cachedStruct(t)
+	start := off
+	for i := range si.fields {
+		f := &si.fields[i]
+		if f.cond != nil && !f.cond.present(v) {
+			continue
+		}
+		off = start + wire.AlignUp(off-start, f.align)
+		var fv reflect.Value
+		if v.IsValid() && f.bits == nil {
+			fv = v.Field(f.index)
+		}
+		switch {
+		case f.bits != nil:
+			for _, bf := range f.bits {
+				if bf.skip {
+					continue
+				}
+				var bv reflect.Value
+				if v.IsValid() {
+					bv = v.Field(bf.index)
+				}
+				sf := t.Field(bf.index)
+				l.add(FieldLayout{Path: path + sf.Name, Offset: off, Size: f.size, Kind: sf.Type.Kind(), Order: "little",
+					BitOffset: bf.off, Bits: bf.width}, sf.Type, bv)
+			}
+			off += f.size
+		case f.skip:
+			off += f.size
+		case f.str != nil:
+			size := f.size
+			if size == variable {
+				size = l.c.fieldSize(v, f)
+			}
+			l.add(FieldLayout{Path: path + t.Field(f.index).Name, Offset: off, Size: size, Kind: reflect.String,
+				Order: order(f.str.Unit())}, f.typ, fv)
+			off += size
+		case f.ref == wire.RefTag:
+			off = l.value(fv.Elem().Type(), fv.Elem(), path+t.Field(f.index).Name, off)
+		case f.ref != wire.RefNone:
+			size := l.c.fieldSize(v, f)
+			l.add(FieldLayout{Path: path + t.Field(f.index).Name, Offset: off, Size: size, Kind: f.typ.Kind()}, f.typ, fv)
+			off += size
+		default:
+			off = l.value(f.typ, fv, path+t.Field(f.index).Name, off)
+		}
+	}
+	return start + wire.AlignUp(off-start, si.align)
+}
+
+func Dump(w io.Writer, data any) error {
+	return Codec{}.Dump(w, data)
+}
+
+// Dump writes a hex dump of the encoding of data, as Write encodes it,
+// to w. Each value is annotated with its path and value; slices, maps,
+// strings and byte arrays are shown whole.
+func (c Codec) Dump(w io.Writer, data any) error {
+	b, err := c.Append(nil, data)
+	if err != nil {
+		return err
+	}
+	data, _ = c.zeroNil(data)
+	v := reflect.Indirect(reflect.ValueOf(data))
+	l := &layouter{c: c}
+	if v.Kind() == reflect.Slice {
+		// The length of a top-level slice is not encoded.
+		off := 0
+		for i := 0; i < v.Len(); i++ {
+			off = l.value(v.Type().Elem(), v.Index(i), "["+strconv.Itoa(i)+"]", off)
+		}
+	} else {
+		l.value(v.Type(), v, "", 0)
+	}
+
+	bw := bufio.NewWriter(w)
+	end := 0
+	for i, f := range l.fields {
+		if f.Offset > end {
+			dumpBytes(bw, b, end, f.Offset, "padding")
+		}
+		note := formatValue(l.values[i])
+		if f.Path != "" {
+			note = f.Path + " = " + note
+		}
+		if f.Bits > 0 {
+			note += " (bits " + strconv.Itoa(f.BitOffset) + ".." + strconv.Itoa(f.BitOffset+f.Bits-1) + ")"
+		}
+		if i > 0 && f.Bits > 0 && l.fields[i-1].Bits > 0 && f.Offset == l.fields[i-1].Offset {
+			// The bit fields of a run share their bytes.
+			dumpBytes(bw, nil, f.Offset, f.Offset, note)
+		} else {
+			dumpBytes(bw, b, f.Offset, f.Offset+f.Size, note)
+		}
+		if f.Offset+f.Size > end {
+			end = f.Offset + f.Size
+		}
+	}
+	if end < len(b) {
+		dumpBytes(bw, b, end, len(b), "padding")
+	}
+	return bw.Flush()
+}
+
+// dumpBytes writes the bytes of b from start to end, 16 to a line, with
+// the note on the first line. If start is end, it writes the note alone.
+func dumpBytes(w *bufio.Writer, b []byte, start, end int, note string) {
+	const hex = "0123456789abcdef"
+	off := start
+	for {
+		line := make([]byte, 0, 80)
+		line = append(line, hex[off>>28&15], hex[off>>24&15], hex[off>>20&15], hex[off>>16&15],
+			hex[off>>12&15], hex[off>>8&15], hex[off>>4&15], hex[off&15], ' ')
+		n := end - off
+		if n > 16 {
+			n = 16
+		}
+		for i := 0; i < 16; i++ {
+			if i < n {
+				c := b[off+i]
+				line = append(line, ' ', hex[c>>4], hex[c&15])
+			} else if note != "" {
+				line = append(line, "   "...)
+			}
+		}
+		if note != "" {
+			line = append(line, "  "...)
+			line = append(line, note...)
+			note = ""
+		}
+		w.Write(append(line, '\n'))
+		if off += n; off >= end {
+			return
+		}
+	}
+}
+
+// formatValue returns the value v as text.
+func formatValue(v reflect.Value) string {
+	switch v.Kind() {
+	case reflect.Bool:
+		return strconv.FormatBool(v.Bool())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(v.Int(), 10)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return strconv.FormatUint(v.Uint(), 10)
+	case reflect.Float32, reflect.Float64:
+		return strconv.FormatFloat(v.Float(), 'g', -1, v.Type().Bits())
+	case reflect.Complex64, reflect.Complex128:
+		return strconv.FormatComplex(v.Complex(), 'g', -1, v.Type().Bits())
+	case reflect.String:
+		return strconv.Quote(v.String())
+	}
+	return v.Type().String() + " of length " + strconv.Itoa(v.Len())
+}
@@ -5,7 +5,9 @@ import (
 	"io"
 	"math"
 	"reflect"
-	"sync"
+	"unsafe"
+
+	"github.com/go-perf/encoding/internal/wire"
 )
 
 func Uint16(b []byte) uint16 {
@@ -80,276 +82,571 @@ func AppendUint64(b []byte, v uint64) []byte {
 }
 
 func Read(r io.Reader, data any) error {
+	return Codec{}.Read(r, data)
+}
+
+// Read reads structured binary data from r into data.
+func (c Codec) Read(r io.Reader, data any) error {
 	// Fast path for basic types and slices.
 	if n := intSizeOf(data); n != 0 {
-		bs := make([]byte, n)
-		if _, err := io.ReadFull(r, bs); err != nil {
+		if c.MaxBytes > 0 && n > c.MaxBytes {
+			return &LimitError{Limit: "MaxBytes"}
+		}
+		if ok, err := c.readFast(r, data, n); ok {
 			return err
 		}
-		switch data := data.(type) {
-		case *bool:
-			*data = bs[0] != 0
-		case *int8:
-			*data = int8(bs[0])
-		case *uint8:
-			*data = bs[0]
-		case *int16:
-			*data = int16(Uint16(bs))
-		case *uint16:
-			*data = Uint16(bs)
-		case *int32:
-			*data = int32(Uint32(bs))
-		case *uint32:
-			*data = Uint32(bs)
-		case *int64:
-			*data = int64(Uint64(bs))
-		case *uint64:
-			*data = Uint64(bs)
-		case *float32:
-			*data = math.Float32frombits(Uint32(bs))
-		case *float64:
-			*data = math.Float64frombits(Uint64(bs))
-		case []bool:
-			for i, x := range bs { // Easier to loop over the input for 8-bit values.
-				data[i] = x != 0
-			}
-		case []int8:
-			for i, x := range bs {
-				data[i] = int8(x)
-			}
-		case []uint8:
-			copy(data, bs)
-		case []int16:
-			for i := range data {
-				data[i] = int16(Uint16(bs[2*i:]))
-			}
-		case []uint16:
-			for i := range data {
-				data[i] = Uint16(bs[2*i:])
-			}
-		case []int32:
-			for i := range data {
-				data[i] = int32(Uint32(bs[4*i:]))
-			}
-		case []uint32:
-			for i := range data {
-				data[i] = Uint32(bs[4*i:])
-			}
-		case []int64:
-			for i := range data {
-				data[i] = int64(Uint64(bs[8*i:]))
-			}
-		case []uint64:
-			for i := range data {
-				data[i] = Uint64(bs[8*i:])
-			}
-		case []float32:
-			for i := range data {
-				data[i] = math.Float32frombits(Uint32(bs[4*i:]))
-			}
-		case []float64:
-			for i := range data {
-				data[i] = math.Float64frombits(Uint64(bs[8*i:]))
+	}
+
+	// Fallback to reflect-based decoding.
+	if isNil(data) {
+		return nilPointer(reflect.TypeOf(data))
+	}
+	v, size := c.decodeValue(data)
+	if size == -1 {
+		return errors.New("binary.Read: invalid type " + reflect.TypeOf(data).String())
+	}
+	bp := chunkPool.Get().(*[]byte)
+	defer chunkPool.Put(bp)
+	d := &decoder{c: c, r: r, buf: (*bp)[:0]}
+	d.expect(size)
+	return d.top(v)
+}
+
+// readFast reads data of the types accepted by intSizeOf.
+// Values up to smallSize bytes are read without taking a chunk buffer;
+// slices larger than a chunk are read one chunk at a time.
+func (c Codec) readFast(r io.Reader, data any, n int) (bool, error) {
+	if bs, ok := data.([]uint8); ok {
+		m, err := io.ReadFull(r, bs)
+		return true, partial(err, m)
+	}
+
+	if n <= smallSize {
+		var small [smallSize]byte
+		bs := small[:n]
+		if _, err := io.ReadFull(r, bs); err != nil {
+			return true, err
+		}
+		return c.decodeFast(bs, data)
+	}
+
+	bp := chunkPool.Get().(*[]byte)
+	defer chunkPool.Put(bp)
+	if n <= chunkSize {
+		bs := (*bp)[:n]
+		if _, err := io.ReadFull(r, bs); err != nil {
+			return true, err
+		}
+		return c.decodeFast(bs, data)
+	}
+
+	v := reflect.ValueOf(data)
+	l := v.Len()
+	size := n / l
+	for i := 0; i < l; i += chunkSize / size {
+		j := i + chunkSize/size
+		if j > l {
+			j = l
+		}
+		bs := (*bp)[:(j-i)*size]
+		m, err := io.ReadFull(r, bs)
+		if err != nil {
+			if err == io.EOF && i > 0 {
+				err = io.ErrUnexpectedEOF
 			}
-		default:
-			n = 0 // fast path doesn't apply
+			// The whole elements read are decoded before failing.
+			j = i + m/size
+			bs = bs[:(j-i)*size]
 		}
-		if n != 0 {
-			return nil
+		if _, serr := c.decodeFast(bs, v.Slice(i, j).Interface()); serr != nil {
+			se := serr.(*StrictError)
+			se.Offset += i * size
+			return true, partial(se, se.Offset/size)
+		}
+		if err != nil {
+			return true, partial(err, j)
+		}
+	}
+	return true, nil
+}
+
+func Decode(b []byte, data any) (int, error) {
+	return Codec{}.Decode(b, data)
+}
+
+// Decode decodes data from the start of b and returns the number of bytes consumed.
+func (c Codec) Decode(b []byte, data any) (int, error) {
+	// Fast path for basic types and slices.
+	if n := intSizeOf(data); n != 0 {
+		if c.MaxBytes > 0 && n > c.MaxBytes {
+			return 0, &LimitError{Limit: "MaxBytes"}
+		}
+		if len(b) < n {
+			return 0, io.ErrUnexpectedEOF
+		}
+		if ok, err := c.decodeFast(b[:n], data); ok {
+			return n, err
 		}
 	}
 
 	// Fallback to reflect-based decoding.
+	if isNil(data) {
+		return 0, nilPointer(reflect.TypeOf(data))
+	}
+	v, size := c.decodeValue(data)
+	if size == -1 {
+		return 0, errors.New("binary.Decode: invalid type " + reflect.TypeOf(data).String())
+	}
+	if len(b) < size {
+		return 0, io.ErrUnexpectedEOF
+	}
+	if c.MaxBytes > 0 && len(b) > c.MaxBytes {
+		b = b[:c.MaxBytes]
+	}
+	d := &decoder{c: c, buf: b}
+	if err := d.top(v); err != nil {
+		return 0, err
+	}
+	return d.offset, nil
+}
+
+// decodeValue returns the value to decode into for data and the size of
+// its type, as returned by typeSize.
+func (c Codec) decodeValue(data any) (reflect.Value, int) {
 	v := reflect.ValueOf(data)
-	size := -1
-	switch v.Kind() {
-	case reflect.Pointer:
+	if v.Kind() == reflect.Pointer {
 		v = v.Elem()
-		size = SizeOf(v)
-	case reflect.Slice:
-		size = SizeOf(v)
+	} else if v.Kind() != reflect.Slice {
+		return v, -1
 	}
-	if size < 0 {
-		return errors.New("binary.Read: invalid type " + reflect.TypeOf(data).String())
+	return v, c.typeSize(v)
+}
+
+// decodeFast decodes bs into data for the types accepted by intSizeOf.
+// It reports false if data is not one of those types.
+func (c Codec) decodeFast(bs []byte, data any) (bool, error) {
+	switch data := data.(type) {
+	case *bool:
+		if c.Strict && bs[0] > 1 {
+			return true, invalidBool(0, bs[0])
+		}
+		*data = bs[0] != 0
+	case *int8:
+		*data = int8(bs[0])
+	case *uint8:
+		*data = bs[0]
+	case *int16:
+		*data = int16(Uint16(bs))
+	case *uint16:
+		*data = Uint16(bs)
+	case *int32:
+		*data = int32(Uint32(bs))
+	case *uint32:
+		*data = Uint32(bs)
+	case *int64:
+		*data = int64(Uint64(bs))
+	case *uint64:
+		*data = Uint64(bs)
+	case *float32:
+		*data = math.Float32frombits(Uint32(bs))
+	case *float64:
+		*data = math.Float64frombits(Uint64(bs))
+	case []bool:
+		for i, x := range bs { // Easier to loop over the input for 8-bit values.
+			if c.Strict && x > 1 {
+				return true, invalidBool(i, x)
+			}
+			data[i] = x != 0
+		}
+	case []int8:
+		for i, x := range bs {
+			data[i] = int8(x)
+		}
+	case []uint8:
+		copy(data, bs)
+	case []int16:
+		for i := range data {
+			data[i] = int16(Uint16(bs[2*i:]))
+		}
+	case []uint16:
+		for i := range data {
+			data[i] = Uint16(bs[2*i:])
+		}
+	case []int32:
+		for i := range data {
+			data[i] = int32(Uint32(bs[4*i:]))
+		}
+	case []uint32:
+		for i := range data {
+			data[i] = Uint32(bs[4*i:])
+		}
+	case []int64:
+		for i := range data {
+			data[i] = int64(Uint64(bs[8*i:]))
+		}
+	case []uint64:
+		for i := range data {
+			data[i] = Uint64(bs[8*i:])
+		}
+	case []float32:
+		for i := range data {
+			data[i] = math.Float32frombits(Uint32(bs[4*i:]))
+		}
+	case []float64:
+		for i := range data {
+			data[i] = math.Float64frombits(Uint64(bs[8*i:]))
+		}
+	default:
+		return false, nil
 	}
-	d := &decoder{buf: make([]byte, size)}
-	if _, err := io.ReadFull(r, d.buf); err != nil {
+	return true, nil
+}
+
+func Write(w io.Writer, data any) error {
+	return Codec{}.Write(w, data)
+}
+
+// Write writes the binary representation of data into w.
+// Pointers are encoded as the value they point to.
+func (c Codec) Write(w io.Writer, data any) error {
+	// Fast path for basic types and slices.
+	if n := intSizeOf(data); n != 0 {
+		return writeFast(w, data, n)
+	}
+
+	// Fallback to reflect-based encoding.
+	data, err := c.zeroNil(data)
+	if err != nil {
+		return err
+	}
+	v := reflect.Indirect(reflect.ValueOf(data))
+	if c.typeSize(v) == -1 {
+		return errors.New("binary.Write: some values are not fixed-sized in type " + reflect.TypeOf(data).String())
+	}
+	bp := chunkPool.Get().(*[]byte)
+	defer chunkPool.Put(bp)
+	e := &encoder{c: c, w: w, buf: (*bp)[:0]}
+	return e.top(v)
+}
+
+// writeFast writes data of the types accepted by intSizeOf.
+// Values up to smallSize bytes are written without taking a chunk buffer;
+// slices larger than a chunk are written one chunk at a time.
+func writeFast(w io.Writer, data any, n int) error {
+	if bs, ok := data.([]uint8); ok {
+		m, err := w.Write(bs)
+		return partial(err, m)
+	}
+
+	if n <= smallSize {
+		var small [smallSize]byte
+		bs := small[:n]
+		encodeFast(bs, data)
+		_, err := w.Write(bs)
+		return err
+	}
+
+	bp := chunkPool.Get().(*[]byte)
+	defer chunkPool.Put(bp)
+	if n <= chunkSize {
+		bs := (*bp)[:n]
+		encodeFast(bs, data)
+		_, err := w.Write(bs)
 		return err
 	}
-	d.value(v)
+
+	v := reflect.ValueOf(data)
+	l := v.Len()
+	size := n / l
+	for i := 0; i < l; i += chunkSize / size {
+		j := i + chunkSize/size
+		if j > l {
+			j = l
+		}
+		bs := (*bp)[:(j-i)*size]
+		encodeFast(bs, v.Slice(i, j).Interface())
+		if m, err := w.Write(bs); err != nil {
+			return partial(err, i+m/size)
+		}
+	}
 	return nil
 }
 
-func Write(w io.Writer, data any) error {
+func Append(b []byte, data any) ([]byte, error) {
+	return Codec{}.Append(b, data)
+}
+
+// Append appends the binary representation of data to b.
+func (c Codec) Append(b []byte, data any) ([]byte, error) {
 	// Fast path for basic types and slices.
 	if n := intSizeOf(data); n != 0 {
-		bs := make([]byte, n)
-		switch v := data.(type) {
-		case *bool:
-			if *v {
-				bs[0] = 1
-			} else {
-				bs[0] = 0
-			}
-		case bool:
-			if v {
-				bs[0] = 1
+		b, bs := grow(b, n)
+		encodeFast(bs, data)
+		return b, nil
+	}
+
+	// Fallback to reflect-based encoding.
+	data, err := c.zeroNil(data)
+	if err != nil {
+		return b, err
+	}
+	v := reflect.Indirect(reflect.ValueOf(data))
+	if c.typeSize(v) == -1 {
+		return b, errors.New("binary.Append: some values are not fixed-sized in type " + reflect.TypeOf(data).String())
+	}
+	e := &encoder{c: c, buf: b}
+	if err := e.top(v); err != nil {
+		return b, err
+	}
+	return e.buf, nil
+}
+
+// encodeFast encodes data into bs for the types accepted by intSizeOf.
+func encodeFast(bs []byte, data any) {
+	switch v := data.(type) {
+	case *bool:
+		if *v {
+			bs[0] = 1
+		} else {
+			bs[0] = 0
+		}
+	case bool:
+		if v {
+			bs[0] = 1
+		} else {
+			bs[0] = 0
+		}
+	case []bool:
+		for i, x := range v {
+			if x {
+				bs[i] = 1
 			} else {
-				bs[0] = 0
-			}
-		case []bool:
-			for i, x := range v {
-				if x {
-					bs[i] = 1
-				} else {
-					bs[i] = 0
-				}
-			}
-		case *int8:
-			bs[0] = byte(*v)
-		case int8:
-			bs[0] = byte(v)
-		case []int8:
-			for i, x := range v {
-				bs[i] = byte(x)
-			}
-		case *uint8:
-			bs[0] = *v
-		case uint8:
-			bs[0] = v
-		case []uint8:
-			bs = v
-		case *int16:
-			PutUint16(bs, uint16(*v))
-		case int16:
-			PutUint16(bs, uint16(v))
-		case []int16:
-			for i, x := range v {
-				PutUint16(bs[2*i:], uint16(x))
-			}
-		case *uint16:
-			PutUint16(bs, *v)
-		case uint16:
-			PutUint16(bs, v)
-		case []uint16:
-			for i, x := range v {
-				PutUint16(bs[2*i:], x)
-			}
-		case *int32:
-			PutUint32(bs, uint32(*v))
-		case int32:
-			PutUint32(bs, uint32(v))
-		case []int32:
-			for i, x := range v {
-				PutUint32(bs[4*i:], uint32(x))
-			}
-		case *uint32:
-			PutUint32(bs, *v)
-		case uint32:
-			PutUint32(bs, v)
-		case []uint32:
-			for i, x := range v {
-				PutUint32(bs[4*i:], x)
-			}
-		case *int64:
-			PutUint64(bs, uint64(*v))
-		case int64:
-			PutUint64(bs, uint64(v))
-		case []int64:
-			for i, x := range v {
-				PutUint64(bs[8*i:], uint64(x))
-			}
-		case *uint64:
-			PutUint64(bs, *v)
-		case uint64:
-			PutUint64(bs, v)
-		case []uint64:
-			for i, x := range v {
-				PutUint64(bs[8*i:], x)
-			}
-		case *float32:
-			PutUint32(bs, math.Float32bits(*v))
-		case float32:
-			PutUint32(bs, math.Float32bits(v))
-		case []float32:
-			for i, x := range v {
-				PutUint32(bs[4*i:], math.Float32bits(x))
-			}
-		case *float64:
-			PutUint64(bs, math.Float64bits(*v))
-		case float64:
-			PutUint64(bs, math.Float64bits(v))
-		case []float64:
-			for i, x := range v {
-				PutUint64(bs[8*i:], math.Float64bits(x))
+				bs[i] = 0
 			}
 		}
-		_, err := w.Write(bs)
-		return err
+	case *int8:
+		bs[0] = byte(*v)
+	case int8:
+		bs[0] = byte(v)
+	case []int8:
+		for i, x := range v {
+			bs[i] = byte(x)
+		}
+	case *uint8:
+		bs[0] = *v
+	case uint8:
+		bs[0] = v
+	case []uint8:
+		copy(bs, v)
+	case *int16:
+		PutUint16(bs, uint16(*v))
+	case int16:
+		PutUint16(bs, uint16(v))
+	case []int16:
+		for i, x := range v {
+			PutUint16(bs[2*i:], uint16(x))
+		}
+	case *uint16:
+		PutUint16(bs, *v)
+	case uint16:
+		PutUint16(bs, v)
+	case []uint16:
+		for i, x := range v {
+			PutUint16(bs[2*i:], x)
+		}
+	case *int32:
+		PutUint32(bs, uint32(*v))
+	case int32:
+		PutUint32(bs, uint32(v))
+	case []int32:
+		for i, x := range v {
+			PutUint32(bs[4*i:], uint32(x))
+		}
+	case *uint32:
+		PutUint32(bs, *v)
+	case uint32:
+		PutUint32(bs, v)
+	case []uint32:
+		for i, x := range v {
+			PutUint32(bs[4*i:], x)
+		}
+	case *int64:
+		PutUint64(bs, uint64(*v))
+	case int64:
+		PutUint64(bs, uint64(v))
+	case []int64:
+		for i, x := range v {
+			PutUint64(bs[8*i:], uint64(x))
+		}
+	case *uint64:
+		PutUint64(bs, *v)
+	case uint64:
+		PutUint64(bs, v)
+	case []uint64:
+		for i, x := range v {
+			PutUint64(bs[8*i:], x)
+		}
+	case *float32:
+		PutUint32(bs, math.Float32bits(*v))
+	case float32:
+		PutUint32(bs, math.Float32bits(v))
+	case []float32:
+		for i, x := range v {
+			PutUint32(bs[4*i:], math.Float32bits(x))
+		}
+	case *float64:
+		PutUint64(bs, math.Float64bits(*v))
+	case float64:
+		PutUint64(bs, math.Float64bits(v))
+	case []float64:
+		for i, x := range v {
+			PutUint64(bs[8*i:], math.Float64bits(x))
+		}
 	}
+}
 
-	// Fallback to reflect-based encoding.
-	v := reflect.Indirect(reflect.ValueOf(data))
-	size := SizeOf(v)
-	if size < 0 {
-		return errors.New("binary.Write: some values are not fixed-sized in type " + reflect.TypeOf(data).String())
+// isNil reports whether data is a nil pointer.
+func isNil(data any) bool {
+	v := reflect.ValueOf(data)
+	return v.Kind() == reflect.Pointer && v.IsNil()
+}
+
+// zeroNil returns data, or the zero value it points to if data is a nil
+// pointer and c.NilAsZero is set. Other nil pointers are an error.
+func (c Codec) zeroNil(data any) (any, error) {
+	if !isNil(data) {
+		return data, nil
 	}
-	buf := make([]byte, size)
-	e := &encoder{buf: buf}
-	e.value(v)
-	_, err := w.Write(buf)
-	return err
+	t := reflect.TypeOf(data)
+	if !c.NilAsZero {
+		return nil, nilPointer(t)
+	}
+	return reflect.Zero(t.Elem()).Interface(), nil
+}
+
+// grow extends b by n bytes. It returns the extended slice and its last n bytes.
+func grow(b []byte, n int) ([]byte, []byte) {
+	l := len(b)
+	if cap(b)-l < n {
+		nb := make([]byte, l, 2*cap(b)+n)
+		copy(nb, b)
+		b = nb
+	}
+	b = b[:l+n]
+	return b, b[l:]
 }
 
 func Size(v any) int {
-	return SizeOf(reflect.Indirect(reflect.ValueOf(v)))
+	return Codec{}.Size(v)
 }
 
-var structSize sync.Map // map[reflect.Type]int
+// Size returns how many bytes Write would generate to encode the value v.
+func (c Codec) Size(v any) int {
+	v, err := c.zeroNil(v)
+	if err != nil {
+		return -1
+	}
+	return c.sizeOf(reflect.Indirect(reflect.ValueOf(v)))
+}
 
 func SizeOf(v reflect.Value) int {
+	return Codec{}.sizeOf(v)
+}
+
+func (c Codec) sizeOf(v reflect.Value) int {
 	switch v.Kind() {
 	case reflect.Slice:
-		if s := sizeof(v.Type().Elem()); s >= 0 {
-			return s * v.Len()
+		// The length of a top-level slice is not encoded.
+		return c.elemsSize(v)
+
+	default:
+		if v.IsValid() {
+			return c.valueSize(v)
 		}
+	}
 
-	case reflect.Struct:
-		t := v.Type()
-		if size, ok := structSize.Load(t); ok {
-			return size.(int)
+	return -1
+}
+
+// typeSize is like sizeOf but it returns variable rather than computing
+// the size of values whose size is not determined by their type.
+func (c Codec) typeSize(v reflect.Value) int {
+	switch v.Kind() {
+	case reflect.Slice:
+		s := c.sizeof(v.Type().Elem())
+		if s >= 0 {
+			s *= v.Len()
 		}
-		size := sizeof(t)
-		structSize.Store(t, size)
-		return size
+		return s
 
 	default:
 		if v.IsValid() {
-			return sizeof(v.Type())
+			return c.sizeof(v.Type())
 		}
 	}
 
 	return -1
 }
 
-// sizeof returns the size >= 0 of variables for the given type or -1 if the type is not acceptable.
-func sizeof(t reflect.Type) int {
+// sizeof returns the size >= 0 of variables for the given type, variable
+// if the size depends on the value, or -1 if the type is not acceptable.
+func (c Codec) sizeof(t reflect.Type) int {
+	p := planner{c: c}
+	return p.sizeof(t)
+}
+
+// canEncodeElems reports whether the elements of the slice or map type t,
+// and the keys of a map, can be encoded. They may contain the structs
+// being planned, since the length of t ends the recursion.
+func (p *planner) canEncodeElems(t reflect.Type) bool {
+	cut := p.cut
+	p.cut = len(p.stack)
+	ok := p.sizeof(t.Elem()) != -1 && (t.Kind() != reflect.Map || p.sizeof(t.Key()) != -1)
+	p.cut = cut
+	return ok
+}
+
+// maxPointerChain bounds the pointers to pointers followed by sizeof,
+// which also rejects pointer types that point to themselves.
+const maxPointerChain = 16
+
+func (p *planner) sizeof(t reflect.Type) int {
 	switch t.Kind() {
 	case reflect.Array:
-		if s := sizeof(t.Elem()); s >= 0 {
+		if s := p.sizeof(t.Elem()); s >= 0 {
 			return s * t.Len()
+		} else if s == variable {
+			return variable
+		}
+
+	case reflect.Slice, reflect.Map:
+		if p.c.hasLen() && p.canEncodeElems(t) {
+			return variable
+		}
+
+	case reflect.String:
+		if p.c.hasLen() {
+			return variable
 		}
 
 	case reflect.Struct:
-		sum := 0
-		for i, n := 0, t.NumField(); i < n; i++ {
-			s := sizeof(t.Field(i).Type)
-			if s < 0 {
+		return p.structInfo(t).size
+
+	case reflect.Pointer:
+		// Pointers are encoded as the value they point to.
+		e := t.Elem()
+		for n := 1; e.Kind() == reflect.Pointer; n++ {
+			if n == maxPointerChain {
 				return -1
 			}
-			sum += s
+			e = e.Elem()
+		}
+		return p.sizeof(e)
+
+	case reflect.Int, reflect.Uint:
+		if p.c.IntSize == 4 || p.c.IntSize == 8 {
+			return p.c.IntSize
 		}
-		return sum
 
 	case reflect.Bool,
 		reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
@@ -361,9 +658,19 @@ func sizeof(t reflect.Type) int {
 	return -1
 }
 
+var byteType = reflect.TypeOf(byte(0))
+
 type coder struct {
+	c      Codec
 	buf    []byte
-	offset int
+	offset int // decoder only: read position in buf
+	base   int // stream position of buf[0]
+	depth  int // decoder only: nesting depth of the current value
+	err    error
+
+	r     io.Reader // decoder only
+	ahead int       // decoder only: bytes known to be still needed from r
+	w     io.Writer // encoder only; nil to append to buf
 }
 
 type (
@@ -372,63 +679,36 @@ type (
 )
 
 func (d *decoder) bool() bool {
-	x := d.buf[d.offset]
-	d.offset++
+	x := d.uint8()
+	if d.c.Strict && x > 1 {
+		d.fail(invalidBool(d.pos()-1, x))
+	}
 	return x != 0
 }
 
 func (e *encoder) bool(x bool) {
 	if x {
-		e.buf[e.offset] = 1
+		e.uint8(1)
 	} else {
-		e.buf[e.offset] = 0
+		e.uint8(0)
 	}
-	e.offset++
 }
 
-func (d *decoder) uint8() uint8 {
-	x := d.buf[d.offset]
-	d.offset++
-	return x
-}
+func (d *decoder) uint8() uint8 { return d.next(1)[0] }
 
-func (e *encoder) uint8(x uint8) {
-	e.buf[e.offset] = x
-	e.offset++
-}
+func (e *encoder) uint8(x uint8) { e.next(1)[0] = x }
 
-func (d *decoder) uint16() uint16 {
-	x := Uint16(d.buf[d.offset : d.offset+2])
-	d.offset += 2
-	return x
-}
+func (d *decoder) uint16() uint16 { return Uint16(d.next(2)) }
 
-func (e *encoder) uint16(x uint16) {
-	PutUint16(e.buf[e.offset:e.offset+2], x)
-	e.offset += 2
-}
+func (e *encoder) uint16(x uint16) { PutUint16(e.next(2), x) }
 
-func (d *decoder) uint32() uint32 {
-	x := Uint32(d.buf[d.offset : d.offset+4])
-	d.offset += 4
-	return x
-}
+func (d *decoder) uint32() uint32 { return Uint32(d.next(4)) }
 
-func (e *encoder) uint32(x uint32) {
-	PutUint32(e.buf[e.offset:e.offset+4], x)
-	e.offset += 4
-}
+func (e *encoder) uint32(x uint32) { PutUint32(e.next(4), x) }
 
-func (d *decoder) uint64() uint64 {
-	x := Uint64(d.buf[d.offset : d.offset+8])
-	d.offset += 8
-	return x
-}
+func (d *decoder) uint64() uint64 { return Uint64(d.next(8)) }
 
-func (e *encoder) uint64(x uint64) {
-	PutUint64(e.buf[e.offset:e.offset+8], x)
-	e.offset += 8
-}
+func (e *encoder) uint64(x uint64) { PutUint64(e.next(8), x) }
 
 func (d *decoder) int8() int8 { return int8(d.uint8()) }
 
@@ -446,39 +726,117 @@ func (d *decoder) int64() int64 { return int64(d.uint64()) }
 
 func (e *encoder) int64(x int64) { e.uint64(uint64(x)) }
 
+func (d *decoder) int() int64 {
+	if d.c.IntSize == 4 {
+		return int64(d.int32())
+	}
+	return d.int64()
+}
+
+func (e *encoder) int(x int64) {
+	if e.c.IntSize == 4 {
+		if int64(int32(x)) != x {
+			e.fail(errIntOverflow)
+		}
+		e.int32(int32(x))
+		return
+	}
+	e.int64(x)
+}
+
+func (d *decoder) uint() uint64 {
+	if d.c.IntSize == 4 {
+		return uint64(d.uint32())
+	}
+	return d.uint64()
+}
+
+func (e *encoder) uint(x uint64) {
+	if e.c.IntSize == 4 {
+		if uint64(uint32(x)) != x {
+			e.fail(errIntOverflow)
+		}
+		e.uint32(uint32(x))
+		return
+	}
+	e.uint64(x)
+}
+
 func (d *decoder) value(v reflect.Value) {
+	if d.c.MaxDepth > 0 {
+		switch v.Kind() {
+		case reflect.Array, reflect.Struct, reflect.Slice, reflect.Map:
+			if !d.enter() {
+				return
+			}
+			defer d.leave()
+		}
+	}
+
 	switch v.Kind() {
 	case reflect.Array:
+		if v.Type().Elem() == byteType && v.CanSet() {
+			// Byte arrays, including U16, U32 and U64, are opaque.
+			d.bytes(v)
+			return
+		}
 		l := v.Len()
-		for i := 0; i < l; i++ {
+		for i := 0; i < l && d.err == nil; i++ {
 			d.value(v.Index(i))
 		}
 
 	case reflect.Struct:
-		t := v.Type()
-		l := v.NumField()
-		for i := 0; i < l; i++ {
-			// Note: Calling v.CanSet() below is an optimization.
-			// It would be sufficient to check the field name,
-			// but creating the StructField info for each field is
-			// costly (run "go test -bench=ReadStruct" and compare
-			// results when making changes to this code).
-			if v := v.Field(i); v.CanSet() || t.Field(i).Name != "_" {
-				d.value(v)
-			} else {
-				d.skip(v)
+		si := d.c.cachedStruct(v.Type())
+		d.expect(si.size)
+		start := d.pos()
+		for i := range si.fields {
+			f := &si.fields[i]
+			if f.align > 1 && (f.cond == nil || f.cond.present(v)) {
+				d.align(start, f.align)
 			}
+			switch {
+			case f.cond != nil && !f.cond.present(v):
+				if !f.skip {
+					v.Field(f.index).Set(reflect.Zero(f.typ))
+				}
+			case f.bits != nil:
+				d.bitFields(v, f)
+			case f.skip:
+				d.skip(f.size)
+			case f.str != nil:
+				d.formatString(v, f)
+			case f.ref == wire.RefTag:
+				d.variant(v.Field(f.index), v.Field(f.from))
+			case f.ref != wire.RefNone:
+				d.counted(v.Field(f.index), v.Field(f.from), f.ref)
+			default:
+				d.value(v.Field(f.index))
+			}
+		}
+		if si.align > 1 {
+			d.align(start, si.align)
 		}
 
-	case reflect.Slice:
-		l := v.Len()
-		for i := 0; i < l; i++ {
-			d.value(v.Index(i))
+	case reflect.Pointer:
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
 		}
+		d.value(v.Elem())
+
+	case reflect.Slice:
+		d.slice(v)
+
+	case reflect.Map:
+		d.mapValue(v)
+
+	case reflect.String:
+		d.string(v)
 
 	case reflect.Bool:
 		v.SetBool(d.bool())
 
+	case reflect.Int:
+		v.SetInt(d.int())
 	case reflect.Int8:
 		v.SetInt(int64(d.int8()))
 	case reflect.Int16:
@@ -488,6 +846,8 @@ func (d *decoder) value(v reflect.Value) {
 	case reflect.Int64:
 		v.SetInt(d.int64())
 
+	case reflect.Uint:
+		v.SetUint(d.uint())
 	case reflect.Uint8:
 		v.SetUint(uint64(d.uint8()))
 	case reflect.Uint16:
@@ -518,34 +878,74 @@ func (d *decoder) value(v reflect.Value) {
 func (e *encoder) value(v reflect.Value) {
 	switch v.Kind() {
 	case reflect.Array:
+		if v.Type().Elem() == byteType && v.CanInterface() {
+			e.bytes(v)
+			return
+		}
 		l := v.Len()
-		for i := 0; i < l; i++ {
+		for i := 0; i < l && e.err == nil; i++ {
 			e.value(v.Index(i))
 		}
 
 	case reflect.Struct:
-		t := v.Type()
-		l := v.NumField()
-		for i := 0; i < l; i++ {
-			// see comment for corresponding code in decoder.value()
-			if v := v.Field(i); v.CanSet() || t.Field(i).Name != "_" {
-				e.value(v)
-			} else {
-				e.skip(v)
+		si := e.c.cachedStruct(v.Type())
+		start := e.pos()
+		for i := range si.fields {
+			f := &si.fields[i]
+			if f.align > 1 && (f.cond == nil || f.cond.present(v)) {
+				e.align(start, f.align)
 			}
+			switch {
+			case f.cond != nil && !f.cond.present(v):
+				// The field is absent from the encoding.
+			case f.bits != nil:
+				e.bitFields(v, f)
+			case f.skip:
+				e.skip(f.size)
+			case f.str != nil:
+				e.formatString(v, f)
+			case f.ref == wire.RefTag:
+				e.variant(v.Field(f.index))
+			case f.ref != wire.RefNone:
+				e.counted(v.Field(f.index))
+			case f.holds != wire.RefNone:
+				e.holder(v, f)
+			default:
+				e.value(v.Field(f.index))
+			}
+		}
+		if si.align > 1 {
+			e.align(start, si.align)
 		}
 
-	case reflect.Slice:
-		l := v.Len()
-		for i := 0; i < l; i++ {
-			e.value(v.Index(i))
+	case reflect.Pointer:
+		if v.IsNil() {
+			if !e.c.NilAsZero {
+				e.fail(nilPointer(v.Type()))
+				return
+			}
+			v = reflect.Zero(v.Type().Elem())
+		} else {
+			v = v.Elem()
 		}
+		e.value(v)
+
+	case reflect.Slice:
+		e.slice(v)
+
+	case reflect.Map:
+		e.mapValue(v)
+
+	case reflect.String:
+		e.string(v)
 
 	case reflect.Bool:
 		e.bool(v.Bool())
 
 	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
 		switch v.Type().Kind() {
+		case reflect.Int:
+			e.int(v.Int())
 		case reflect.Int8:
 			e.int8(int8(v.Int()))
 		case reflect.Int16:
@@ -558,6 +958,8 @@ func (e *encoder) value(v reflect.Value) {
 
 	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
 		switch v.Type().Kind() {
+		case reflect.Uint:
+			e.uint(v.Uint())
 		case reflect.Uint8:
 			e.uint8(uint8(v.Uint()))
 		case reflect.Uint16:
@@ -590,53 +992,149 @@ func (e *encoder) value(v reflect.Value) {
 	}
 }
 
-func (d *decoder) skip(v reflect.Value) {
-	d.offset += SizeOf(v)
+func (d *decoder) skip(n int) {
+	for n > 0 && d.err == nil {
+		k := chunkLen(n)
+		pos := d.pos()
+		b := d.next(k)
+		if d.c.Strict {
+			for i, x := range b {
+				if x != 0 {
+					d.fail(&StrictError{Offset: pos + i, Msg: "non-zero reserved byte"})
+					return
+				}
+			}
+		}
+		n -= k
+	}
+}
+
+func (e *encoder) skip(n int) {
+	for n > 0 && e.err == nil {
+		k := chunkLen(n)
+		zero := e.next(k)
+		for i := range zero {
+			zero[i] = 0
+		}
+		n -= k
+	}
 }
 
-func (e *encoder) skip(v reflect.Value) {
-	n := SizeOf(v)
-	zero := e.buf[e.offset : e.offset+n]
-	for i := range zero {
-		zero[i] = 0
+// bytes decodes into the settable byte array v.
+func (d *decoder) bytes(v reflect.Value) {
+	b := arrayBytes(v)
+	for len(b) > 0 && d.err == nil {
+		n := copy(b, d.next(chunkLen(len(b))))
+		b = b[n:]
 	}
-	e.offset += n
+}
+
+// bytes encodes the byte array v.
+func (e *encoder) bytes(v reflect.Value) {
+	if !v.CanAddr() {
+		reflect.Copy(reflect.ValueOf(e.next(v.Len())), v)
+		return
+	}
+	b := arrayBytes(v)
+	for len(b) > 0 && e.err == nil {
+		n := copy(e.next(chunkLen(len(b))), b)
+		b = b[n:]
+	}
+}
+
+// arrayBytes returns the memory of the addressable byte array v.
+// Unlike v.Slice, it does not allocate.
+func arrayBytes(v reflect.Value) []byte {
+	return unsafe.Slice((*byte)(v.Addr().UnsafePointer()), v.Len())
+}
+
+// chunkLen returns n capped to chunkSize.
+func chunkLen(n int) int {
+	if n > chunkSize {
+		return chunkSize
+	}
+	return n
 }
 
 // intSizeOf returns the size of the data required to represent the data when encoded.
-// It returns zero if the type cannot be implemented by the fast path in Read or Write.
+// It returns zero if the type cannot be implemented by the fast path in Read or Write,
+// and for nil pointers, which are left to the reflect-based path.
 func intSizeOf(data any) int {
 	switch data := data.(type) {
-	case bool, int8, uint8, *bool, *int8, *uint8:
+	case bool, int8, uint8:
 		return 1
+	case *bool:
+		if data != nil {
+			return 1
+		}
+	case *int8:
+		if data != nil {
+			return 1
+		}
+	case *uint8:
+		if data != nil {
+			return 1
+		}
 	case []bool:
 		return len(data)
 	case []int8:
 		return len(data)
 	case []uint8:
 		return len(data)
-	case int16, uint16, *int16, *uint16:
+	case int16, uint16:
 		return 2
+	case *int16:
+		if data != nil {
+			return 2
+		}
+	case *uint16:
+		if data != nil {
+			return 2
+		}
 	case []int16:
 		return 2 * len(data)
 	case []uint16:
 		return 2 * len(data)
-	case int32, uint32, *int32, *uint32:
+	case int32, uint32:
 		return 4
+	case *int32:
+		if data != nil {
+			return 4
+		}
+	case *uint32:
+		if data != nil {
+			return 4
+		}
 	case []int32:
 		return 4 * len(data)
 	case []uint32:
 		return 4 * len(data)
-	case int64, uint64, *int64, *uint64:
+	case int64, uint64:
 		return 8
+	case *int64:
+		if data != nil {
+			return 8
+		}
+	case *uint64:
+		if data != nil {
+			return 8
+		}
 	case []int64:
 		return 8 * len(data)
 	case []uint64:
 		return 8 * len(data)
-	case float32, *float32:
+	case float32:
 		return 4
-	case float64, *float64:
+	case *float32:
+		if data != nil {
+			return 4
+		}
+	case float64:
 		return 8
+	case *float64:
+		if data != nil {
+			return 8
+		}
 	case []float32:
 		return 4 * len(data)
 	case []float64:
@@ -0,0 +1,109 @@
+package litend
+
+import (
+	"bytes"
+	"reflect"
+	"sort"
+)
+
+// mapEntry is a map entry with its key encoded at buf[start:end]
+// of the encoder used for the keys.
+type mapEntry struct {
+	start, end int
+	val        reflect.Value
+}
+
+// mapValue encodes the count of entries of the map v, then its entries
+// sorted by encoded key, so that the output does not depend on the map
+// iteration order.
+func (e *encoder) mapValue(v reflect.Value) {
+	n := v.Len()
+	e.length(n)
+	if n == 0 || e.err != nil {
+		return
+	}
+
+	keys := &encoder{c: e.c}
+	entries := make([]mapEntry, 0, n)
+	for it := v.MapRange(); it.Next(); {
+		start := len(keys.buf)
+		keys.value(it.Key())
+		entries = append(entries, mapEntry{start: start, end: len(keys.buf), val: it.Value()})
+	}
+	if keys.err != nil {
+		e.fail(keys.err)
+		return
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		a, b := &entries[i], &entries[j]
+		return bytes.Compare(keys.buf[a.start:a.end], keys.buf[b.start:b.end]) < 0
+	})
+
+	for i := 0; i < len(entries) && e.err == nil; i++ {
+		for k := keys.buf[entries[i].start:entries[i].end]; len(k) > 0; {
+			m := copy(e.next(chunkLen(len(k))), k)
+			k = k[m:]
+		}
+		e.value(entries[i].val)
+	}
+}
+
+// mapValue decodes map entries into v, allocating the map if it is nil.
+// Entries of an existing map are kept unless the input has the same key.
+func (d *decoder) mapValue(v reflect.Value) {
+	n := d.length()
+	t := v.Type()
+	size := d.c.minSize(t.Key()) + d.c.minSize(t.Elem())
+	if d.err != nil || !d.checkLen(n, size) {
+		return
+	}
+	if n > 1 && !d.c.Strict && d.c.sizeof(t.Key()) == 0 && d.c.sizeof(t.Elem()) == 0 {
+		// Keys of no size are all equal, so the map holds one entry
+		// however many are encoded, and the entries consume no input.
+		// Strict decoding fails on the second entry as a duplicate key.
+		n = 1
+	}
+	hint := n
+	if size == 0 {
+		// n is not bounded by the input size.
+		hint = 0
+	} else if d.r != nil && hint > chunkSize/size {
+		// Nor is it by the input of a stream, which may end long before.
+		hint = chunkSize / size
+	}
+
+	// In strict mode, duplicate keys are detected by the map not growing,
+	// so the entries of a non-empty map are decoded into a new one first.
+	m := v
+	if v.IsNil() {
+		v.Set(reflect.MakeMapWithSize(t, hint))
+	} else if d.c.Strict && v.Len() > 0 {
+		m = reflect.MakeMapWithSize(t, hint)
+	}
+
+	key := reflect.New(t.Key()).Elem()
+	val := reflect.New(t.Elem()).Elem()
+	zeroKey, zeroVal := reflect.Zero(t.Key()), reflect.Zero(t.Elem())
+	for i := 0; i < n && d.err == nil; i++ {
+		pos := d.pos()
+		key.Set(zeroKey)
+		val.Set(zeroVal)
+		d.value(key)
+		d.value(val)
+		if d.err != nil {
+			return
+		}
+		l := m.Len()
+		m.SetMapIndex(key, val)
+		if d.c.Strict && m.Len() == l {
+			d.fail(&StrictError{Offset: pos, Msg: "duplicate map key"})
+			return
+		}
+	}
+
+	if m != v {
+		for it := m.MapRange(); it.Next(); {
+			v.SetMapIndex(it.Key(), it.Value())
+		}
+	}
+}
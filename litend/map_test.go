@@ -0,0 +1,70 @@
+package litend
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+type mapRec struct {
+	A map[uint16]uint32
+	B map[string][]byte
+}
+
+func TestMaps(t *testing.T) {
+	c := Codec{LenSize: 2}
+	v := mapRec{A: map[uint16]uint32{3: 30, 1: 10, 258: 7}, B: map[string][]byte{"zz": {1}, "a": nil, "b": {2, 3}}}
+
+	// Entries are sorted by encoded key.
+	keys := []uint16{1, 258, 3}
+	if bigEndian {
+		keys = []uint16{1, 3, 258}
+	}
+	want := AppendUint16(nil, 3)
+	for _, k := range keys {
+		want = AppendUint32(AppendUint16(want, k), v.A[k])
+	}
+	want = AppendUint16(want, 3)
+	want = AppendUint16(append(AppendUint16(want, 1), 'a'), 0)
+	want = append(AppendUint16(append(AppendUint16(want, 1), 'b'), 2), 2, 3)
+	want = append(AppendUint16(append(AppendUint16(want, 2), "zz"...), 1), 1)
+	if n := c.Size(v); n != len(want) {
+		t.Errorf("Size = %d, want %d", n, len(want))
+	}
+	for i := 0; i < 20; i++ {
+		b, err := c.Append(nil, &v)
+		if err != nil || !bytes.Equal(b, want) {
+			t.Fatalf("Append = %x, %v\nwant %x", b, err, want)
+		}
+	}
+
+	var got mapRec
+	if n, err := c.Decode(want, &got); err != nil || n != len(want) || !reflect.DeepEqual(got.A, v.A) ||
+		len(got.B) != 3 || !bytes.Equal(got.B["b"], []byte{2, 3}) {
+		t.Errorf("Decode = %d, %v, %+v", n, err, got)
+	}
+	// Entries are added to an existing map.
+	got.A = map[uint16]uint32{99: 1, 3: 5}
+	if err := c.Read(bytes.NewReader(want), &got); err != nil || len(got.A) != 4 || got.A[99] != 1 || got.A[3] != 30 {
+		t.Errorf("Read into a map = %v, %+v", err, got)
+	}
+
+	dup := AppendUint16(nil, 2)
+	dup = AppendUint32(AppendUint16(dup, 1), 1)
+	dup = AppendUint32(AppendUint16(dup, 1), 2)
+	var m map[uint16]uint32
+	if _, err := c.Decode(dup, &m); err != nil || len(m) != 1 || m[1] != 2 {
+		t.Errorf("Decode of duplicate keys = %v, %v", m, err)
+	}
+	strict := c
+	strict.Strict = true
+	var se *StrictError
+	if _, err := strict.Decode(dup, &m); !errors.As(err, &se) || se.Offset != 8 {
+		t.Errorf("strict Decode of duplicate keys = %v", err)
+	}
+
+	if n := Size(v); n != -1 {
+		t.Errorf("Size without LenSize = %d, want -1", n)
+	}
+}
@@ -0,0 +1,98 @@
+package litend
+
+import (
+	"bytes"
+	"testing"
+)
+
+type ptrHdr struct {
+	Kind uint16
+	Seq  uint32
+}
+
+type ptrMsg struct {
+	Hdr  *ptrHdr
+	Body [4]byte
+	PP   **int32
+}
+
+type ptrList struct{ Next *ptrList }
+
+type ptrSelf *ptrSelf
+
+type ptrTree struct {
+	V    int32
+	Kids []ptrTree
+}
+
+func TestPointers(t *testing.T) {
+	x := int32(-5)
+	px := &x
+	m := ptrMsg{Hdr: &ptrHdr{1, 2}, Body: [4]byte{9, 9, 9, 9}, PP: &px}
+	want := AppendUint32(AppendUint16(nil, 1), 2)
+	want = AppendUint32(append(want, 9, 9, 9, 9), 0xfffffffb)
+	if n := Size(m); n != len(want) {
+		t.Errorf("Size = %d, want %d", n, len(want))
+	}
+	var buf bytes.Buffer
+	if err := Write(&buf, &m); err != nil || !bytes.Equal(buf.Bytes(), want) {
+		t.Fatalf("Write = %x, %v, want %x", buf.Bytes(), err, want)
+	}
+	var got ptrMsg
+	if err := Read(&buf, &got); err != nil || got.Hdr == nil || *got.Hdr != *m.Hdr || **got.PP != -5 {
+		t.Fatalf("Read = %+v, %v", got, err)
+	}
+
+	// Nil pointers fail, unless encoded as zero values.
+	m.Hdr = nil
+	if err := Write(&buf, m); err == nil {
+		t.Error("Write of a nil pointer field succeeded")
+	}
+	var np *int32
+	if err := Write(&buf, np); err == nil {
+		t.Error("Write of a nil pointer succeeded")
+	}
+	if err := Read(&buf, np); err == nil {
+		t.Error("Read into a nil pointer succeeded")
+	}
+	c := Codec{EncodeOptions: EncodeOptions{NilAsZero: true}}
+	b, err := c.Append(nil, m)
+	if err != nil || !bytes.Equal(b[:6], make([]byte, 6)) || !bytes.Equal(b[6:], want[6:]) {
+		t.Errorf("Append with NilAsZero = %x, %v", b, err)
+	}
+	if _, err := c.Decode(b, &got); err != nil || got.Hdr == nil || *got.Hdr != (ptrHdr{}) {
+		t.Errorf("Decode of a nil pointer encoded as zero = %+v, %v", got, err)
+	}
+	if b, err := c.Append(nil, np); err != nil || !bytes.Equal(b, make([]byte, 4)) {
+		t.Errorf("Append of a nil *int32 with NilAsZero = %x, %v", b, err)
+	}
+
+	// Recursive pointer types have no encoding.
+	if err := Write(&buf, ptrList{}); err == nil || Size(ptrList{}) != -1 {
+		t.Errorf("Write of a recursive pointer type = %v", err)
+	}
+	var self ptrSelf
+	if err := Write(&buf, self); err == nil {
+		t.Error("Write of a self pointer type succeeded")
+	}
+}
+
+func TestRecursiveSlices(t *testing.T) {
+	c := Codec{LenSize: 1}
+	tr := ptrTree{1, []ptrTree{{2, nil}, {3, []ptrTree{{4, nil}}}}}
+	b, err := c.Append(nil, tr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := append(AppendUint32(nil, 1), 2)
+	want = append(AppendUint32(want, 2), 0)
+	want = append(AppendUint32(want, 3), 1)
+	want = append(AppendUint32(want, 4), 0)
+	if !bytes.Equal(b, want) {
+		t.Errorf("Append = %x, want %x", b, want)
+	}
+	var got ptrTree
+	if n, err := c.Decode(b, &got); err != nil || n != len(b) || len(got.Kids) != 2 || got.Kids[1].Kids[0].V != 4 {
+		t.Errorf("Decode = %d, %v, %+v", n, err, got)
+	}
+}
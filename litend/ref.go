@@ -0,0 +1,210 @@
+package litend
+
+import (
+	"errors"
+	"math"
+	"reflect"
+	"strconv"
+
+	"github.com/go-perf/encoding/internal/wire"
+)
+
+// setHolder marks the field of si named name as holding ref of the later
+// field at index of, and returns its index. It reports false if there is
+// no such integer field or if it already holds something.
+func (si *structInfo) setHolder(t reflect.Type, name string, ref wire.Ref, of int) (int, bool) {
+	for i := range si.fields {
+		f := &si.fields[i]
+		for j := range f.bits {
+			bf := &f.bits[j]
+			if t.Field(bf.index).Name != name {
+				continue
+			}
+			if bf.skip || bf.holds != wire.RefNone || t.Field(bf.index).Type.Kind() == reflect.Bool {
+				return 0, false
+			}
+			bf.holds, bf.of = ref, of
+			return bf.index, true
+		}
+		if f.bits != nil || f.ref != wire.RefNone || t.Field(f.index).Name != name {
+			continue
+		}
+		switch f.typ.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+			reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		default:
+			return 0, false
+		}
+		if f.skip || f.cond != nil || f.holds != wire.RefNone {
+			return 0, false
+		}
+		f.holds, f.of = ref, of
+		return f.index, true
+	}
+	return 0, false
+}
+
+// canRef reports whether a field of type t can be tagged with ref.
+func (p *planner) canRef(t reflect.Type, ref wire.Ref) bool {
+	switch t.Kind() {
+	case reflect.Interface:
+		return ref == wire.RefTag
+	case reflect.String:
+		return ref != wire.RefTag
+	case reflect.Slice:
+		return ref != wire.RefTag && p.canEncodeElems(t)
+	}
+	return false
+}
+
+// fieldUint returns the value of the integer or bool field v.
+func fieldUint(v reflect.Value) uint64 {
+	switch v.Kind() {
+	case reflect.Bool:
+		if v.Bool() {
+			return 1
+		}
+		return 0
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return uint64(v.Int())
+	}
+	return v.Uint()
+}
+
+// countedSize returns the encoded size of the slice or string v
+// without a length prefix, or -1 if it cannot be encoded.
+func (c Codec) countedSize(v reflect.Value) int {
+	if v.Kind() == reflect.String {
+		return v.Len()
+	}
+	return c.elemsSize(v)
+}
+
+func errHeldOverflow(v reflect.Value, i int, x uint64) error {
+	return errors.New("binary: value " + strconv.FormatUint(x, 10) + " overflows field " + v.Type().Field(i).Name)
+}
+
+// held returns the value to encode for the field i of the struct v,
+// which holds ref of the later field of. The length of a slice or string
+// is only taken from it if the field is zero: otherwise they must match.
+func (e *encoder) held(v reflect.Value, i, of int, ref wire.Ref) (uint64, bool) {
+	var x uint64
+	switch u := v.Field(of); ref {
+	case wire.RefTag:
+		tag, err := variantTag(u)
+		if err != nil {
+			e.fail(err)
+			return 0, false
+		}
+		return tag, true
+	case wire.RefLen:
+		x = uint64(u.Len())
+		if sf := e.stringFormat(v, of); sf != nil {
+			x = uint64(sf.encodedLen(u.String()) / sf.Unit())
+		}
+	default:
+		s := e.c.countedSize(u)
+		if sf := e.stringFormat(v, of); sf != nil {
+			s = sf.encodedLen(u.String())
+		}
+		if s == -1 {
+			e.fail(errors.New("binary: invalid type " + u.Type().String()))
+			return 0, false
+		}
+		x = uint64(s)
+	}
+	if n := fieldUint(v.Field(i)); n != 0 && n != x {
+		t := v.Type()
+		e.fail(errors.New("binary: " + t.Field(i).Name + " is " + strconv.FormatUint(n, 10) +
+			" but " + t.Field(of).Name + " needs " + strconv.FormatUint(x, 10)))
+		return 0, false
+	}
+	return x, true
+}
+
+// stringFormat returns the format of the field i of the struct v, or nil.
+func (e *encoder) stringFormat(v reflect.Value, i int) *stringFormat {
+	if v.Field(i).Kind() != reflect.String {
+		return nil
+	}
+	return e.c.cachedStruct(v.Type()).fieldAt(i).str
+}
+
+// holder encodes the field f of the struct v, which holds the variant
+// tag or the length of a later field.
+func (e *encoder) holder(v reflect.Value, f *field) {
+	x, ok := e.held(v, f.index, f.of, f.holds)
+	if ok && f.size < 8 && x>>(8*f.size) != 0 {
+		e.fail(errHeldOverflow(v, f.index, x))
+	}
+	switch f.typ.Kind() {
+	case reflect.Int8, reflect.Uint8:
+		e.uint8(uint8(x))
+	case reflect.Int16, reflect.Uint16:
+		e.uint16(uint16(x))
+	case reflect.Int32, reflect.Uint32:
+		e.uint32(uint32(x))
+	case reflect.Int, reflect.Uint:
+		e.uint(x)
+	default:
+		e.uint64(x)
+	}
+}
+
+// counted decodes the slice or string field v, whose length of the given
+// kind was decoded into the field n.
+func (d *decoder) counted(v, n reflect.Value, ref wire.Ref) {
+	x := fieldUint(n)
+	if x > math.MaxInt {
+		d.fail(errLenOverflowInt)
+		return
+	}
+	l := int(x)
+	if v.Kind() == reflect.String {
+		d.stringLen(v, l)
+		return
+	}
+	if ref == wire.RefLen {
+		d.sliceLen(v, l)
+		return
+	}
+
+	elem := v.Type().Elem()
+	if s := d.c.sizeof(elem); s >= 0 {
+		if s == 0 && l != 0 || s > 0 && l%s != 0 {
+			d.fail(errors.New("binary: size " + strconv.Itoa(l) + " is not a multiple of " + elem.String()))
+			return
+		}
+		if s > 0 {
+			l /= s
+		}
+		d.sliceLen(v, l)
+		return
+	}
+
+	// Elements of variable size are decoded until l bytes are consumed.
+	end := d.pos() + l
+	v.SetLen(0)
+	zero := reflect.Zero(elem)
+	for i := 0; d.pos() < end && d.err == nil; i++ {
+		if max := d.c.MaxLen; max > 0 && i == max {
+			d.fail(&LimitError{Limit: "MaxLen", Offset: d.pos()})
+			return
+		}
+		v.Set(reflect.Append(v, zero))
+		d.value(v.Index(i))
+	}
+	if d.err == nil && d.pos() != end {
+		d.fail(errors.New("binary: elements of " + v.Type().String() + " overrun their size " + strconv.Itoa(l)))
+	}
+}
+
+// counted encodes the slice or string field v, whose length is held by
+// an earlier field.
+func (e *encoder) counted(v reflect.Value) {
+	if v.Kind() == reflect.String {
+		e.stringBytes(v.String())
+	} else {
+		e.sliceElems(v)
+	}
+}
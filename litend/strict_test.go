@@ -0,0 +1,79 @@
+package litend
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+type strictRec struct {
+	A uint16
+	B bool
+	_ [2]byte
+	C uint8 `binary:"bits=4"`
+	_ uint8 `binary:"bits=4"`
+}
+
+func TestStrict(t *testing.T) {
+	strict := Codec{DecodeOptions: DecodeOptions{Strict: true}}
+	c1 := byte(0x01) // C = 1 and zero reserved bits
+	if bigEndian {
+		c1 = 0x10
+	}
+	in := func(b, blank, bits byte) []byte {
+		return append(AppendUint16(nil, 1), b, 0, blank, bits)
+	}
+
+	var got strictRec
+	if err := strict.Read(bytes.NewReader(in(1, 0, c1)), &got); err != nil || got.A != 1 || !got.B || got.C != 1 {
+		t.Errorf("Read of valid input = %+v, %v", got, err)
+	}
+	for _, tt := range []struct {
+		in     []byte
+		offset int
+	}{
+		{in(2, 0, c1), 2},
+		{in(1, 3, c1), 4},
+		{in(1, 0, 0xff), 5},
+	} {
+		var se *StrictError
+		err := strict.Read(bytes.NewReader(tt.in), &got)
+		if !errors.As(err, &se) || se.Offset != tt.offset {
+			t.Errorf("Read(%x) = %v, want a StrictError at offset %d", tt.in, err, tt.offset)
+		}
+		if _, err := strict.Decode(tt.in, &got); !errors.As(err, &se) || se.Offset != tt.offset {
+			t.Errorf("Decode(%x) = %v, want a StrictError at offset %d", tt.in, err, tt.offset)
+		}
+	}
+
+	// Without Strict, the same input decodes.
+	if err := Read(bytes.NewReader(in(7, 3, 0xff)), &got); err != nil || !got.B || got.C != 0xf {
+		t.Errorf("Read without Strict = %+v, %v", got, err)
+	}
+
+	var se *StrictError
+	bs := make([]bool, 3)
+	if err := strict.Read(bytes.NewReader([]byte{0, 1, 7}), bs); !errors.As(err, &se) || se.Offset != 2 {
+		t.Errorf("Read of []bool = %v", err)
+	}
+
+	natural := strict
+	natural.NaturalAlign = true
+	var padded struct {
+		A uint8
+		B uint32
+	}
+	if _, err := natural.Decode([]byte{1, 0, 9, 0, 0, 0, 0, 0}, &padded); !errors.As(err, &se) || se.Offset != 2 {
+		t.Errorf("Decode with non-zero padding = %v", err)
+	}
+
+	lens := strict
+	lens.LenSize = 1
+	var m map[uint8]uint8
+	if _, err := lens.Decode([]byte{2, 1, 5, 1, 6}, &m); !errors.As(err, &se) {
+		t.Errorf("Decode of a duplicate map key = %v", err)
+	}
+	if _, err := (Codec{LenSize: 1}).Decode([]byte{2, 1, 5, 1, 6}, &m); err != nil || m[1] != 6 {
+		t.Errorf("Decode of a duplicate map key without Strict = %v, %v", m, err)
+	}
+}
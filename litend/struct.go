@@ -0,0 +1,420 @@
+package litend
+
+import (
+	"errors"
+	"reflect"
+	"strconv"
+	"sync"
+
+	"github.com/go-perf/encoding/internal/wire"
+)
+
+// structInfo is the encoding plan of a struct type.
+type structInfo struct {
+	fields []field
+	size   int // encoded size, variable, or -1 if the struct cannot be encoded
+	min    int // minimum encoded size
+	align  int // alignment: the size is padded to a multiple of it
+}
+
+// field is a single step of a struct encoding plan: either a regular
+// struct field or a run of consecutive bit fields sharing the same bytes.
+type field struct {
+	index int          // index of the struct field, unused for bit field runs
+	typ   reflect.Type // type of the struct field, unused for bit field runs
+	skip  bool         // blank (_) field: zeroed on encode, skipped on decode
+	bits  []bitField   // non-nil for a run of bit fields
+	size  int          // encoded size in bytes, or variable
+	align int          // the field is padded to a multiple of align from the start of the struct
+
+	cond *condition    // if= or since= field: presence condition, or nil
+	str  *stringFormat // fixed=, cstring, utf16 or ucs2 string field: its encoding, or nil
+
+	ref   wire.Ref // union=, len= or size= field: what the field at from holds
+	from  int      // index of the earlier field holding the variant tag or length
+	holds wire.Ref // what the field holds of the later field at of
+	of    int
+}
+
+// bitField is a struct field declared with a `binary:"bits=N"` tag.
+// Bit fields are packed LSB-first: the first field of a run occupies
+// the least significant bits of the first byte.
+type bitField struct {
+	index int
+	skip  bool
+	off   int // offset in bits from the start of the run
+	width int
+	holds wire.Ref // what the field holds of the later field at of
+	of    int
+}
+
+// structInfos caches struct encoding plans per layout, since plans depend
+// on the Codec options that change the encoded layout.
+var structInfos [numLayouts]sync.Map // map[reflect.Type]*structInfo
+
+// numLayouts is the number of distinct layouts returned by Codec.layout.
+const numLayouts = 2 * 5 * 5
+
+// layout returns an index identifying the layout options of c.
+func (c Codec) layout() int {
+	n := 5*sizeIndex(c.IntSize) + sizeIndex(c.LenSize)
+	if c.NaturalAlign {
+		n += 5 * 5
+	}
+	return n
+}
+
+// sizeIndex maps the integer sizes 1, 2, 4 and 8 to 1 to 4, and others to 0.
+func sizeIndex(n int) int {
+	switch n {
+	case 1:
+		return 1
+	case 2:
+		return 2
+	case 4:
+		return 3
+	case 8:
+		return 4
+	}
+	return 0
+}
+
+func (c Codec) cachedStruct(t reflect.Type) *structInfo {
+	p := planner{c: c}
+	return p.structInfo(t)
+}
+
+// planner computes type sizes and struct plans for a Codec.
+// It tracks the structs being planned, so that recursive types terminate.
+type planner struct {
+	c       Codec
+	pending map[reflect.Type]*structInfo // plans built by the outermost structInfo call
+	stack   []reflect.Type               // structs being planned, outermost first
+	cut     int                          // len(stack) when the innermost slice element was entered
+}
+
+var (
+	// invalidStruct is the plan of structs that cannot be encoded.
+	invalidStruct = &structInfo{size: -1, align: 1}
+
+	// recursiveStruct stands for a struct being planned that is reached
+	// again through a slice, so its values have a variable size.
+	recursiveStruct = &structInfo{size: variable, align: 1}
+)
+
+func (p *planner) structInfo(t reflect.Type) *structInfo {
+	m := &structInfos[p.c.layout()]
+	if si, ok := m.Load(t); ok {
+		return si.(*structInfo)
+	}
+	for i, st := range p.stack {
+		if st == t {
+			if i >= p.cut {
+				// t contains itself without a slice in between.
+				return invalidStruct
+			}
+			return recursiveStruct
+		}
+	}
+	if si, ok := p.pending[t]; ok {
+		return si
+	}
+
+	root := p.pending == nil
+	if root {
+		p.pending = make(map[reflect.Type]*structInfo)
+	}
+	p.stack = append(p.stack, t)
+	si := p.newStructInfo(t)
+	p.stack = p.stack[:len(p.stack)-1]
+	if !root {
+		p.pending[t] = si
+		return si
+	}
+
+	// The plans of the other structs may rely on t being valid,
+	// so they are only kept if it is.
+	if si.size != -1 {
+		for pt, psi := range p.pending {
+			m.LoadOrStore(pt, psi)
+		}
+	}
+	p.pending = nil
+	v, _ := m.LoadOrStore(t, si)
+	return v.(*structInfo)
+}
+
+func (p *planner) newStructInfo(t reflect.Type) *structInfo {
+	si := &structInfo{align: 1}
+	for i, n := 0, t.NumField(); i < n; i++ {
+		sf := t.Field(i)
+		tag, ok := wire.ParseTag(sf.Tag.Get("binary"))
+		if !ok {
+			return invalidStruct
+		}
+		skip := sf.Name == "_"
+
+		if tag.Bits != 0 {
+			if !isBitFieldType(sf.Type, tag.Bits) || tag.Align != 0 {
+				return invalidStruct
+			}
+			last := len(si.fields) - 1
+			if last < 0 || si.fields[last].bits == nil {
+				si.fields = append(si.fields, field{bits: []bitField{}, align: 1})
+				last++
+			}
+			run := &si.fields[last]
+			off := 0
+			if k := len(run.bits); k > 0 {
+				off = run.bits[k-1].off + run.bits[k-1].width
+			}
+			run.bits = append(run.bits, bitField{index: i, skip: skip, off: off, width: tag.Bits})
+			run.size = (off + tag.Bits + 7) / 8
+			continue
+		}
+
+		var cond *condition
+		if tag.Cond != nil {
+			cond = &condition{Cond: *tag.Cond}
+			if !si.setCondition(t, cond, tag.Cond.On) {
+				return invalidStruct
+			}
+		}
+		var str *stringFormat
+		if tag.Str != nil {
+			str = &stringFormat{*tag.Str}
+		}
+
+		if tag.Ref != wire.RefNone {
+			from, ok := si.setHolder(t, tag.From, tag.Ref, i)
+			if !ok || skip || !p.canRef(sf.Type, tag.Ref) {
+				return invalidStruct
+			}
+			si.fields = append(si.fields, field{index: i, typ: sf.Type, size: variable, align: p.fieldAlign(sf.Type, &tag),
+				cond: cond, str: str, ref: tag.Ref, from: from})
+			continue
+		}
+
+		var s int
+		switch {
+		case str == nil:
+			s = p.sizeof(sf.Type)
+		case sf.Type.Kind() != reflect.String:
+			s = -1
+		case str.Fixed != 0:
+			s = str.Fixed
+		case str.CString:
+			s = variable
+		default:
+			s = p.sizeof(sf.Type)
+		}
+		if s == -1 || s == variable && skip {
+			return invalidStruct
+		}
+		si.fields = append(si.fields, field{index: i, typ: sf.Type, skip: skip, size: s, align: p.fieldAlign(sf.Type, &tag),
+			cond: cond, str: str})
+	}
+
+	for i := range si.fields {
+		f := &si.fields[i]
+		if f.bits != nil && p.c.NaturalAlign {
+			if a := layoutBits(t, f, si.size); a > si.align {
+				si.align = a
+			}
+		}
+		if f.align > si.align {
+			si.align = f.align
+		}
+		if f.ref != wire.RefNone || f.cond != nil {
+			si.size = variable
+			continue
+		}
+		si.min = wire.AlignUp(si.min, f.align)
+		if f.size == variable {
+			si.size = variable
+			if f.str != nil && f.str.CString {
+				si.min += f.str.Unit() // NUL terminator
+			} else {
+				si.min += p.minSize(f.typ)
+			}
+			continue
+		}
+		si.min += f.size
+		if si.size != variable {
+			si.size = wire.AlignUp(si.size, f.align) + f.size
+		}
+	}
+	si.min = wire.AlignUp(si.min, si.align)
+	if si.size != variable {
+		si.size = wire.AlignUp(si.size, si.align)
+	}
+	return si
+}
+
+// fieldAlign returns the alignment of a struct field of type t with the
+// tag options opts, other than a bit field.
+func (p *planner) fieldAlign(t reflect.Type, opts *wire.Tag) int {
+	a := 1
+	switch {
+	case !p.c.NaturalAlign:
+		if opts.Ref == wire.RefNone && opts.Str == nil {
+			a = p.alignof(t)
+		}
+	case opts.Str != nil && opts.Str.Fixed == 0 && !opts.Str.CString && opts.Ref == wire.RefNone:
+		a = p.alignof(t) // length prefix
+	case opts.Str != nil:
+		a = opts.Str.Unit()
+	case opts.Ref == wire.RefLen || opts.Ref == wire.RefSize:
+		if t.Kind() == reflect.Slice {
+			a = p.alignof(t.Elem())
+		}
+	case opts.Ref == wire.RefNone:
+		a = p.alignof(t)
+	}
+	if opts.Align > a {
+		a = opts.Align
+	}
+	return a
+}
+
+// alignof returns the alignment of values of type t.
+// Without NaturalAlign, only structs with align= fields are aligned.
+func (p *planner) alignof(t reflect.Type) int {
+	switch t.Kind() {
+	case reflect.Array, reflect.Pointer:
+		return p.alignof(t.Elem())
+	case reflect.Struct:
+		return p.structInfo(t).align
+	}
+	if !p.c.NaturalAlign {
+		return 1
+	}
+	switch t.Kind() {
+	case reflect.Slice, reflect.Map, reflect.String:
+		// Elements follow the length prefix without padding.
+		if p.c.hasLen() {
+			return p.c.LenSize
+		}
+	case reflect.Int, reflect.Uint:
+		if p.c.IntSize == 4 || p.c.IntSize == 8 {
+			return p.c.IntSize
+		}
+	case reflect.Complex64, reflect.Complex128:
+		return int(t.Size()) / 2
+	case reflect.Bool,
+		reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Float32, reflect.Float64:
+		return int(t.Size())
+	}
+	return 1
+}
+
+// layoutBits lays out the run of bit fields f of the struct type t at
+// offset off, or at an unknown offset if off is variable, so that no
+// bit field straddles a unit of the size of its type, as C compilers do.
+// It returns the alignment the run gives to the struct.
+func layoutBits(t reflect.Type, f *field, off int) int {
+	run, align := wire.NewBitRun(off), 1
+	for i := range f.bits {
+		bf := &f.bits[i]
+		size := int(t.Field(bf.index).Type.Size())
+		bf.off = run.Add(bf.width, size)
+		if !bf.skip && size > align {
+			align = size
+		}
+	}
+	f.size = run.Size()
+	return align
+}
+
+// fieldAt returns the plan of the struct field at index, which is not a bit field.
+func (si *structInfo) fieldAt(index int) *field {
+	for i := range si.fields {
+		if f := &si.fields[i]; f.bits == nil && f.index == index {
+			return f
+		}
+	}
+	return nil
+}
+
+// isBitFieldType reports whether a field of type t can hold a bit field of the given width.
+func isBitFieldType(t reflect.Type, width int) bool {
+	switch t.Kind() {
+	case reflect.Bool:
+		return width == 1
+	case reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return width <= 8*int(t.Size())
+	}
+	return false
+}
+
+func (d *decoder) bitFields(v reflect.Value, f *field) {
+	pos := d.pos()
+	b := d.next(f.size)
+	for _, bf := range f.bits {
+		x := wire.GetBitsLSB(b, bf.off, bf.width)
+		if bf.skip {
+			if d.c.Strict && x != 0 {
+				d.fail(&StrictError{Offset: pos + bf.off/8, Msg: "non-zero reserved bits"})
+			}
+			continue
+		}
+		switch fv := v.Field(bf.index); fv.Kind() {
+		case reflect.Bool:
+			fv.SetBool(x != 0)
+		case reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			shift := 64 - bf.width
+			fv.SetInt(int64(x<<shift) >> shift)
+		default:
+			fv.SetUint(x)
+		}
+	}
+}
+
+func (e *encoder) bitFields(v reflect.Value, f *field) {
+	b := e.next(f.size)
+	for i := range b {
+		b[i] = 0
+	}
+	for _, bf := range f.bits {
+		if bf.skip {
+			continue
+		}
+		if bf.holds != wire.RefNone {
+			if x, ok := e.held(v, bf.index, bf.of, bf.holds); ok {
+				if bf.width < 64 && x>>bf.width != 0 {
+					e.fail(errHeldOverflow(v, bf.index, x))
+				}
+				wire.PutBitsLSB(b, bf.off, bf.width, x)
+			}
+			continue
+		}
+		var x uint64
+		switch fv := v.Field(bf.index); fv.Kind() {
+		case reflect.Bool:
+			if fv.Bool() {
+				x = 1
+			}
+		case reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			i := fv.Int()
+			if shift := 64 - bf.width; i<<shift>>shift != i {
+				e.fail(errBitOverflow(v, bf.index, bf.width))
+			}
+			x = uint64(i)
+		default:
+			x = fv.Uint()
+			if bf.width < 64 && x>>bf.width != 0 {
+				e.fail(errBitOverflow(v, bf.index, bf.width))
+			}
+		}
+		wire.PutBitsLSB(b, bf.off, bf.width, x)
+	}
+}
+
+// errBitOverflow reports that the value of the field i of the struct v
+// does not fit in its bit field of the given width.
+func errBitOverflow(v reflect.Value, i, width int) error {
+	return errors.New("binary: value of field " + v.Type().Field(i).Name + " overflows its " + strconv.Itoa(width) + " bits")
+}
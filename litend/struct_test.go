@@ -0,0 +1,93 @@
+package litend
+
+import (
+	"bytes"
+	"io"
+	"testing"
+)
+
+// bigEndian reports whether the package is bigend. The package packs bit
+// fields LSB-first.
+var bigEndian = Uint16([]byte{0, 1}) == 1
+
+type bitHdr struct {
+	Version uint8 `binary:"bits=4"`
+	IHL     uint8 `binary:"bits=4"`
+	DSCP    uint8 `binary:"bits=6"`
+	ECN     uint8 `binary:"bits=2"`
+	TTL     uint8
+	_       uint8  `binary:"bits=1"`
+	DF      bool   `binary:"bits=1"`
+	MF      bool   `binary:"bits=1"`
+	FragOff uint16 `binary:"bits=13"`
+	S       int8   `binary:"bits=3"`
+}
+
+func TestBitFields(t *testing.T) {
+	h := bitHdr{Version: 4, IHL: 5, ECN: 1, TTL: 64, DF: true, FragOff: 0x123, S: -3}
+	want := []byte{0x54, 0x40, 64, 0x1a, 0x09, 0x05}
+	if bigEndian {
+		want = []byte{0x45, 0x01, 64, 0x41, 0x23, 0xa0}
+	}
+	if n := Size(h); n != len(want) {
+		t.Errorf("Size = %d, want %d", n, len(want))
+	}
+	var buf bytes.Buffer
+	if err := Write(&buf, &h); err != nil || !bytes.Equal(buf.Bytes(), want) {
+		t.Fatalf("Write = %x, %v, want %x", buf.Bytes(), err, want)
+	}
+	var got bitHdr
+	if err := Read(&buf, &got); err != nil || got != h {
+		t.Errorf("Read = %+v, %v, want %+v", got, err, h)
+	}
+
+	// Values fill the width of their field, and blank bit fields are
+	// encoded as zeros.
+	h = bitHdr{Version: 0xf, FragOff: 0x1fff, S: -4}
+	buf.Reset()
+	if err := Write(&buf, &h); err != nil {
+		t.Fatal(err)
+	}
+	if err := Read(&buf, &got); err != nil || got != h {
+		t.Errorf("Read of full fields = %+v, %v, want %+v", got, err, h)
+	}
+
+	// Values wider than their field overflow it.
+	for _, h := range []bitHdr{
+		{Version: 0x1f},
+		{FragOff: 0xffff},
+		{S: 4},
+		{S: -5},
+	} {
+		if _, err := Append(nil, h); err == nil {
+			t.Errorf("Append of %+v succeeded", h)
+		}
+	}
+}
+
+func TestInvalidBitFields(t *testing.T) {
+	for _, v := range []any{
+		&struct {
+			A uint8 `binary:"bits=9"`
+		}{},
+		&struct {
+			B bool `binary:"bits=2"`
+		}{},
+		&struct {
+			F float32 `binary:"bits=3"`
+		}{},
+		&struct {
+			A uint8 `binary:"bits=3,align=2"`
+		}{},
+		&struct {
+			A uint8 `binary:"bits"`
+		}{},
+	} {
+		if err := Write(io.Discard, v); err == nil {
+			t.Errorf("Write of %T succeeded", v)
+		}
+		if n := Size(v); n != -1 {
+			t.Errorf("Size of %T = %d, want -1", v, n)
+		}
+	}
+}
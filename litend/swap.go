@@ -0,0 +1,179 @@
+package litend
+
+import (
+	"errors"
+	"io"
+	"math/bits"
+	"reflect"
+	"sync"
+
+	"github.com/go-perf/encoding/internal/wire"
+)
+
+// Swap16s reverses the bytes of each 2-byte unit of b, converting
+// 16-bit values between byte orders. A trailing partial unit is left
+// unchanged.
+func Swap16s(b []byte) {
+	i := 0
+	for ; i+8 <= len(b); i += 8 {
+		x := Uint64(b[i:])
+		PutUint64(b[i:], x>>8&0x00ff00ff00ff00ff|x&0x00ff00ff00ff00ff<<8)
+	}
+	for ; i+2 <= len(b); i += 2 {
+		b[i], b[i+1] = b[i+1], b[i]
+	}
+}
+
+// Swap32s reverses the bytes of each 4-byte unit of b, converting
+// 32-bit values between byte orders. A trailing partial unit is left
+// unchanged.
+func Swap32s(b []byte) {
+	i := 0
+	for ; i+8 <= len(b); i += 8 {
+		PutUint64(b[i:], bits.RotateLeft64(bits.ReverseBytes64(Uint64(b[i:])), 32))
+	}
+	if i+4 <= len(b) {
+		PutUint32(b[i:], bits.ReverseBytes32(Uint32(b[i:])))
+	}
+}
+
+// Swap64s reverses the bytes of each 8-byte unit of b, converting
+// 64-bit values between byte orders. A trailing partial unit is left
+// unchanged.
+func Swap64s(b []byte) {
+	for i := 0; i+8 <= len(b); i += 8 {
+		PutUint64(b[i:], bits.ReverseBytes64(Uint64(b[i:])))
+	}
+}
+
+func SwapStruct(t reflect.Type, b []byte) error {
+	return Codec{}.SwapStruct(t, b)
+}
+
+// SwapStruct converts in place the encoding of a value of the fixed-size
+// type t at the start of b from the opposite byte order to little-endian,
+// repacking its bit fields.
+func (c Codec) SwapStruct(t reflect.Type, b []byte) error {
+	sp := c.cachedSwapPlan(t)
+	if sp == nil {
+		return errors.New("binary.SwapStruct: invalid type " + t.String())
+	}
+	if len(b) < sp.size {
+		return io.ErrUnexpectedEOF
+	}
+	for _, op := range sp.ops {
+		p := b[op.off : op.off+op.size]
+		switch {
+		case op.bits != nil:
+			swapBits(p, op.bits)
+		case op.unit == 2:
+			Swap16s(p)
+		case op.unit == 4:
+			Swap32s(p)
+		default:
+			Swap64s(p)
+		}
+	}
+	return nil
+}
+
+// swapPlan lists the byte ranges of an encoded type to swap.
+type swapPlan struct {
+	size int
+	ops  []swapOp
+}
+
+// swapOp swaps a range of values of the same size, or a run of bit fields.
+type swapOp struct {
+	off  int
+	size int
+	unit int        // size of the values: 2, 4 or 8
+	bits []bitField // non-nil for a run of bit fields
+}
+
+var swapPlans [numLayouts]sync.Map // map[reflect.Type]*swapPlan
+
+// cachedSwapPlan returns the swap plan of t, or nil if t has no fixed size.
+func (c Codec) cachedSwapPlan(t reflect.Type) *swapPlan {
+	m := &swapPlans[c.layout()]
+	if sp, ok := m.Load(t); ok {
+		return sp.(*swapPlan)
+	}
+	var sp *swapPlan
+	if size := c.sizeof(t); size >= 0 {
+		sp = &swapPlan{size: size}
+		sp.add(c, t, 0)
+	}
+	v, _ := m.LoadOrStore(t, sp)
+	return v.(*swapPlan)
+}
+
+// add appends the ops swapping a value of type t at offset off.
+// The size of t is known to be fixed.
+func (sp *swapPlan) add(c Codec, t reflect.Type, off int) {
+	switch t.Kind() {
+	case reflect.Int16, reflect.Uint16:
+		sp.addUnits(off, 2, 2)
+	case reflect.Int32, reflect.Uint32, reflect.Float32:
+		sp.addUnits(off, 4, 4)
+	case reflect.Int64, reflect.Uint64, reflect.Float64:
+		sp.addUnits(off, 8, 8)
+	case reflect.Complex64:
+		sp.addUnits(off, 4, 8)
+	case reflect.Complex128:
+		sp.addUnits(off, 8, 16)
+	case reflect.Int, reflect.Uint:
+		sp.addUnits(off, c.IntSize, c.IntSize)
+
+	case reflect.Pointer:
+		sp.add(c, t.Elem(), off)
+
+	case reflect.Array:
+		size := c.sizeof(t.Elem())
+		for i := 0; i < t.Len(); i++ {
+			sp.add(c, t.Elem(), off+i*size)
+		}
+
+	case reflect.Struct:
+		start := off
+		for _, f := range c.cachedStruct(t).fields {
+			off = start + wire.AlignUp(off-start, f.align)
+			switch {
+			case f.bits != nil:
+				sp.ops = append(sp.ops, swapOp{off: off, size: f.size, bits: f.bits})
+			case f.str != nil:
+				if f.str.UTF16 {
+					sp.addUnits(off, 2, f.size)
+				}
+			default:
+				sp.add(c, f.typ, off)
+			}
+			off += f.size
+		}
+	}
+}
+
+// addUnits appends an op swapping size bytes of values of unit bytes at
+// offset off, extending the last op if it swaps the preceding bytes.
+func (sp *swapPlan) addUnits(off, unit, size int) {
+	if k := len(sp.ops) - 1; k >= 0 {
+		if last := &sp.ops[k]; last.bits == nil && last.unit == unit && last.off+last.size == off {
+			last.size += size
+			return
+		}
+	}
+	sp.ops = append(sp.ops, swapOp{off: off, size: size, unit: unit})
+}
+
+// swapBits repacks the bit fields of b from the bit order of the other
+// byte order.
+func swapBits(b []byte, fields []bitField) {
+	var buf [16]byte
+	src := append(buf[:0], b...)
+	for i := range b {
+		b[i] = 0
+	}
+	for _, bf := range fields {
+		wire.PutBitsLSB(b, bf.off, bf.width, wire.GetBitsMSB(src, bf.off, bf.width))
+	}
+}
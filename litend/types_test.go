@@ -0,0 +1,43 @@
+package litend
+
+import (
+	"bytes"
+	"testing"
+)
+
+type wireHdr struct {
+	Magic U32
+	Len   U16
+	Off   U64
+	Raw   [3]byte
+}
+
+func TestWireTypes(t *testing.T) {
+	var h wireHdr
+	h.Magic.Set(0xcafebabe)
+	h.Len.Set(0x1234)
+	h.Off.Set(1 << 40)
+	h.Raw = [3]byte{1, 2, 3}
+	if h.Magic.Get() != 0xcafebabe || h.Len.Get() != 0x1234 || h.Off.Get() != 1<<40 {
+		t.Errorf("Get = %#x %#x %#x", h.Magic.Get(), h.Len.Get(), h.Off.Get())
+	}
+	if string(h.Magic[:]) != string(AppendUint32(nil, 0xcafebabe)) {
+		t.Errorf("U32 bytes = %x", h.Magic)
+	}
+
+	// The types are encoded as their bytes.
+	want := AppendUint32(nil, 0xcafebabe)
+	want = AppendUint16(want, 0x1234)
+	want = append(AppendUint64(want, 1<<40), 1, 2, 3)
+	if n := Size(h); n != len(want) {
+		t.Errorf("Size = %d, want %d", n, len(want))
+	}
+	var buf bytes.Buffer
+	if err := Write(&buf, h); err != nil || !bytes.Equal(buf.Bytes(), want) {
+		t.Fatalf("Write = %x, %v, want %x", buf.Bytes(), err, want)
+	}
+	var got wireHdr
+	if err := Read(&buf, &got); err != nil || got != h {
+		t.Errorf("Read = %+v, %v, want %+v", got, err, h)
+	}
+}
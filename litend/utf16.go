@@ -0,0 +1,233 @@
+package litend
+
+import (
+	"errors"
+	"math/bits"
+	"reflect"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	"github.com/go-perf/encoding/internal/wire"
+)
+
+// AppendUTF16 appends the UTF-16 encoding of s to dst in little-endian
+// byte order, without a byte order mark. Runes outside the Basic
+// Multilingual Plane are encoded as surrogate pairs, and invalid UTF-8
+// as U+FFFD.
+func AppendUTF16(dst []byte, s string) []byte {
+	for _, r := range s {
+		if r >= 0x10000 {
+			r1, r2 := utf16.EncodeRune(r)
+			dst = AppendUint16(dst, uint16(r1))
+			r = r2
+		}
+		dst = AppendUint16(dst, uint16(r))
+	}
+	return dst
+}
+
+// UTF16String decodes the little-endian UTF-16 text b. Unpaired surrogates
+// and a trailing odd byte are decoded as U+FFFD. UCS-2 text, which has no
+// surrogates, decodes the same.
+func UTF16String(b []byte) string {
+	return decodeUTF16(b, false)
+}
+
+// UTF16StringBOM is like UTF16String, but a leading byte order mark is
+// removed and selects the byte order of the rest of b.
+func UTF16StringBOM(b []byte) string {
+	if len(b) >= 2 {
+		switch Uint16(b) {
+		case 0xfeff:
+			return decodeUTF16(b[2:], false)
+		case 0xfffe:
+			return decodeUTF16(b[2:], true)
+		}
+	}
+	return decodeUTF16(b, false)
+}
+
+// decodeUTF16 decodes the UTF-16 text b, in the other byte order if swap is set.
+func decodeUTF16(b []byte, swap bool) string {
+	unit := func(i int) rune {
+		u := Uint16(b[i:])
+		if swap {
+			u = bits.ReverseBytes16(u)
+		}
+		return rune(u)
+	}
+	s := make([]byte, 0, len(b)/2)
+	for i := 0; i+1 < len(b); i += 2 {
+		r := unit(i)
+		if utf16.IsSurrogate(r) {
+			r2 := utf8.RuneError
+			if i+3 < len(b) {
+				r2 = unit(i + 2)
+			}
+			if r = utf16.DecodeRune(r, r2); r != utf8.RuneError {
+				i += 2
+			}
+		}
+		s = utf8.AppendRune(s, r)
+	}
+	if len(b)%2 != 0 {
+		s = utf8.AppendRune(s, utf8.RuneError)
+	}
+	return string(s)
+}
+
+// utf16Len returns the number of UTF-16 code units encoding s.
+func utf16Len(s string) int {
+	n := 0
+	for _, r := range s {
+		if r >= 0x10000 {
+			n++
+		}
+		n++
+	}
+	return n
+}
+
+var (
+	errUCS2 = errors.New("binary: string has runes outside the UCS-2 range")
+
+	uint16sType = reflect.TypeOf([]uint16(nil))
+)
+
+// utf16Units returns the UTF-16 code units encoding the string v.
+func (sf *stringFormat) utf16Units(v reflect.Value) ([]uint16, error) {
+	s := v.String()
+	units := make([]uint16, 0, len(s))
+	for _, r := range s {
+		if r >= 0x10000 {
+			if sf.UCS2 {
+				return nil, errUCS2
+			}
+			r1, r2 := utf16.EncodeRune(r)
+			units = append(units, uint16(r1))
+			r = r2
+		}
+		units = append(units, uint16(r))
+	}
+	return units, nil
+}
+
+// utf16Units decodes into the string v UTF-16 code units that are either
+// length-prefixed or whose length was decoded into the field n.
+func (d *decoder) utf16Units(v, n reflect.Value, ref wire.Ref) {
+	units := reflect.New(uint16sType).Elem()
+	if ref == wire.RefNone {
+		d.slice(units)
+	} else {
+		d.counted(units, n, ref)
+	}
+	v.SetString(string(utf16.Decode(units.Interface().([]uint16))))
+}
+
+// utf16Units encodes the string v as UTF-16 code units, length-prefixed
+// unless their length is held by an earlier field.
+func (e *encoder) utf16Units(v reflect.Value, sf *stringFormat, ref wire.Ref) {
+	units, err := sf.utf16Units(v)
+	if err != nil {
+		e.fail(err)
+		return
+	}
+	if ref == wire.RefNone {
+		e.slice(reflect.ValueOf(units))
+	} else {
+		e.sliceElems(reflect.ValueOf(units))
+	}
+}
+
+// fixedUTF16 decodes UTF-16 text of f.size bytes, which ends at the first
+// NUL code unit.
+func (d *decoder) fixedUTF16(v reflect.Value, f *field) {
+	pos := d.pos()
+	b := d.next(f.size)
+	n := 0
+	for n < len(b) && (b[n] != 0 || b[n+1] != 0) {
+		n += 2
+	}
+	if n == len(b) {
+		if d.c.Strict && f.str.CString {
+			d.fail(&StrictError{Offset: pos, Msg: "unterminated string"})
+		}
+	} else if d.c.Strict {
+		for i, x := range b[n:] {
+			if x != 0 {
+				d.fail(&StrictError{Offset: pos + n + i, Msg: "non-zero string padding"})
+				break
+			}
+		}
+	}
+	v.SetString(decodeUTF16(b[:n], false))
+}
+
+// fixedUTF16 encodes v as UTF-16 text of f.size bytes, padded with NUL bytes.
+func (e *encoder) fixedUTF16(v reflect.Value, f *field) {
+	units, err := f.str.utf16Units(v)
+	if err != nil {
+		e.fail(err)
+		return
+	}
+	max := f.size / 2
+	if f.str.CString {
+		max--
+	}
+	if len(units) > max {
+		if !f.str.Truncate {
+			e.fail(errFixedOverflow(2*len(units), f.size))
+			return
+		}
+		if max > 0 && utf16.IsSurrogate(rune(units[max-1])) && units[max-1] < 0xdc00 {
+			max-- // Do not split a surrogate pair.
+		}
+		units = units[:max]
+	}
+	b := e.next(f.size)
+	for i := range b {
+		b[i] = 0
+	}
+	for i, u := range units {
+		if u == 0 {
+			e.fail(errStringNUL)
+			return
+		}
+		PutUint16(b[2*i:], u)
+	}
+}
+
+// cstringUTF16 decodes UTF-16 text terminated by a NUL code unit.
+func (d *decoder) cstringUTF16(v reflect.Value) {
+	var b []byte
+	for d.err == nil {
+		u := d.next(2)
+		if u[0] == 0 && u[1] == 0 {
+			break
+		}
+		b = append(b, u...)
+		if max := d.c.MaxLen; max > 0 && len(b)/2 > max {
+			d.fail(&LimitError{Limit: "MaxLen", Offset: d.pos()})
+		}
+	}
+	if d.err == nil {
+		v.SetString(decodeUTF16(b, false))
+	}
+}
+
+// cstringUTF16 encodes v as UTF-16 text followed by a NUL code unit.
+func (e *encoder) cstringUTF16(v reflect.Value, f *field) {
+	units, err := f.str.utf16Units(v)
+	if err != nil {
+		e.fail(err)
+		return
+	}
+	for _, u := range units {
+		if u == 0 {
+			e.fail(errStringNUL)
+			return
+		}
+		e.uint16(u)
+	}
+	e.uint16(0)
+}
@@ -0,0 +1,106 @@
+package litend
+
+import (
+	"bytes"
+	"testing"
+)
+
+type varPayload interface{ isVarPayload() }
+
+type varPing struct{ Seq uint32 }
+
+type varData struct{ Body []byte }
+
+type varBad struct{ F func() }
+
+func (varPing) isVarPayload()  {}
+func (*varData) isVarPayload() {}
+func (varBad) isVarPayload()   {}
+
+type varFrame struct {
+	Kind uint8
+	Len  uint16
+	P    varPayload `binary:"union=Kind"`
+}
+
+type varBitFrame struct {
+	Ver  uint8      `binary:"bits=4"`
+	Kind uint8      `binary:"bits=4"`
+	P    varPayload `binary:"union=Kind"`
+}
+
+type varLateTag struct {
+	P    varPayload `binary:"union=Kind"`
+	Kind uint8
+}
+
+func init() {
+	RegisterVariant[varPayload, varPing](1)
+	RegisterVariant[varPayload, *varData](2)
+	RegisterVariant[varPayload, varBad](20)
+}
+
+func TestVariants(t *testing.T) {
+	c := Codec{LenSize: 1}
+	for _, tt := range []struct {
+		in   varFrame
+		want []byte
+	}{
+		// Write sets Kind from the type of the variant.
+		{varFrame{Kind: 9, P: varPing{7}}, AppendUint32([]byte{1, 0, 0}, 7)},
+		{varFrame{P: &varData{[]byte{1, 2}}}, []byte{2, 0, 0, 2, 1, 2}},
+	} {
+		var buf bytes.Buffer
+		if err := c.Write(&buf, &tt.in); err != nil || !bytes.Equal(buf.Bytes(), tt.want) {
+			t.Errorf("Write(%+v) = %x, %v, want %x", tt.in, buf.Bytes(), err, tt.want)
+			continue
+		}
+		if n := c.Size(tt.in); n != len(tt.want) {
+			t.Errorf("Size(%+v) = %d, want %d", tt.in, n, len(tt.want))
+		}
+		var got varFrame
+		if err := c.Read(&buf, &got); err != nil || got.Kind != tt.want[0] {
+			t.Errorf("Read(%x) = %+v, %v", tt.want, got, err)
+		}
+		switch p := got.P.(type) {
+		case varPing:
+			if p.Seq != 7 {
+				t.Errorf("Read(%x) = %+v", tt.want, p)
+			}
+		case *varData:
+			if !bytes.Equal(p.Body, []byte{1, 2}) {
+				t.Errorf("Read(%x) = %+v", tt.want, p)
+			}
+		default:
+			t.Errorf("Read(%x) = variant %T", tt.want, p)
+		}
+	}
+
+	hdr := byte(0x14) // Ver = 4, Kind = 1
+	if bigEndian {
+		hdr = 0x41
+	}
+	b, err := c.Append(nil, varBitFrame{Ver: 4, P: varPing{1}})
+	if want := AppendUint32([]byte{hdr}, 1); err != nil || !bytes.Equal(b, want) {
+		t.Fatalf("Append of a bit field tag = %x, %v, want %x", b, err, want)
+	}
+	var bf varBitFrame
+	if _, err := c.Decode(b, &bf); err != nil || bf.Ver != 4 || bf.Kind != 1 || bf.P != (varPing{1}) {
+		t.Errorf("Decode of a bit field tag = %+v, %v", bf, err)
+	}
+	b[0] = 0x77
+	if _, err := c.Decode(b, &bf); err == nil {
+		t.Error("Decode of an unknown variant tag succeeded")
+	}
+
+	for _, v := range []any{
+		varFrame{},               // nil variant
+		varFrame{P: varBad{}},    // variant without an encoding
+		varBitFrame{P: varBad{}}, // tag overflows Kind
+		varLateTag{},
+	} {
+		if _, err := c.Append(nil, v); err == nil {
+			t.Errorf("Append(%+v) succeeded", v)
+		}
+	}
+}
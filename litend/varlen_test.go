@@ -0,0 +1,200 @@
+package litend
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"reflect"
+	"testing"
+)
+
+type varRec struct {
+	ID    uint16
+	Name  string
+	Tags  []uint32
+	Blob  []byte
+	Inner []varSub
+	Arr   [2]string
+}
+
+type varSub struct {
+	K uint8
+	V []int16
+}
+
+var testVarRec = varRec{
+	ID:    7,
+	Name:  "héllo",
+	Tags:  []uint32{1, 2},
+	Blob:  []byte{9, 8, 7},
+	Inner: []varSub{{1, []int16{-1}}, {2, nil}},
+	Arr:   [2]string{"a", "bc"},
+}
+
+func TestVarLen(t *testing.T) {
+	c := Codec{LenSize: 2}
+	var want []byte
+	want = AppendUint16(want, 7)
+	want = append(AppendUint16(want, 6), "héllo"...)
+	want = AppendUint32(AppendUint32(AppendUint16(want, 2), 1), 2)
+	want = append(AppendUint16(want, 3), 9, 8, 7)
+	want = AppendUint16(want, 2)
+	want = AppendUint16(AppendUint16(append(want, 1), 1), 0xffff)
+	want = AppendUint16(append(want, 2), 0)
+	want = append(AppendUint16(want, 1), 'a')
+	want = append(AppendUint16(want, 2), "bc"...)
+
+	b, err := c.Append(nil, &testVarRec)
+	if err != nil || !bytes.Equal(b, want) {
+		t.Fatalf("Append = %x, %v\nwant %x", b, err, want)
+	}
+	if n := c.Size(testVarRec); n != len(want) {
+		t.Errorf("Size = %d, want %d", n, len(want))
+	}
+	if n := Size(testVarRec); n != -1 {
+		t.Errorf("Size without LenSize = %d, want -1", n)
+	}
+	var got varRec
+	if n, err := c.Decode(b, &got); err != nil || n != len(b) || !reflect.DeepEqual(got, testVarRec) {
+		t.Errorf("Decode = %d, %v, %+v", n, err, got)
+	}
+
+	var buf bytes.Buffer
+	if err := c.Write(&buf, []varRec{testVarRec, testVarRec}); err != nil {
+		t.Fatal(err)
+	}
+	buf.WriteString("xyz")
+	r := bytes.NewReader(buf.Bytes())
+	gs := make([]varRec, 2)
+	if err := c.Read(r, gs); err != nil || r.Len() != 3 || !reflect.DeepEqual(gs[1], testVarRec) {
+		t.Errorf("Read = %v, %d bytes left, %+v", err, r.Len(), gs[1])
+	}
+
+	if _, err := (Codec{LenSize: 1}).Append(nil, varRec{Blob: make([]byte, 300)}); err != errLenOverflow {
+		t.Errorf("Append of a too long slice = %v", err)
+	}
+}
+
+func TestDecodeLimits(t *testing.T) {
+	b, _ := Codec{LenSize: 2}.Append(nil, &testVarRec)
+	var got varRec
+	var le *LimitError
+
+	evil := AppendUint16(AppendUint16(nil, 1), 0xffff)
+	if _, err := (Codec{LenSize: 2}).Decode(evil, &got); err != io.ErrUnexpectedEOF {
+		t.Errorf("Decode of a long length = %v", err)
+	}
+	c := Codec{LenSize: 4, DecodeOptions: DecodeOptions{MaxLen: 100}}
+	err := c.Read(bytes.NewReader(AppendUint32(AppendUint16(nil, 1), 1000)), &got)
+	if !errors.As(err, &le) || le.Limit != "MaxLen" || le.Offset != 6 {
+		t.Errorf("Read beyond MaxLen = %v", err)
+	}
+	c = Codec{LenSize: 2, DecodeOptions: DecodeOptions{MaxBytes: 20}}
+	if _, err := c.Decode(b, &got); !errors.As(err, &le) || le.Limit != "MaxBytes" {
+		t.Errorf("Decode beyond MaxBytes = %v", err)
+	}
+	c = Codec{LenSize: 2, DecodeOptions: DecodeOptions{MaxDepth: 2}}
+	if _, err := c.Decode(b, &got); !errors.As(err, &le) || le.Limit != "MaxDepth" {
+		t.Errorf("Decode beyond MaxDepth = %v", err)
+	}
+	c.MaxDepth = 4
+	if _, err := c.Decode(b, &got); err != nil {
+		t.Errorf("Decode within MaxDepth = %v", err)
+	}
+
+	// The limits also hold for the types decoded without reflection.
+	c = Codec{DecodeOptions: DecodeOptions{MaxBytes: 8}}
+	words := make([]uint32, 3)
+	in := make([]byte, 12)
+	if err := c.Read(bytes.NewReader(in), words); !errors.As(err, &le) || le.Limit != "MaxBytes" {
+		t.Errorf("Read of a []uint32 beyond MaxBytes = %v", err)
+	}
+	if _, err := c.Decode(in, words); !errors.As(err, &le) || le.Limit != "MaxBytes" {
+		t.Errorf("Decode of a []uint32 beyond MaxBytes = %v", err)
+	}
+	if err := c.ReadAt(bytes.NewReader(in), 0, words); !errors.As(err, &le) || le.Limit != "MaxBytes" {
+		t.Errorf("ReadAt of a []uint32 beyond MaxBytes = %v", err)
+	}
+	if _, err := c.Decode(in, words[:2]); err != nil {
+		t.Errorf("Decode of a []uint32 within MaxBytes = %v", err)
+	}
+}
+
+func TestHostileLength(t *testing.T) {
+	// A length prefix of 2^60 followed by a few bytes must fail at the end
+	// of the stream, without allocating for the length.
+	in := append(AppendUint64(nil, 1<<60), 1, 2, 3, 4, 5, 6, 7, 8, 9)
+	c := Codec{LenSize: 8}
+	for _, data := range []any{
+		new(struct{ B []uint64 }),
+		new(struct{ B []byte }),
+		new(struct{ S string }),
+		new(struct{ M map[uint32]uint32 }),
+		new(struct {
+			W string `binary:"utf16"`
+		}),
+	} {
+		err := c.Read(bytes.NewReader(in), data)
+		if !errors.Is(err, io.ErrUnexpectedEOF) {
+			t.Errorf("Read into %T = %v, want ErrUnexpectedEOF", data, err)
+		}
+	}
+}
+
+func TestHostileZeroSizeLength(t *testing.T) {
+	// Elements of no size consume no input, so nothing but the limits
+	// bounds their number, and they must not be decoded one at a time.
+	in := AppendUint32(nil, 0x0fffffff)
+	c := Codec{LenSize: 4}
+	var s struct{ S []struct{} }
+	if n, err := c.Decode(in, &s); err != nil || n != 4 || len(s.S) != 0x0fffffff {
+		t.Errorf("Decode of a []struct{} = %d, %v, %d elements", n, err, len(s.S))
+	}
+	var m struct{ M map[struct{}]struct{} }
+	if n, err := c.Decode(in, &m); err != nil || n != 4 || len(m.M) != 1 {
+		t.Errorf("Decode of a map[struct{}]struct{} = %d, %v, %d entries", n, err, len(m.M))
+	}
+	c.Strict = true
+	var se *StrictError
+	if _, err := c.Decode(in, &m); !errors.As(err, &se) {
+		t.Errorf("strict Decode of a map[struct{}]struct{} = %v", err)
+	}
+
+	c = Codec{LenSize: 4, DecodeOptions: DecodeOptions{MaxBytes: 1 << 20}}
+	var le *LimitError
+	for _, data := range []any{&s, &m} {
+		if err := c.Read(bytes.NewReader(in), data); !errors.As(err, &le) || le.Limit != "MaxBytes" {
+			t.Errorf("Read into %T beyond MaxBytes = %v", data, err)
+		}
+	}
+	c = Codec{LenSize: 4, DecodeOptions: DecodeOptions{MaxLen: 1000}}
+	if _, err := c.Decode(in, &s); !errors.As(err, &le) || le.Limit != "MaxLen" {
+		t.Errorf("Decode of a []struct{} beyond MaxLen = %v", err)
+	}
+}
+
+type varShape interface{ isVarShape() }
+
+type varCircle struct{ R uint8 }
+
+func (varCircle) isVarShape() {}
+
+func init() {
+	RegisterVariant[varShape, varCircle](1)
+}
+
+type varVS struct {
+	Kind  uint8
+	Shape varShape `binary:"union=Kind"`
+}
+
+func TestSizeInvalidElems(t *testing.T) {
+	x := struct{ X []varVS }{X: make([]varVS, 3)}
+	if n := (Codec{LenSize: 1}).Size(&x); n != -1 {
+		t.Errorf("Size of elements with nil unions = %d, want -1", n)
+	}
+	x.X[0].Shape, x.X[1].Shape, x.X[2].Shape = varCircle{1}, varCircle{2}, varCircle{3}
+	if n := (Codec{LenSize: 1}).Size(&x); n != 7 {
+		t.Errorf("Size = %d, want 7", n)
+	}
+}
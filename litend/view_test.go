@@ -0,0 +1,61 @@
+package litend
+
+import (
+	"io"
+	"testing"
+)
+
+type viewHdr struct {
+	Magic U32
+	Len   U16
+	Raw   [3]byte
+	In    [2]struct{ X U16 }
+}
+
+func TestView(t *testing.T) {
+	b := AppendUint32(nil, 0xcafebabe)
+	b = AppendUint16(b, 5)
+	b = append(b, 1, 2, 3)
+	b = AppendUint16(AppendUint16(b, 8), 9)
+	b = append(b, 0xff) // not part of the view
+
+	h, err := View[viewHdr](b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h.Magic.Get() != 0xcafebabe || h.Len.Get() != 5 || h.Raw != [3]byte{1, 2, 3} || h.In[1].X.Get() != 9 {
+		t.Errorf("View = %+v", h)
+	}
+	h.Len.Set(7)
+	if Uint16(b[4:]) != 7 {
+		t.Errorf("Set through the view did not change the buffer: %x", b)
+	}
+	PutUint16(b[11:], 10)
+	if h.In[1].X.Get() != 10 {
+		t.Errorf("change of the buffer not seen through the view: %+v", h)
+	}
+
+	if _, err := View[viewHdr](b[:12]); err != io.ErrUnexpectedEOF {
+		t.Errorf("View of a short buffer = %v", err)
+	}
+	if _, err := View[struct{}](nil); err != nil {
+		t.Errorf("View of an empty struct = %v", err)
+	}
+	for _, err := range []error{
+		viewErr[struct{ A uint32 }](b),
+		viewErr[struct {
+			A uint8 `binary:"bits=3"`
+		}](b),
+		viewErr[bitHdr](b),
+		viewErr[[4]byte](b),
+	} {
+		if err == nil {
+			t.Error("View of a type without the wire layout succeeded")
+		}
+	}
+}
+
+func viewErr[T any](b []byte) error {
+	_, err := View[T](b)
+	return err
+}
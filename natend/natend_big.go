@@ -4,6 +4,7 @@ package natend
 
 import (
 	"io"
+	"reflect"
 
 	"github.com/go-perf/encoding/bigend"
 )
@@ -48,10 +49,108 @@ func Read(r io.Reader, data any) error {
 	return bigend.Read(r, data)
 }
 
+func Decode(b []byte, data any) (int, error) {
+	return bigend.Decode(b, data)
+}
+
+func ReadAt(ra io.ReaderAt, off int64, data any) error {
+	return bigend.ReadAt(ra, off, data)
+}
+
 func Write(w io.Writer, data any) error {
 	return bigend.Write(w, data)
 }
 
+func Append(b []byte, data any) ([]byte, error) {
+	return bigend.Append(b, data)
+}
+
+func WriteAt(wa io.WriterAt, off int64, data any) error {
+	return bigend.WriteAt(wa, off, data)
+}
+
+func Swap16s(b []byte) { bigend.Swap16s(b) }
+
+func Swap32s(b []byte) { bigend.Swap32s(b) }
+
+func Swap64s(b []byte) { bigend.Swap64s(b) }
+
+func SwapStruct(t reflect.Type, b []byte) error {
+	return bigend.SwapStruct(t, b)
+}
+
 func Size(v any) int {
 	return bigend.Size(v)
 }
+
+func View[T any](b []byte) (*T, error) {
+	return bigend.View[T](b)
+}
+
+func RegisterVariant[I, T any](tag uint64) {
+	bigend.RegisterVariant[I, T](tag)
+}
+
+func VariantType(it reflect.Type, tag uint64) (reflect.Type, bool) {
+	return bigend.VariantType(it, tag)
+}
+
+func AppendUTF16(dst []byte, s string) []byte {
+	return bigend.AppendUTF16(dst, s)
+}
+
+func UTF16String(b []byte) string {
+	return bigend.UTF16String(b)
+}
+
+func UTF16StringBOM(b []byte) string {
+	return bigend.UTF16StringBOM(b)
+}
+
+func Layout(t reflect.Type) ([]FieldLayout, error) {
+	return bigend.Layout(t)
+}
+
+func Dump(w io.Writer, data any) error {
+	return bigend.Dump(w, data)
+}
+
+func Field[T any](t reflect.Type, path string) (Accessor[T], error) {
+	a, err := bigend.Field[T](t, path)
+	return Accessor[T]{a}, err
+}
+
+func CodecField[T any](c Codec, t reflect.Type, path string) (Accessor[T], error) {
+	a, err := bigend.CodecField[T](c, t, path)
+	return Accessor[T]{a}, err
+}
+
+// Accessor wraps the Accessor of the native byte order, since generic
+// types cannot be aliased.
+type Accessor[T any] struct{ a bigend.Accessor[T] }
+
+func (a Accessor[T]) Get(b []byte) T { return a.a.Get(b) }
+
+func (a Accessor[T]) Set(b []byte, v T) { a.a.Set(b, v) }
+
+func NewBuilder(buf []byte) *Builder {
+	return bigend.NewBuilder(buf)
+}
+
+type (
+	U16 = bigend.U16
+	U32 = bigend.U32
+	U64 = bigend.U64
+
+	Builder = bigend.Builder
+	Mark    = bigend.Mark
+
+	FieldLayout = bigend.FieldLayout
+
+	Codec         = bigend.Codec
+	EncodeOptions = bigend.EncodeOptions
+	DecodeOptions = bigend.DecodeOptions
+	StrictError   = bigend.StrictError
+	PartialError  = bigend.PartialError
+	LimitError    = bigend.LimitError
+)
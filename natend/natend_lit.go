@@ -4,6 +4,7 @@ package natend
 
 import (
 	"io"
+	"reflect"
 
 	"github.com/go-perf/encoding/litend"
 )
@@ -48,10 +49,108 @@ func Read(r io.Reader, data any) error {
 	return litend.Read(r, data)
 }
 
+func Decode(b []byte, data any) (int, error) {
+	return litend.Decode(b, data)
+}
+
+func ReadAt(ra io.ReaderAt, off int64, data any) error {
+	return litend.ReadAt(ra, off, data)
+}
+
 func Write(w io.Writer, data any) error {
 	return litend.Write(w, data)
 }
 
+func Append(b []byte, data any) ([]byte, error) {
+	return litend.Append(b, data)
+}
+
+func WriteAt(wa io.WriterAt, off int64, data any) error {
+	return litend.WriteAt(wa, off, data)
+}
+
+func Swap16s(b []byte) { litend.Swap16s(b) }
+
+func Swap32s(b []byte) { litend.Swap32s(b) }
+
+func Swap64s(b []byte) { litend.Swap64s(b) }
+
+func SwapStruct(t reflect.Type, b []byte) error {
+	return litend.SwapStruct(t, b)
+}
+
 func Size(v any) int {
 	return litend.Size(v)
 }
+
+func View[T any](b []byte) (*T, error) {
+	return litend.View[T](b)
+}
+
+func RegisterVariant[I, T any](tag uint64) {
+	litend.RegisterVariant[I, T](tag)
+}
+
+func VariantType(it reflect.Type, tag uint64) (reflect.Type, bool) {
+	return litend.VariantType(it, tag)
+}
+
+func AppendUTF16(dst []byte, s string) []byte {
+	return litend.AppendUTF16(dst, s)
+}
+
+func UTF16String(b []byte) string {
+	return litend.UTF16String(b)
+}
+
+func UTF16StringBOM(b []byte) string {
+	return litend.UTF16StringBOM(b)
+}
+
+func Layout(t reflect.Type) ([]FieldLayout, error) {
+	return litend.Layout(t)
+}
+
+func Dump(w io.Writer, data any) error {
+	return litend.Dump(w, data)
+}
+
+func Field[T any](t reflect.Type, path string) (Accessor[T], error) {
+	a, err := litend.Field[T](t, path)
+	return Accessor[T]{a}, err
+}
+
+func CodecField[T any](c Codec, t reflect.Type, path string) (Accessor[T], error) {
+	a, err := litend.CodecField[T](c, t, path)
+	return Accessor[T]{a}, err
+}
+
+// Accessor wraps the Accessor of the native byte order, since generic
+// types cannot be aliased.
+type Accessor[T any] struct{ a litend.Accessor[T] }
+
+func (a Accessor[T]) Get(b []byte) T { return a.a.Get(b) }
+
+func (a Accessor[T]) Set(b []byte, v T) { a.a.Set(b, v) }
+
+func NewBuilder(buf []byte) *Builder {
+	return litend.NewBuilder(buf)
+}
+
+type (
+	U16 = litend.U16
+	U32 = litend.U32
+	U64 = litend.U64
+
+	Builder = litend.Builder
+	Mark    = litend.Mark
+
+	FieldLayout = litend.FieldLayout
+
+	Codec         = litend.Codec
+	EncodeOptions = litend.EncodeOptions
+	DecodeOptions = litend.DecodeOptions
+	StrictError   = litend.StrictError
+	PartialError  = litend.PartialError
+	LimitError    = litend.LimitError
+)
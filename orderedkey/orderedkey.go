@@ -0,0 +1,171 @@
+// Package orderedkey encodes values into keys whose byte order, as
+// compared by bytes.Compare, matches the order of the values.
+//
+// Every encoding is self-delimiting, so a composite key is the
+// concatenation of the encodings of its fields, and sorts by its first
+// field, then by its second field, and so on. Fields encoded with
+// a Desc function sort in descending order.
+package orderedkey
+
+import (
+	"bytes"
+	"errors"
+	"math"
+
+	"github.com/go-perf/encoding/bigend"
+)
+
+// ErrInvalidKey is returned when decoding a truncated or malformed key.
+var ErrInvalidKey = errors.New("orderedkey: invalid key")
+
+const signBit = 1 << 63
+
+func AppendUint64Asc(dst []byte, x uint64) []byte {
+	return bigend.AppendUint64(dst, x)
+}
+
+func AppendUint64Desc(dst []byte, x uint64) []byte {
+	return bigend.AppendUint64(dst, ^x)
+}
+
+// AppendInt64Asc appends x as 8 bytes which sort negative values
+// before non-negative ones.
+func AppendInt64Asc(dst []byte, x int64) []byte {
+	return bigend.AppendUint64(dst, uint64(x)^signBit)
+}
+
+func AppendInt64Desc(dst []byte, x int64) []byte {
+	return bigend.AppendUint64(dst, ^(uint64(x) ^ signBit))
+}
+
+// AppendFloat64 appends x as 8 bytes which sort -Inf first and +Inf
+// last. Negative zero is encoded as zero, and all NaNs as a single NaN
+// which sorts after +Inf.
+func AppendFloat64(dst []byte, x float64) []byte {
+	return bigend.AppendUint64(dst, floatKey(x))
+}
+
+func AppendFloat64Desc(dst []byte, x float64) []byte {
+	return bigend.AppendUint64(dst, ^floatKey(x))
+}
+
+// floatKey returns the bits of x, transformed to sort as unsigned integers.
+func floatKey(x float64) uint64 {
+	switch {
+	case x == 0:
+		x = 0
+	case x != x:
+		x = math.NaN()
+	}
+	u := math.Float64bits(x)
+	if u&signBit != 0 {
+		return ^u
+	}
+	return u | signBit
+}
+
+// AppendString appends s followed by the terminator 0x00 0x01, with its
+// NUL bytes escaped as 0x00 0xff, so that a string sorts before the
+// strings it is a prefix of.
+func AppendString(dst []byte, s string) []byte {
+	return appendString(dst, s, 0)
+}
+
+func AppendStringDesc(dst []byte, s string) []byte {
+	return appendString(dst, s, 0xff)
+}
+
+// appendString appends the escaped encoding of s, with each byte xored with inv.
+func appendString(dst []byte, s string, inv byte) []byte {
+	for {
+		i := 0
+		for i < len(s) && s[i] != 0 {
+			dst = append(dst, s[i]^inv)
+			i++
+		}
+		if i == len(s) {
+			return append(dst, inv, 0x01^inv)
+		}
+		dst = append(dst, inv, 0xff^inv)
+		s = s[i+1:]
+	}
+}
+
+// Uint64Asc decodes a key appended by AppendUint64Asc, and returns the
+// rest of key.
+func Uint64Asc(key []byte) (uint64, []byte, error) {
+	if len(key) < 8 {
+		return 0, nil, ErrInvalidKey
+	}
+	return bigend.Uint64(key), key[8:], nil
+}
+
+func Uint64Desc(key []byte) (uint64, []byte, error) {
+	x, rest, err := Uint64Asc(key)
+	return ^x, rest, err
+}
+
+func Int64Asc(key []byte) (int64, []byte, error) {
+	x, rest, err := Uint64Asc(key)
+	return int64(x ^ signBit), rest, err
+}
+
+func Int64Desc(key []byte) (int64, []byte, error) {
+	x, rest, err := Uint64Asc(key)
+	return int64(^x ^ signBit), rest, err
+}
+
+func Float64(key []byte) (float64, []byte, error) {
+	x, rest, err := Uint64Asc(key)
+	if err != nil {
+		return 0, nil, err
+	}
+	return floatValue(x), rest, nil
+}
+
+func Float64Desc(key []byte) (float64, []byte, error) {
+	x, rest, err := Uint64Asc(key)
+	if err != nil {
+		return 0, nil, err
+	}
+	return floatValue(^x), rest, nil
+}
+
+// floatValue reverses floatKey.
+func floatValue(u uint64) float64 {
+	if u&signBit != 0 {
+		return math.Float64frombits(u &^ signBit)
+	}
+	return math.Float64frombits(^u)
+}
+
+func String(key []byte) (string, []byte, error) {
+	return decodeString(key, 0)
+}
+
+func StringDesc(key []byte) (string, []byte, error) {
+	return decodeString(key, 0xff)
+}
+
+// decodeString reverses appendString.
+func decodeString(key []byte, inv byte) (string, []byte, error) {
+	var s []byte
+	for {
+		i := bytes.IndexByte(key, inv)
+		if i < 0 || i+1 == len(key) {
+			return "", nil, ErrInvalidKey
+		}
+		for _, c := range key[:i] {
+			s = append(s, c^inv)
+		}
+		switch key[i+1] ^ inv {
+		case 0x01:
+			return string(s), key[i+2:], nil
+		case 0xff:
+			s = append(s, 0)
+			key = key[i+2:]
+		default:
+			return "", nil, ErrInvalidKey
+		}
+	}
+}
@@ -0,0 +1,158 @@
+package orderedkey
+
+import (
+	"bytes"
+	"math"
+	"sort"
+	"testing"
+)
+
+// checkOrder checks that the keys of the sorted values sort in the same
+// order, and that keys of equal values are equal.
+func checkOrder[T any](t *testing.T, values []T, less func(a, b T) bool, enc func([]byte, T) []byte) {
+	t.Helper()
+	for i := range values {
+		for j := range values {
+			a, b := values[i], values[j]
+			got := bytes.Compare(enc(nil, a), enc(nil, b))
+			want := 0
+			if less(a, b) {
+				want = -1
+			} else if less(b, a) {
+				want = 1
+			}
+			if got != want {
+				t.Errorf("compare keys of %v and %v = %d, want %d", a, b, got, want)
+			}
+		}
+	}
+}
+
+func TestInt64Order(t *testing.T) {
+	values := []int64{math.MinInt64, math.MinInt64 + 1, -1 << 32, -256, -255, -1, 0, 1, 255, 256, 1 << 32, math.MaxInt64 - 1, math.MaxInt64}
+	asc := func(a, b int64) bool { return a < b }
+	desc := func(a, b int64) bool { return a > b }
+	checkOrder(t, values, asc, AppendInt64Asc)
+	checkOrder(t, values, desc, AppendInt64Desc)
+
+	for _, x := range values {
+		if got, rest, err := Int64Asc(AppendInt64Asc(nil, x)); got != x || len(rest) != 0 || err != nil {
+			t.Errorf("Int64Asc(AppendInt64Asc(%d)) = %d, %x, %v", x, got, rest, err)
+		}
+		if got, rest, err := Int64Desc(AppendInt64Desc(nil, x)); got != x || len(rest) != 0 || err != nil {
+			t.Errorf("Int64Desc(AppendInt64Desc(%d)) = %d, %x, %v", x, got, rest, err)
+		}
+	}
+}
+
+func TestUint64Order(t *testing.T) {
+	values := []uint64{0, 1, 255, 256, 1 << 63, math.MaxUint64}
+	checkOrder(t, values, func(a, b uint64) bool { return a < b }, AppendUint64Asc)
+	checkOrder(t, values, func(a, b uint64) bool { return a > b }, AppendUint64Desc)
+}
+
+func TestFloat64Order(t *testing.T) {
+	nan := math.NaN()
+	values := []float64{math.Inf(-1), -math.MaxFloat64, -1.5, -1, -math.SmallestNonzeroFloat64, math.Copysign(0, -1), 0, math.SmallestNonzeroFloat64, 1, 1.5, math.MaxFloat64, math.Inf(1), nan, -nan}
+	// NaNs are equal to each other, and greater than any number.
+	less := func(a, b float64) bool { return a < b || a == a && b != b }
+	checkOrder(t, values, less, AppendFloat64)
+	checkOrder(t, values, func(a, b float64) bool { return less(b, a) }, AppendFloat64Desc)
+
+	for _, x := range values {
+		got, _, err := Float64(AppendFloat64(nil, x))
+		if err != nil || got != x && !(got != got && x != x) {
+			t.Errorf("Float64(AppendFloat64(%v)) = %v, %v", x, got, err)
+		}
+		got, _, err = Float64Desc(AppendFloat64Desc(nil, x))
+		if err != nil || got != x && !(got != got && x != x) {
+			t.Errorf("Float64Desc(AppendFloat64Desc(%v)) = %v, %v", x, got, err)
+		}
+	}
+	if got, _, _ := Float64(AppendFloat64(nil, math.Copysign(0, -1))); math.Signbit(got) {
+		t.Errorf("negative zero decoded as %v, want 0", got)
+	}
+}
+
+func TestStringOrder(t *testing.T) {
+	values := []string{"", "\x00", "\x00\x00", "\x00\x01", "\x00\xff", "\x01", "a", "a\x00", "a\x00b", "a\x01", "ab", "b", "\xff", "\xff\xff"}
+	checkOrder(t, values, func(a, b string) bool { return a < b }, AppendString)
+	checkOrder(t, values, func(a, b string) bool { return a > b }, AppendStringDesc)
+
+	for _, s := range values {
+		if got, rest, err := String(AppendString(nil, s)); got != s || len(rest) != 0 || err != nil {
+			t.Errorf("String(AppendString(%q)) = %q, %x, %v", s, got, rest, err)
+		}
+		if got, rest, err := StringDesc(AppendStringDesc(nil, s)); got != s || len(rest) != 0 || err != nil {
+			t.Errorf("StringDesc(AppendStringDesc(%q)) = %q, %x, %v", s, got, rest, err)
+		}
+	}
+}
+
+type tuple struct {
+	name  string
+	score int64
+	rank  float64
+}
+
+func appendTuple(dst []byte, x tuple) []byte {
+	dst = AppendString(dst, x.name)
+	dst = AppendInt64Desc(dst, x.score)
+	return AppendFloat64(dst, x.rank)
+}
+
+func TestTupleOrder(t *testing.T) {
+	tuples := []tuple{
+		{"", 0, 0},
+		{"a", 5, 1},
+		{"a", 5, 2},
+		{"a", -5, 0},
+		{"a\x00", 100, 0},
+		{"ab", 1, -1},
+		{"b", 0, 0},
+	}
+	less := func(a, b tuple) bool {
+		if a.name != b.name {
+			return a.name < b.name
+		}
+		if a.score != b.score {
+			return a.score > b.score
+		}
+		return a.rank < b.rank
+	}
+	checkOrder(t, tuples, less, appendTuple)
+
+	keys := make([][]byte, len(tuples))
+	for i, x := range tuples {
+		keys[i] = appendTuple(nil, x)
+	}
+	sort.Slice(keys, func(i, j int) bool { return bytes.Compare(keys[i], keys[j]) < 0 })
+	for i, key := range keys {
+		name, key, err := String(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		score, key, err := Int64Desc(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rank, key, err := Float64(key)
+		if err != nil || len(key) != 0 {
+			t.Fatalf("Float64: %x, %v", key, err)
+		}
+		if got := (tuple{name, score, rank}); got != tuples[i] {
+			t.Errorf("key %d decoded as %v, want %v", i, got, tuples[i])
+		}
+	}
+}
+
+func TestInvalidKey(t *testing.T) {
+	for _, key := range []string{"", "abc", "abc\x00", "abc\x00\x02"} {
+		if _, _, err := String([]byte(key)); err != ErrInvalidKey {
+			t.Errorf("String(%q) error = %v, want ErrInvalidKey", key, err)
+		}
+	}
+	if _, _, err := Int64Asc(make([]byte, 7)); err != ErrInvalidKey {
+		t.Errorf("Int64Asc of 7 bytes error = %v, want ErrInvalidKey", err)
+	}
+}
@@ -0,0 +1,431 @@
+package schema
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+
+	"github.com/go-perf/encoding/internal/wire"
+)
+
+var (
+	errLenOverflow    = errors.New("length overflows lenSize")
+	errLenOverflowInt = errors.New("length prefix overflows int")
+	errEmptyElems     = errors.New("elements of size 0 cannot fill the input")
+)
+
+type decoder struct {
+	s     *Schema
+	buf   []byte
+	off   int
+	path  []string
+	err   error
+	visit func(Span) // called for the spans of the input, or nil
+}
+
+// span reports the span of the input from start to the current offset.
+func (d *decoder) span(kind SpanKind, start int, v any) {
+	if d.visit != nil && d.err == nil && d.off > start {
+		d.visit(Span{Kind: kind, Path: joinPath(d.path), Offset: start, Size: d.off - start, Value: v})
+	}
+}
+
+// fail records the first error encountered by d.
+func (d *decoder) fail(err error) {
+	if d.err == nil {
+		d.err = &Error{Path: joinPath(d.path), Offset: d.off, Err: err}
+	}
+}
+
+// joinPath returns the path of a value from its steps, such as .Items
+// and [2].
+func joinPath(path []string) string {
+	return strings.TrimPrefix(strings.Join(path, ""), ".")
+}
+
+func (d *decoder) push(step string) { d.path = append(d.path, step) }
+func (d *decoder) pop()             { d.path = d.path[:len(d.path)-1] }
+
+var zeros [16]byte
+
+// next consumes n bytes. After an error, it returns zero bytes.
+func (d *decoder) next(n int) []byte {
+	if d.err == nil && n > len(d.buf)-d.off {
+		d.fail(io.ErrUnexpectedEOF)
+	}
+	if d.err != nil {
+		if n <= len(zeros) {
+			return zeros[:n]
+		}
+		return make([]byte, n)
+	}
+	b := d.buf[d.off : d.off+n]
+	d.off += n
+	return b
+}
+
+// align skips the padding up to a multiple of align from start.
+func (d *decoder) align(start, align int) {
+	if pad := wire.AlignUp(d.off-start, align) - (d.off - start); pad > 0 {
+		d.next(pad)
+		d.span(PaddingSpan, d.off-pad, nil)
+	}
+}
+
+// uint decodes an unsigned integer of size bytes.
+func (d *decoder) uint(order byteOrder, size int) uint64 {
+	b := d.next(size)
+	switch size {
+	case 1:
+		return uint64(b[0])
+	case 2:
+		return uint64(order.Uint16(b))
+	case 4:
+		return uint64(order.Uint32(b))
+	}
+	return order.Uint64(b)
+}
+
+// float decodes a floating-point number of size bytes.
+func (d *decoder) float(order byteOrder, size int) float64 {
+	x := d.uint(order, size)
+	if size == 4 {
+		return float64(math.Float32frombits(uint32(x)))
+	}
+	return math.Float64frombits(x)
+}
+
+func (d *decoder) value(n *node) any {
+	start := d.off
+	var v any
+	switch n.kind {
+	case kindBool:
+		v = d.next(1)[0] != 0
+	case kindInt:
+		shift := 64 - 8*n.size
+		v = int64(d.uint(n.order, n.size)<<shift) >> shift
+	case kindUint:
+		v = d.uint(n.order, n.size)
+	case kindFloat:
+		v = d.float(n.order, n.size)
+	case kindComplex:
+		re := d.float(n.order, n.size/2)
+		v = complex(re, d.float(n.order, n.size/2))
+	case kindString:
+		l := d.length(n)
+		start = d.off
+		v = d.stringLen(l)
+	case kindArray:
+		l := make([]any, n.len)
+		for i := 0; i < n.len && d.err == nil; i++ {
+			d.push("[" + strconv.Itoa(i) + "]")
+			l[i] = d.value(n.elem)
+			d.pop()
+		}
+		return l
+	case kindSlice:
+		return d.elems(n.elem, d.length(n))
+	case kindMap:
+		return d.mapValue(n)
+	default:
+		return d.structValue(n)
+	}
+	d.span(ValueSpan, start, v)
+	return v
+}
+
+// length decodes the length prefix of a value of type n.
+func (d *decoder) length(n *node) int {
+	x := d.uint(n.order, d.s.LenSize)
+	d.span(LengthSpan, d.off-d.s.LenSize, x)
+	if x > math.MaxInt {
+		d.fail(errLenOverflowInt)
+		return 0
+	}
+	return int(x)
+}
+
+// checkLen reports whether the rest of the input can hold l elements
+// of at least size bytes, before anything is allocated for them.
+func (d *decoder) checkLen(l, size int) bool {
+	if d.err != nil {
+		return false
+	}
+	if size > 0 && l > (len(d.buf)-d.off)/size {
+		d.fail(io.ErrUnexpectedEOF)
+		return false
+	}
+	return true
+}
+
+// elems decodes l elements of type elem.
+func (d *decoder) elems(elem *node, l int) []any {
+	if !d.checkLen(l, elem.min) {
+		return nil
+	}
+	hint := l
+	if elem.min == 0 {
+		// l is not bounded by the input size.
+		hint = 0
+	}
+	list := make([]any, 0, hint)
+	for i := 0; i < l && d.err == nil; i++ {
+		d.push("[" + strconv.Itoa(i) + "]")
+		list = append(list, d.value(elem))
+		d.pop()
+	}
+	return list
+}
+
+// rest decodes elements of type elem up to the end of the input.
+func (d *decoder) rest(elem *node) []any {
+	return d.until(elem, len(d.buf))
+}
+
+// until decodes elements of type elem up to the offset end.
+func (d *decoder) until(elem *node, end int) []any {
+	var list []any
+	for d.off < end && d.err == nil {
+		start := d.off
+		d.push("[" + strconv.Itoa(len(list)) + "]")
+		list = append(list, d.value(elem))
+		d.pop()
+		if d.off == start {
+			d.fail(errEmptyElems)
+		}
+	}
+	if list == nil {
+		list = []any{}
+	}
+	return list
+}
+
+// stringLen decodes a string of l bytes.
+func (d *decoder) stringLen(l int) string {
+	if !d.checkLen(l, 1) {
+		return ""
+	}
+	return string(d.next(l))
+}
+
+// mapValue decodes the entries of a map as [key, value] pairs.
+func (d *decoder) mapValue(n *node) []any {
+	l := d.length(n)
+	size := n.key.min + n.elem.min
+	if !d.checkLen(l, size) {
+		return nil
+	}
+	hint := l
+	if size == 0 {
+		hint = 0
+	}
+	entries := make([]any, 0, hint)
+	for i := 0; i < l && d.err == nil; i++ {
+		d.push("[" + strconv.Itoa(i) + "]")
+		k := d.value(n.key)
+		entries = append(entries, []any{k, d.value(n.elem)})
+		d.pop()
+	}
+	return entries
+}
+
+func (d *decoder) structValue(n *node) map[string]any {
+	m := make(map[string]any, len(n.fields))
+	start := d.off
+	for i := 0; i < len(n.fields) && d.err == nil; i++ {
+		f := &n.fields[i]
+		if f.cond != nil && !present(f.cond, m) {
+			continue
+		}
+		d.align(start, f.align)
+		if f.bits != nil {
+			d.bitFields(m, f, n.order)
+			continue
+		}
+		d.push("." + f.name)
+		switch {
+		case f.skip:
+			d.next(f.size)
+			d.span(PaddingSpan, d.off-f.size, nil)
+		case f.str != nil:
+			m[f.name] = d.formatString(m, f)
+		case f.ref == wire.RefTag:
+			m[f.name] = d.variant(f.node, m[f.from])
+		case f.ref != wire.RefNone:
+			m[f.name] = d.counted(f, m[f.from])
+		default:
+			m[f.name] = d.value(f.node)
+		}
+		d.pop()
+	}
+	d.align(start, n.align)
+	return m
+}
+
+func (d *decoder) bitFields(m map[string]any, f *field, order byteOrder) {
+	b := d.next(f.size)
+	for _, bf := range f.bits {
+		x := order.getBits(b, bf.off, bf.width)
+		kind, v := ValueSpan, any(nil)
+		switch {
+		case bf.skip:
+			kind = PaddingSpan
+		case bf.node.kind == kindBool:
+			v = x != 0
+		case bf.node.kind == kindInt:
+			shift := 64 - bf.width
+			v = int64(x<<shift) >> shift
+		default:
+			v = x
+		}
+		if !bf.skip {
+			m[bf.name] = v
+		}
+		if d.visit != nil && d.err == nil {
+			d.visit(Span{Kind: kind, Path: joinPath(append(d.path, "."+bf.name)), Offset: d.off - f.size, Size: f.size,
+				BitOffset: bf.off, Bits: bf.width, Value: v})
+		}
+	}
+}
+
+// variant decodes the variant of the union n with the given tag.
+func (d *decoder) variant(n *node, tag any) any {
+	x, _ := uintValue(tag)
+	vn, ok := n.variants[x]
+	if !ok {
+		d.fail(errors.New("unknown variant tag " + strconv.FormatUint(x, 10)))
+		return nil
+	}
+	return d.value(vn)
+}
+
+// held returns the length held by an earlier field.
+func (d *decoder) held(v any) int {
+	x, _ := uintValue(v)
+	if x > math.MaxInt {
+		d.fail(errLenOverflowInt)
+		return 0
+	}
+	return int(x)
+}
+
+// counted decodes the slice or string field f, whose length of the kind
+// f.ref is held by an earlier field.
+func (d *decoder) counted(f *field, holder any) any {
+	l := d.held(holder)
+	if d.err != nil {
+		return nil
+	}
+	if f.node.kind == kindString {
+		start := d.off
+		s := d.stringLen(l)
+		d.span(ValueSpan, start, s)
+		return s
+	}
+	if f.ref == wire.RefLen {
+		return d.elems(f.node.elem, l)
+	}
+
+	elem := f.node.elem
+	if s := elem.size; s >= 0 {
+		if s == 0 && l != 0 || s > 0 && l%s != 0 {
+			d.fail(errors.New("size " + strconv.Itoa(l) + " is not a multiple of the element size " + strconv.Itoa(s)))
+			return nil
+		}
+		if s > 0 {
+			l /= s
+		}
+		return d.elems(elem, l)
+	}
+
+	// Elements of variable size are decoded until l bytes are consumed.
+	if !d.checkLen(l, 1) {
+		return nil
+	}
+	end := d.off + l
+	list := d.until(elem, end)
+	if d.err == nil && d.off != end {
+		d.fail(errors.New("elements overrun their size " + strconv.Itoa(l)))
+	}
+	return list
+}
+
+// formatString decodes the string field f of a struct decoded into m so far.
+func (d *decoder) formatString(m map[string]any, f *field) string {
+	start := d.off
+	s := d.formatText(m, f, &start)
+	d.span(ValueSpan, start, s)
+	return s
+}
+
+// formatText decodes the text of the string field f, setting start past
+// a length prefix.
+func (d *decoder) formatText(m map[string]any, f *field, start *int) string {
+	sf, order := f.str, f.node.order
+	switch {
+	case f.size != variable && sf.UTF16:
+		b := d.next(f.size)
+		units := make([]uint16, 0, len(b)/2)
+		for i := 0; i < len(b); i += 2 {
+			u := order.Uint16(b[i:])
+			if u == 0 {
+				break
+			}
+			units = append(units, u)
+		}
+		return string(utf16.Decode(units))
+	case f.size != variable:
+		b := d.next(f.size)
+		if i := bytes.IndexByte(b, 0); i >= 0 {
+			b = b[:i]
+		}
+		return string(b)
+	case sf.CString && sf.UTF16:
+		var units []uint16
+		for d.err == nil {
+			u := order.Uint16(d.next(2))
+			if u == 0 {
+				break
+			}
+			units = append(units, u)
+		}
+		return string(utf16.Decode(units))
+	case sf.CString:
+		i := bytes.IndexByte(d.buf[d.off:], 0)
+		if i < 0 {
+			d.fail(io.ErrUnexpectedEOF)
+			return ""
+		}
+		s := string(d.next(i))
+		d.next(1)
+		return s
+	}
+
+	// UTF-16 code units, length-prefixed or counted by an earlier field.
+	var l int
+	switch f.ref {
+	case wire.RefNone:
+		l = d.length(f.node)
+		*start = d.off
+	case wire.RefLen:
+		l = d.held(m[f.from])
+	default:
+		if l = d.held(m[f.from]); l%2 != 0 {
+			d.fail(errors.New("size " + strconv.Itoa(l) + " is not a multiple of the element size 2"))
+		}
+		l /= 2
+	}
+	if !d.checkLen(l, 2) {
+		return ""
+	}
+	b := d.next(2 * l)
+	units := make([]uint16, l)
+	for i := range units {
+		units[i] = order.Uint16(b[2*i:])
+	}
+	return string(utf16.Decode(units))
+}
@@ -0,0 +1,592 @@
+package schema
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	"github.com/go-perf/encoding/internal/wire"
+)
+
+var (
+	errStringNUL = errors.New("string contains a NUL character")
+	errUCS2      = errors.New("string has runes outside the UCS-2 range")
+	errRange     = errors.New("value out of range")
+)
+
+type encoder struct {
+	s     *Schema
+	buf   []byte
+	start int // len(buf) at the start of the value
+	path  []string
+	err   error
+}
+
+// fail records the first error encountered by e.
+func (e *encoder) fail(err error) {
+	if e.err == nil {
+		e.err = &Error{Path: joinPath(e.path), Offset: len(e.buf) - e.start, Err: err}
+	}
+}
+
+// mismatch records that v cannot be encoded as a value of the given kind.
+func (e *encoder) mismatch(v any, what string) {
+	e.fail(fmt.Errorf("cannot encode %T as %s", v, what))
+}
+
+func (e *encoder) push(step string) { e.path = append(e.path, step) }
+func (e *encoder) pop()             { e.path = e.path[:len(e.path)-1] }
+
+// next appends n zero bytes and returns them.
+func (e *encoder) next(n int) []byte {
+	l := len(e.buf)
+	for i := 0; i < n; i++ {
+		e.buf = append(e.buf, 0)
+	}
+	return e.buf[l:]
+}
+
+// align appends zero padding up to a multiple of align from start.
+func (e *encoder) align(start, align int) {
+	e.next(wire.AlignUp(len(e.buf)-start, align) - (len(e.buf) - start))
+}
+
+// uint encodes the low size bytes of x.
+func (e *encoder) uint(order byteOrder, size int, x uint64) {
+	b := e.next(size)
+	switch size {
+	case 1:
+		b[0] = byte(x)
+	case 2:
+		order.PutUint16(b, uint16(x))
+	case 4:
+		order.PutUint32(b, uint32(x))
+	default:
+		order.PutUint64(b, x)
+	}
+}
+
+func (e *encoder) value(n *node, v any) {
+	switch n.kind {
+	case kindBool:
+		b, ok := v.(bool)
+		if !ok {
+			e.mismatch(v, "bool")
+		}
+		if b {
+			e.next(1)[0] = 1
+		} else {
+			e.next(1)
+		}
+	case kindInt, kindUint:
+		x, _ := e.integer(v, n.kind == kindInt, 8*n.size)
+		e.uint(n.order, n.size, x)
+	case kindFloat:
+		f, ok := floatValue(v)
+		if !ok {
+			e.mismatch(v, "float")
+		}
+		e.float(n.order, n.size, f)
+	case kindComplex:
+		c, ok := complexValue(v)
+		if !ok {
+			e.mismatch(v, "complex")
+		}
+		e.float(n.order, n.size/2, real(c))
+		e.float(n.order, n.size/2, imag(c))
+	case kindString:
+		s, ok := v.(string)
+		if !ok {
+			e.mismatch(v, "string")
+		}
+		e.length(n, len(s))
+		e.buf = append(e.buf, s...)
+	case kindArray:
+		e.elems(n.elem, e.list(v, n.len))
+	case kindSlice:
+		l := e.list(v, -1)
+		e.length(n, len(l))
+		e.elems(n.elem, l)
+	case kindMap:
+		e.mapValue(n, v)
+	default:
+		e.structValue(n, v)
+	}
+}
+
+// float encodes f as a floating-point number of size bytes.
+func (e *encoder) float(order byteOrder, size int, f float64) {
+	if size == 4 {
+		e.uint(order, 4, uint64(math.Float32bits(float32(f))))
+	} else {
+		e.uint(order, 8, math.Float64bits(f))
+	}
+}
+
+// integer returns the integer v as an integer of the given number of bits,
+// in two's complement if signed.
+func (e *encoder) integer(v any, signed bool, bits int) (uint64, bool) {
+	x, neg, ok := intValue(v)
+	if !ok {
+		e.mismatch(v, "integer")
+		return 0, false
+	}
+	var fits bool
+	switch {
+	case !signed:
+		fits = !neg && (bits == 64 || x>>bits == 0)
+	case neg:
+		fits = bits == 64 || int64(x) >= -1<<(bits-1)
+	default:
+		fits = x < 1<<(bits-1)
+	}
+	if !fits {
+		e.fail(errRange)
+		return 0, false
+	}
+	return x, true
+}
+
+// intValue returns the integer v in two's complement, with neg set if it
+// is negative. It reports false if v is not an integer.
+func intValue(v any) (x uint64, neg, ok bool) {
+	switch v := v.(type) {
+	case int:
+		return uint64(v), v < 0, true
+	case int8:
+		return uint64(v), v < 0, true
+	case int16:
+		return uint64(v), v < 0, true
+	case int32:
+		return uint64(v), v < 0, true
+	case int64:
+		return uint64(v), v < 0, true
+	case uint:
+		return uint64(v), false, true
+	case uint8:
+		return uint64(v), false, true
+	case uint16:
+		return uint64(v), false, true
+	case uint32:
+		return uint64(v), false, true
+	case uint64:
+		return v, false, true
+	case uintptr:
+		return uint64(v), false, true
+	case float32:
+		return intValue(float64(v))
+	case float64:
+		switch {
+		case v != math.Trunc(v) || v < -1<<63 || v >= 1<<64:
+			return 0, false, false
+		case v < 0:
+			return uint64(int64(v)), true, true
+		}
+		return uint64(v), false, true
+	case json.Number:
+		if i, err := strconv.ParseInt(string(v), 0, 64); err == nil {
+			return uint64(i), i < 0, true
+		}
+		if u, err := strconv.ParseUint(string(v), 0, 64); err == nil {
+			return u, false, true
+		}
+		if f, err := v.Float64(); err == nil {
+			return intValue(f)
+		}
+	}
+	return 0, false, false
+}
+
+// uintValue returns the integer or bool v as a uint64, as the holders of
+// lengths and the fields of conditions are read.
+func uintValue(v any) (uint64, bool) {
+	if b, ok := v.(bool); ok {
+		if b {
+			return 1, true
+		}
+		return 0, true
+	}
+	x, _, ok := intValue(v)
+	return x, ok
+}
+
+// floatValue returns the number v as a float64.
+func floatValue(v any) (float64, bool) {
+	switch v := v.(type) {
+	case float64:
+		return v, true
+	case float32:
+		return float64(v), true
+	case json.Number:
+		f, err := v.Float64()
+		return f, err == nil
+	case string:
+		switch v {
+		case "NaN":
+			return math.NaN(), true
+		case "+Inf":
+			return math.Inf(1), true
+		case "-Inf":
+			return math.Inf(-1), true
+		}
+		return 0, false
+	}
+	if x, neg, ok := intValue(v); ok {
+		if neg {
+			return float64(int64(x)), true
+		}
+		return float64(x), true
+	}
+	return 0, false
+}
+
+// complexValue returns the complex number v, or [re, im] list v, as a complex128.
+func complexValue(v any) (complex128, bool) {
+	switch v := v.(type) {
+	case complex128:
+		return v, true
+	case complex64:
+		return complex128(v), true
+	case []any:
+		if len(v) == 2 {
+			re, ok1 := floatValue(v[0])
+			im, ok2 := floatValue(v[1])
+			return complex(re, im), ok1 && ok2
+		}
+	}
+	return 0, false
+}
+
+// length encodes the length prefix of a value of type n.
+func (e *encoder) length(n *node, l int) {
+	if size := e.s.LenSize; size < 8 && uint64(l)>>(8*size) != 0 {
+		e.fail(errLenOverflow)
+	}
+	e.uint(n.order, e.s.LenSize, uint64(l))
+}
+
+// list returns the elements of the array or slice v, of which there
+// must be want unless want is negative.
+func (e *encoder) list(v any, want int) []any {
+	l, ok := v.([]any)
+	if !ok && v != nil {
+		e.mismatch(v, "list")
+		return nil
+	}
+	if want >= 0 && len(l) != want {
+		e.fail(errors.New("list of " + strconv.Itoa(len(l)) + " elements for an array of " + strconv.Itoa(want)))
+		return nil
+	}
+	return l
+}
+
+// elems encodes the elements of type elem of a list.
+func (e *encoder) elems(elem *node, l []any) {
+	for i := 0; i < len(l) && e.err == nil; i++ {
+		e.push("[" + strconv.Itoa(i) + "]")
+		e.value(elem, l[i])
+		e.pop()
+	}
+}
+
+// mapValue encodes the count of entries of the map v, a list of
+// [key, value] pairs, then its entries sorted by encoded key, as the
+// reflect codec encodes maps.
+func (e *encoder) mapValue(n *node, v any) {
+	l := e.list(v, -1)
+	e.length(n, len(l))
+	if len(l) == 0 || e.err != nil {
+		return
+	}
+
+	type entry struct {
+		key []byte
+		val any
+	}
+	keys := &encoder{s: e.s, path: e.path}
+	entries := make([]entry, 0, len(l))
+	for i, p := range l {
+		pair, ok := p.([]any)
+		if !ok || len(pair) != 2 {
+			e.push("[" + strconv.Itoa(i) + "]")
+			e.mismatch(p, "map entry")
+			e.pop()
+			return
+		}
+		start := len(keys.buf)
+		keys.push("[" + strconv.Itoa(i) + "]")
+		keys.value(n.key, pair[0])
+		keys.pop()
+		entries = append(entries, entry{key: keys.buf[start:len(keys.buf):len(keys.buf)], val: pair[1]})
+	}
+	if keys.err != nil {
+		e.err = keys.err
+		return
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return bytes.Compare(entries[i].key, entries[j].key) < 0
+	})
+
+	for i := 0; i < len(entries) && e.err == nil; i++ {
+		if i > 0 && bytes.Equal(entries[i-1].key, entries[i].key) {
+			e.fail(errors.New("duplicate map key"))
+			return
+		}
+		e.buf = append(e.buf, entries[i].key...)
+		e.value(n.elem, entries[i].val)
+	}
+}
+
+func (e *encoder) structValue(n *node, v any) {
+	m, ok := v.(map[string]any)
+	if !ok {
+		e.mismatch(v, "struct")
+		return
+	}
+	start := len(e.buf)
+	for i := 0; i < len(n.fields) && e.err == nil; i++ {
+		f := &n.fields[i]
+		if f.cond != nil && !present(f.cond, m) {
+			continue
+		}
+		e.align(start, f.align)
+		if f.bits != nil {
+			e.bitFields(n, m, f)
+			continue
+		}
+		e.push("." + f.name)
+		switch {
+		case f.skip:
+			e.next(f.size)
+		case f.holds != wire.RefNone:
+			x, ok := e.held(n, m, f.name, f.holds, f.of)
+			if ok && f.node.size < 8 && x>>(8*f.node.size) != 0 {
+				e.fail(errRange)
+			}
+			e.uint(f.node.order, f.node.size, x)
+		default:
+			fv, ok := m[f.name]
+			switch {
+			case !ok:
+				e.fail(errors.New("missing field"))
+			case f.str != nil:
+				e.formatString(f, fv)
+			case f.ref == wire.RefTag:
+				e.variant(f.node, m[f.from], fv)
+			case f.ref != wire.RefNone && f.node.kind == kindString:
+				s, ok := fv.(string)
+				if !ok {
+					e.mismatch(fv, "string")
+				}
+				e.buf = append(e.buf, s...)
+			case f.ref != wire.RefNone:
+				e.elems(f.node.elem, e.list(fv, -1))
+			default:
+				e.value(f.node, fv)
+			}
+		}
+		e.pop()
+	}
+	e.align(start, n.align)
+}
+
+func (e *encoder) bitFields(n *node, m map[string]any, f *field) {
+	b := e.next(f.size)
+	for _, bf := range f.bits {
+		if bf.skip {
+			continue
+		}
+		e.push("." + bf.name)
+		var x uint64
+		switch fv, ok := m[bf.name]; {
+		case bf.holds != wire.RefNone:
+			x, _ = e.held(n, m, bf.name, bf.holds, bf.of)
+			if bf.width < 64 && x>>bf.width != 0 {
+				e.fail(errRange)
+			}
+		case !ok:
+			e.fail(errors.New("missing field"))
+		case bf.node.kind == kindBool:
+			if b, ok := fv.(bool); !ok {
+				e.mismatch(fv, "bool")
+			} else if b {
+				x = 1
+			}
+		default:
+			x, _ = e.integer(fv, bf.node.kind == kindInt, bf.width)
+		}
+		e.pop()
+		n.order.putBits(b, bf.off, bf.width, x)
+	}
+}
+
+// held returns the value to encode for the field name of the struct m
+// of type n, which holds ref of the later field of. The length of a
+// slice or string is only taken from it if the field is missing or zero:
+// otherwise they must match.
+func (e *encoder) held(n *node, m map[string]any, name string, ref wire.Ref, of string) (uint64, bool) {
+	given, ok := uintValue(m[name])
+	if !ok && m[name] != nil {
+		e.mismatch(m[name], "integer")
+		return 0, false
+	}
+	if ref == wire.RefTag {
+		if m[name] == nil {
+			e.fail(errors.New("missing variant tag"))
+			return 0, false
+		}
+		return given, true
+	}
+
+	var f *field
+	for i := range n.fields {
+		if n.fields[i].bits == nil && n.fields[i].name == of {
+			f = &n.fields[i]
+		}
+	}
+	var x uint64
+	switch v := m[of]; {
+	case v == nil:
+		// The field is absent, or missing and reported when encoded.
+	case f.node.kind == kindString:
+		s, ok := v.(string)
+		if !ok {
+			return 0, false
+		}
+		x = uint64(len(s))
+		if f.str != nil {
+			units, err := utf16Units(s, f.str.UCS2)
+			if err != nil {
+				return 0, false
+			}
+			x = uint64(len(units))
+			if ref == wire.RefSize {
+				x *= 2
+			}
+		}
+	case ref == wire.RefLen:
+		x = uint64(len(e.list(v, -1)))
+	default:
+		elems := &encoder{s: e.s}
+		elems.elems(f.node.elem, e.list(v, -1))
+		if elems.err != nil {
+			return 0, false
+		}
+		x = uint64(len(elems.buf))
+	}
+	if given != 0 && given != x {
+		e.fail(errors.New("value " + strconv.FormatUint(given, 10) + " but " + of + " needs " + strconv.FormatUint(x, 10)))
+		return 0, false
+	}
+	return x, true
+}
+
+// variant encodes the value v of the variant of the union n with the given tag.
+func (e *encoder) variant(n *node, tag, v any) {
+	x, _ := uintValue(tag)
+	vn, ok := n.variants[x]
+	if !ok {
+		e.fail(errors.New("unknown variant tag " + strconv.FormatUint(x, 10)))
+		return
+	}
+	e.value(vn, v)
+}
+
+// utf16Units returns the UTF-16 code units encoding s.
+func utf16Units(s string, ucs2 bool) ([]uint16, error) {
+	units := make([]uint16, 0, len(s))
+	for _, r := range s {
+		if r >= 0x10000 {
+			if ucs2 {
+				return nil, errUCS2
+			}
+			r1, r2 := utf16.EncodeRune(r)
+			units = append(units, uint16(r1))
+			r = r2
+		}
+		units = append(units, uint16(r))
+	}
+	return units, nil
+}
+
+// formatString encodes v as the string field f.
+func (e *encoder) formatString(f *field, v any) {
+	s, ok := v.(string)
+	if !ok {
+		e.mismatch(v, "string")
+		return
+	}
+	sf, order := f.str, f.node.order
+	if !sf.UTF16 {
+		if strings.IndexByte(s, 0) >= 0 {
+			e.fail(errStringNUL)
+			return
+		}
+		if f.size == variable {
+			e.buf = append(append(e.buf, s...), 0)
+			return
+		}
+		max := f.size
+		if sf.CString {
+			max--
+		}
+		if len(s) > max {
+			if !sf.Truncate {
+				e.fail(errors.New("string of " + strconv.Itoa(len(s)) + " bytes overflows fixed=" + strconv.Itoa(f.size)))
+				return
+			}
+			for max > 0 && !utf8.RuneStart(s[max]) {
+				max--
+			}
+			s = s[:max]
+		}
+		copy(e.next(f.size), s)
+		return
+	}
+
+	units, err := utf16Units(s, sf.UCS2)
+	if err != nil {
+		e.fail(err)
+		return
+	}
+	if (f.size != variable || sf.CString) && strings.IndexByte(s, 0) >= 0 {
+		e.fail(errStringNUL)
+		return
+	}
+	switch {
+	case f.size != variable:
+		max := f.size / 2
+		if sf.CString {
+			max--
+		}
+		if len(units) > max {
+			if !sf.Truncate {
+				e.fail(errors.New("string of " + strconv.Itoa(2*len(units)) + " bytes overflows fixed=" + strconv.Itoa(f.size)))
+				return
+			}
+			if max > 0 && utf16.IsSurrogate(rune(units[max-1])) && units[max-1] < 0xdc00 {
+				max-- // Do not split a surrogate pair.
+			}
+			units = units[:max]
+		}
+		b := e.next(f.size)
+		for i, u := range units {
+			order.PutUint16(b[2*i:], u)
+		}
+		return
+	case sf.CString:
+		units = append(units, 0)
+	case f.ref == wire.RefNone:
+		e.length(f.node, len(units))
+	}
+	for _, u := range units {
+		e.uint(order, 2, uint64(u))
+	}
+}
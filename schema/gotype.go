@@ -0,0 +1,107 @@
+package schema
+
+import (
+	"errors"
+	"reflect"
+	"strconv"
+)
+
+// FromType returns the schema of the Go type t, which describes values of
+// t as the reflect codecs of litend and bigend encode them. Its struct
+// types are named after the Go types; set its Order, IntSize, LenSize and
+// NaturalAlign as the options of the Codec. Interface fields are not
+// supported, since the variants registered for them cannot be listed.
+func FromType(t reflect.Type) (*Schema, error) {
+	g := &goTypes{names: make(map[reflect.Type]string), used: make(map[string]bool), types: make(map[string]*Type)}
+	root, err := g.typ(t)
+	if err != nil {
+		return nil, err
+	}
+	return &Schema{Types: g.types, Root: root}, nil
+}
+
+// goTypes converts Go types to schema types.
+type goTypes struct {
+	names map[reflect.Type]string // names of the struct types converted so far
+	used  map[string]bool
+	types map[string]*Type
+}
+
+func (g *goTypes) typ(t reflect.Type) (*Type, error) {
+	for n := 0; t.Kind() == reflect.Pointer; n++ {
+		if n == 16 {
+			return nil, errors.New("schema: invalid type " + t.String())
+		}
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.Bool,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64, reflect.Complex64, reflect.Complex128, reflect.String:
+		return &Type{Name: t.Kind().String()}, nil
+
+	case reflect.Array:
+		elem, err := g.typ(t.Elem())
+		if err != nil {
+			return nil, err
+		}
+		return &Type{Array: elem, Len: t.Len()}, nil
+
+	case reflect.Slice:
+		elem, err := g.typ(t.Elem())
+		if err != nil {
+			return nil, err
+		}
+		return &Type{Slice: elem}, nil
+
+	case reflect.Map:
+		key, err := g.typ(t.Key())
+		if err != nil {
+			return nil, err
+		}
+		elem, err := g.typ(t.Elem())
+		if err != nil {
+			return nil, err
+		}
+		return &Type{Map: elem, Key: key}, nil
+
+	case reflect.Struct:
+		if t.Name() == "" {
+			return g.structType(t, &Type{Fields: []Field{}})
+		}
+		if name, ok := g.names[t]; ok {
+			return &Type{Name: name}, nil
+		}
+		name := t.String()
+		for i := 2; g.used[name] || g.scalar(name); i++ {
+			name = t.String() + "#" + strconv.Itoa(i)
+		}
+		g.names[t], g.used[name] = name, true
+		st := &Type{Fields: []Field{}}
+		g.types[name] = st
+		if _, err := g.structType(t, st); err != nil {
+			return nil, err
+		}
+		return &Type{Name: name}, nil
+	}
+	return nil, errors.New("schema: unsupported type " + t.String())
+}
+
+// structType adds the fields of the struct type t to st.
+func (g *goTypes) structType(t reflect.Type, st *Type) (*Type, error) {
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		ft, err := g.typ(sf.Type)
+		if err != nil {
+			return nil, err
+		}
+		st.Fields = append(st.Fields, Field{Name: sf.Name, Type: ft, Tag: sf.Tag.Get("binary")})
+	}
+	return st, nil
+}
+
+// scalar reports whether name is the name of a scalar type.
+func (g *goTypes) scalar(name string) bool {
+	return (&planner{s: &Schema{}}).scalar(name, nil) != nil
+}
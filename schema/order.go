@@ -0,0 +1,47 @@
+package schema
+
+import (
+	"github.com/go-perf/encoding/bigend"
+	"github.com/go-perf/encoding/internal/wire"
+	"github.com/go-perf/encoding/litend"
+)
+
+// byteOrder is the byte and bit order of a type.
+type byteOrder interface {
+	Uint16([]byte) uint16
+	Uint32([]byte) uint32
+	Uint64([]byte) uint64
+	PutUint16([]byte, uint16)
+	PutUint32([]byte, uint32)
+	PutUint64([]byte, uint64)
+
+	// getBits returns width bits of b starting at bit off.
+	getBits(b []byte, off, width int) uint64
+	// putBits stores the low width bits of x into b starting at bit off.
+	// The destination bits must be zero.
+	putBits(b []byte, off, width int, x uint64)
+}
+
+// littleEndian packs bit fields LSB-first, as litend does.
+type littleEndian struct{}
+
+func (littleEndian) Uint16(b []byte) uint16                     { return litend.Uint16(b) }
+func (littleEndian) Uint32(b []byte) uint32                     { return litend.Uint32(b) }
+func (littleEndian) Uint64(b []byte) uint64                     { return litend.Uint64(b) }
+func (littleEndian) PutUint16(b []byte, v uint16)               { litend.PutUint16(b, v) }
+func (littleEndian) PutUint32(b []byte, v uint32)               { litend.PutUint32(b, v) }
+func (littleEndian) PutUint64(b []byte, v uint64)               { litend.PutUint64(b, v) }
+func (littleEndian) getBits(b []byte, off, width int) uint64    { return wire.GetBitsLSB(b, off, width) }
+func (littleEndian) putBits(b []byte, off, width int, x uint64) { wire.PutBitsLSB(b, off, width, x) }
+
+// bigEndian packs bit fields MSB-first, as bigend does.
+type bigEndian struct{}
+
+func (bigEndian) Uint16(b []byte) uint16                     { return bigend.Uint16(b) }
+func (bigEndian) Uint32(b []byte) uint32                     { return bigend.Uint32(b) }
+func (bigEndian) Uint64(b []byte) uint64                     { return bigend.Uint64(b) }
+func (bigEndian) PutUint16(b []byte, v uint16)               { bigend.PutUint16(b, v) }
+func (bigEndian) PutUint32(b []byte, v uint32)               { bigend.PutUint32(b, v) }
+func (bigEndian) PutUint64(b []byte, v uint64)               { bigend.PutUint64(b, v) }
+func (bigEndian) getBits(b []byte, off, width int) uint64    { return wire.GetBitsMSB(b, off, width) }
+func (bigEndian) putBits(b []byte, off, width int, x uint64) { wire.PutBitsMSB(b, off, width, x) }
@@ -0,0 +1,553 @@
+package schema
+
+import (
+	"errors"
+	"strconv"
+
+	"github.com/go-perf/encoding/internal/wire"
+)
+
+// kind is the kind of a planned type.
+type kind uint8
+
+const (
+	kindBool kind = iota
+	kindInt
+	kindUint
+	kindFloat
+	kindComplex
+	kindString
+	kindArray
+	kindSlice
+	kindMap
+	kindStruct
+	kindUnion
+)
+
+// variable is the size of types whose encoded size depends on the value.
+const variable = -2
+
+// node is the encoding plan of a type.
+type node struct {
+	kind   kind
+	native bool // int or uint, of Schema.IntSize bytes
+	order  byteOrder
+	size   int // encoded size, or variable
+	min    int // minimum encoded size
+	align  int // alignment: the size is padded to a multiple of it
+
+	elem     *node // element type of arrays and slices, value type of maps
+	key      *node // key type of maps
+	len      int   // length of arrays
+	fields   []field
+	variants map[uint64]*node // variants of unions, by tag
+}
+
+// field is a step of a struct plan: either a regular struct field or
+// a run of consecutive bit fields sharing the same bytes.
+type field struct {
+	name  string
+	node  *node // unused for bit field runs
+	skip  bool  // blank (_) field: zeroed on encode, skipped on decode
+	bits  []bitField
+	size  int // encoded size in bytes, or variable
+	align int // the field is padded to a multiple of align from the start of the struct
+
+	cond *wire.Cond         // if= or since= field: presence condition, or nil
+	str  *wire.StringFormat // fixed=, cstring, utf16 or ucs2 string field: its encoding, or nil
+
+	ref   wire.Ref // union=, len= or size= field: what the field from holds
+	from  string   // name of the earlier field holding the variant tag or length
+	holds wire.Ref // what the field holds of the later field of
+	of    string
+}
+
+// bitField is a struct field declared with a bits= option.
+type bitField struct {
+	name  string
+	node  *node
+	skip  bool
+	off   int // offset in bits from the start of the run
+	width int
+	holds wire.Ref
+	of    string
+}
+
+// namedKey identifies the plan of a named type in a byte order.
+type namedKey struct {
+	name  string
+	order byteOrder
+}
+
+// planner plans the types of a schema. It tracks the named types being
+// planned, so that recursive types terminate.
+type planner struct {
+	s     *Schema
+	types map[namedKey]*node
+	stack []*node        // named types being planned, outermost first
+	cut   int            // len(stack) when the innermost slice, map or union was entered
+	later []func() error // checks made once all types are planned
+}
+
+func errorf(path, msg string) error {
+	return errors.New("schema: " + path + ": " + msg)
+}
+
+// order returns the byte order called name, or def if name is empty.
+func (p *planner) order(name string, def byteOrder) (byteOrder, error) {
+	switch name {
+	case "":
+		return def, nil
+	case "little":
+		return littleEndian{}, nil
+	case "big":
+		return bigEndian{}, nil
+	}
+	return nil, errors.New("schema: unknown order " + strconv.Quote(name))
+}
+
+// hasLen reports whether the schema encodes length-prefixed values.
+func (p *planner) hasLen() bool {
+	switch p.s.LenSize {
+	case 1, 2, 4, 8:
+		return true
+	}
+	return false
+}
+
+// node plans the type t in the byte order of the enclosing type.
+func (p *planner) node(t *Type, order byteOrder, path string) (*node, error) {
+	if t == nil {
+		return nil, errorf(path, "missing type")
+	}
+	order, err := p.order(t.Order, order)
+	if err != nil {
+		return nil, err
+	}
+	set := 0
+	for _, ok := range []bool{t.Name != "", t.Array != nil, t.Slice != nil, t.Map != nil, t.Union != nil, t.Fields != nil} {
+		if ok {
+			set++
+		}
+	}
+	if set > 1 || t.Len != 0 && t.Array == nil || t.Key != nil && t.Map == nil {
+		return nil, errorf(path, "ambiguous type")
+	}
+
+	switch {
+	case t.Name != "":
+		return p.named(t.Name, order, path)
+
+	case t.Array != nil:
+		if t.Len < 0 {
+			return nil, errorf(path, "negative array length")
+		}
+		elem, err := p.node(t.Array, order, path+"[]")
+		if err != nil {
+			return nil, err
+		}
+		n := &node{kind: kindArray, order: order, elem: elem, len: t.Len, size: variable, align: elem.align}
+		if elem.size >= 0 {
+			n.size = elem.size * t.Len
+		}
+		n.min = elem.min * t.Len
+		p.require(elem, path+"[]")
+		return n, nil
+
+	case t.Slice != nil:
+		elem, err := p.nested(t.Slice, order, path+"[]")
+		if err != nil {
+			return nil, err
+		}
+		return p.prefixed(&node{kind: kindSlice, order: order, elem: elem}), nil
+
+	case t.Map != nil:
+		if t.Key == nil {
+			return nil, errorf(path, "map without a key type")
+		}
+		key, err := p.nested(t.Key, order, path+"[key]")
+		if err != nil {
+			return nil, err
+		}
+		elem, err := p.nested(t.Map, order, path+"[]")
+		if err != nil {
+			return nil, err
+		}
+		return p.prefixed(&node{kind: kindMap, order: order, key: key, elem: elem}), nil
+
+	case t.Union != nil:
+		n := &node{kind: kindUnion, order: order, size: variable, align: 1, variants: make(map[uint64]*node)}
+		for _, v := range t.Union {
+			vpath := path + "(" + strconv.FormatUint(v.Tag, 10) + ")"
+			if _, ok := n.variants[v.Tag]; ok {
+				return nil, errorf(vpath, "duplicate variant tag")
+			}
+			vn, err := p.nested(v.Type, order, vpath)
+			if err != nil {
+				return nil, err
+			}
+			n.variants[v.Tag] = vn
+		}
+		return n, nil
+	}
+	return p.structNode(t, order, path)
+}
+
+// nested plans the type t of the elements of a slice or map, or of
+// a variant, which may refer to the named types being planned.
+func (p *planner) nested(t *Type, order byteOrder, path string) (*node, error) {
+	cut := p.cut
+	p.cut = len(p.stack)
+	n, err := p.node(t, order, path)
+	p.cut = cut
+	if err != nil {
+		return nil, err
+	}
+	p.require(n, path)
+	return n, nil
+}
+
+// prefixed completes the plan n of a length-prefixed string, slice or map.
+func (p *planner) prefixed(n *node) *node {
+	n.size, n.min, n.align = variable, p.s.LenSize, 1
+	if p.s.NaturalAlign && p.hasLen() {
+		n.align = p.s.LenSize
+	}
+	return n
+}
+
+// named plans the named type name.
+func (p *planner) named(name string, order byteOrder, path string) (*node, error) {
+	if n := p.scalar(name, order); n != nil {
+		if n.native && n.size == 0 {
+			return nil, errorf(path, name+" needs intSize 4 or 8")
+		}
+		return n, nil
+	}
+	def, ok := p.s.Types[name]
+	if !ok {
+		return nil, errorf(path, "unknown type "+strconv.Quote(name))
+	}
+
+	key := namedKey{name, order}
+	if n, ok := p.types[key]; ok {
+		for i, pn := range p.stack {
+			if pn == n && i >= p.cut {
+				return nil, errorf(path, "type "+name+" contains itself")
+			}
+		}
+		return n, nil
+	}
+
+	// Until it is planned, the type is seen as a recursive struct is
+	// by the reflect codec: of variable size, without alignment.
+	n := &node{kind: kindStruct, order: order, size: variable, align: 1}
+	p.types[key] = n
+	p.stack = append(p.stack, n)
+	m, err := p.node(def, order, name)
+	p.stack = p.stack[:len(p.stack)-1]
+	if err != nil {
+		return nil, err
+	}
+	*n = *m
+	return n, nil
+}
+
+// scalar returns the plan of the scalar type name, or nil if there is none.
+func (p *planner) scalar(name string, order byteOrder) *node {
+	n := &node{order: order}
+	switch name {
+	case "bool":
+		n.kind, n.size = kindBool, 1
+	case "int8", "int16", "int32", "int64":
+		n.kind = kindInt
+		n.size, _ = strconv.Atoi(name[3:])
+		n.size /= 8
+	case "uint8", "uint16", "uint32", "uint64":
+		n.kind = kindUint
+		n.size, _ = strconv.Atoi(name[4:])
+		n.size /= 8
+	case "int", "uint":
+		n.kind, n.native = kindInt, true
+		if name == "uint" {
+			n.kind = kindUint
+		}
+		if p.s.IntSize == 4 || p.s.IntSize == 8 {
+			n.size = p.s.IntSize
+		}
+	case "float32":
+		n.kind, n.size = kindFloat, 4
+	case "float64":
+		n.kind, n.size = kindFloat, 8
+	case "complex64":
+		n.kind, n.size = kindComplex, 8
+	case "complex128":
+		n.kind, n.size = kindComplex, 16
+	case "string":
+		return p.prefixed(&node{kind: kindString, order: order})
+	default:
+		return nil
+	}
+	n.min, n.align = n.size, 1
+	if p.s.NaturalAlign {
+		n.align = n.size
+		if n.kind == kindComplex {
+			n.align /= 2
+		}
+	}
+	return n
+}
+
+// require records that values of n are encoded on their own, which
+// rules out unions, and length-prefixed values without Schema.LenSize.
+// The check is made once all types are planned.
+func (p *planner) require(n *node, path string) {
+	p.later = append(p.later, func() error {
+		switch {
+		case n.kind == kindUnion:
+			return errorf(path, "union outside of a union= field")
+		case !p.hasLen() && (n.kind == kindString || n.kind == kindSlice || n.kind == kindMap):
+			return errorf(path, "length prefix needs lenSize 1, 2, 4 or 8")
+		}
+		return nil
+	})
+}
+
+func (p *planner) structNode(t *Type, order byteOrder, path string) (*node, error) {
+	n := &node{kind: kindStruct, order: order, align: 1}
+	names := make(map[string]bool)
+	for _, sf := range t.Fields {
+		fpath := path + "." + sf.Name
+		skip := sf.Name == "_"
+		if sf.Name == "" {
+			return nil, errorf(path, "field without a name")
+		}
+		if names[sf.Name] && !skip {
+			return nil, errorf(fpath, "duplicate field")
+		}
+		names[sf.Name] = true
+		tag, ok := wire.ParseTag(sf.Tag)
+		if !ok {
+			return nil, errorf(fpath, "invalid options "+strconv.Quote(sf.Tag))
+		}
+		fn, err := p.node(sf.Type, order, fpath)
+		if err != nil {
+			return nil, err
+		}
+
+		if tag.Bits != 0 {
+			if !isBitFieldType(fn, tag.Bits) || tag.Align != 0 {
+				return nil, errorf(fpath, "invalid bit field")
+			}
+			last := len(n.fields) - 1
+			if last < 0 || n.fields[last].bits == nil {
+				n.fields = append(n.fields, field{bits: []bitField{}, align: 1})
+				last++
+			}
+			run := &n.fields[last]
+			off := 0
+			if k := len(run.bits); k > 0 {
+				off = run.bits[k-1].off + run.bits[k-1].width
+			}
+			run.bits = append(run.bits, bitField{name: sf.Name, node: fn, skip: skip, off: off, width: tag.Bits})
+			run.size = (off + tag.Bits + 7) / 8
+			continue
+		}
+
+		if tag.Cond != nil && !n.isConditionField(tag.Cond.On) {
+			return nil, errorf(fpath, tag.Cond.On+" is not an earlier integer or bool field")
+		}
+
+		if tag.Ref != wire.RefNone {
+			if !n.setHolder(tag.From, tag.Ref, sf.Name) {
+				return nil, errorf(fpath, tag.From+" is not an earlier integer field free to hold its length or tag")
+			}
+			if skip || !canRef(fn, tag.Ref) {
+				return nil, errorf(fpath, "invalid union=, len= or size= field")
+			}
+			n.fields = append(n.fields, field{name: sf.Name, node: fn, size: variable, align: p.fieldAlign(fn, &tag),
+				cond: tag.Cond, str: tag.Str, ref: tag.Ref, from: tag.From})
+			continue
+		}
+
+		var s int
+		switch {
+		case tag.Str == nil:
+			p.require(fn, fpath)
+			s = fn.size
+		case fn.kind != kindString:
+			return nil, errorf(fpath, "string options on a field of another type")
+		case tag.Str.Fixed != 0:
+			s = tag.Str.Fixed
+		case tag.Str.CString:
+			s = variable
+		default:
+			p.require(fn, fpath)
+			s = fn.size
+		}
+		if s == variable && skip {
+			return nil, errorf(fpath, "blank field of variable size")
+		}
+		n.fields = append(n.fields, field{name: sf.Name, node: fn, skip: skip, size: s, align: p.fieldAlign(fn, &tag),
+			cond: tag.Cond, str: tag.Str})
+	}
+
+	for i := range n.fields {
+		f := &n.fields[i]
+		if f.bits != nil && p.s.NaturalAlign {
+			if a := layoutBits(f, n.size); a > n.align {
+				n.align = a
+			}
+		}
+		if f.align > n.align {
+			n.align = f.align
+		}
+		if f.ref != wire.RefNone || f.cond != nil {
+			n.size = variable
+			continue
+		}
+		n.min = wire.AlignUp(n.min, f.align)
+		if f.size == variable {
+			n.size = variable
+			if f.str != nil && f.str.CString {
+				n.min += f.str.Unit() // NUL terminator
+			} else {
+				n.min += f.node.min
+			}
+			continue
+		}
+		n.min += f.size
+		if n.size != variable {
+			n.size = wire.AlignUp(n.size, f.align) + f.size
+		}
+	}
+	n.min = wire.AlignUp(n.min, n.align)
+	if n.size != variable {
+		n.size = wire.AlignUp(n.size, n.align)
+	}
+	return n, nil
+}
+
+// fieldAlign returns the alignment of a struct field of type n with the
+// tag options opts, other than a bit field.
+func (p *planner) fieldAlign(n *node, opts *wire.Tag) int {
+	a := 1
+	switch {
+	case !p.s.NaturalAlign:
+		if opts.Ref == wire.RefNone && opts.Str == nil {
+			a = n.align
+		}
+	case opts.Str != nil && opts.Str.Fixed == 0 && !opts.Str.CString && opts.Ref == wire.RefNone:
+		a = n.align // length prefix
+	case opts.Str != nil:
+		a = opts.Str.Unit()
+	case opts.Ref == wire.RefLen || opts.Ref == wire.RefSize:
+		if n.kind == kindSlice {
+			a = n.elem.align
+		}
+	case opts.Ref == wire.RefNone:
+		a = n.align
+	}
+	if opts.Align > a {
+		a = opts.Align
+	}
+	return a
+}
+
+// layoutBits lays out the run of bit fields f at offset off, or at an
+// unknown offset if off is variable, so that no bit field straddles a
+// unit of the size of its type, as C compilers do. It returns the
+// alignment the run gives to the struct.
+func layoutBits(f *field, off int) int {
+	run, align := wire.NewBitRun(off), 1
+	for i := range f.bits {
+		bf := &f.bits[i]
+		size := bf.node.size
+		bf.off = run.Add(bf.width, size)
+		if !bf.skip && size > align {
+			align = size
+		}
+	}
+	f.size = run.Size()
+	return align
+}
+
+// isBitFieldType reports whether a field of type n can hold a bit field of the given width.
+func isBitFieldType(n *node, width int) bool {
+	switch n.kind {
+	case kindBool:
+		return width == 1
+	case kindInt, kindUint:
+		return !n.native && width <= 8*n.size
+	}
+	return false
+}
+
+// isInteger reports whether n is an integer type.
+func isInteger(n *node) bool {
+	return n.kind == kindInt || n.kind == kindUint
+}
+
+// isConditionField reports whether the field of n named name is an
+// earlier integer or bool field a condition can depend on.
+func (n *node) isConditionField(name string) bool {
+	for _, f := range n.fields {
+		for _, bf := range f.bits {
+			if !bf.skip && bf.name == name {
+				return true
+			}
+		}
+		if f.bits != nil || f.skip || f.ref != wire.RefNone || f.name != name {
+			continue
+		}
+		return isInteger(f.node) || f.node.kind == kindBool
+	}
+	return false
+}
+
+// present reports whether the field with condition c is present in the
+// struct m decoded so far.
+func present(c *wire.Cond, m map[string]any) bool {
+	x, _ := uintValue(m[c.On])
+	return c.Present(x)
+}
+
+// setHolder marks the field of n named name as holding ref of the later
+// field of. It reports false if there is no such integer field or if it
+// already holds something.
+func (n *node) setHolder(name string, ref wire.Ref, of string) bool {
+	for i := range n.fields {
+		f := &n.fields[i]
+		for j := range f.bits {
+			bf := &f.bits[j]
+			if bf.name != name {
+				continue
+			}
+			if bf.skip || bf.holds != wire.RefNone || bf.node.kind == kindBool {
+				return false
+			}
+			bf.holds, bf.of = ref, of
+			return true
+		}
+		if f.bits != nil || f.ref != wire.RefNone || f.name != name {
+			continue
+		}
+		if !isInteger(f.node) || f.skip || f.cond != nil || f.holds != wire.RefNone {
+			return false
+		}
+		f.holds, f.of = ref, of
+		return true
+	}
+	return false
+}
+
+// canRef reports whether a field of type n can be tagged with ref.
+func canRef(n *node, ref wire.Ref) bool {
+	switch n.kind {
+	case kindUnion:
+		return ref == wire.RefTag
+	case kindString, kindSlice:
+		return ref != wire.RefTag
+	}
+	return false
+}
@@ -0,0 +1,277 @@
+// Package schema decodes and encodes binary data described by a schema
+// given as data, such as JSON, rather than by Go types.
+//
+// A schema describes the formats of the struct types of the litend and
+// bigend packages: its types are numbers, bools, strings, arrays, slices,
+// maps, structs and unions of variants, and its struct fields take the
+// options of the `binary:"..."` struct tag, with the same meaning. So a
+// schema and a Go struct can describe the same format:
+//
+//	{
+//		"order": "big",
+//		"lenSize": 2,
+//		"types": {
+//			"Item": {"fields": [
+//				{"name": "ID", "type": "uint32"},
+//				{"name": "Name", "type": "string", "binary": "fixed=8"}
+//			]}
+//		},
+//		"root": {"fields": [
+//			{"name": "Flags", "type": "uint8", "binary": "bits=3"},
+//			{"name": "_", "type": "uint8", "binary": "bits=5"},
+//			{"name": "N", "type": "uint16"},
+//			{"name": "Items", "type": {"slice": "Item"}, "binary": "len=N"},
+//			{"name": "Sum", "type": "uint64", "binary": "if=Flags&1"}
+//		]}
+//	}
+//
+// encodes like
+//
+//	type Item struct {
+//		ID   uint32
+//		Name string `binary:"fixed=8"`
+//	}
+//
+//	type Root struct {
+//		Flags uint8 `binary:"bits=3"`
+//		_     uint8 `binary:"bits=5"`
+//		N     uint16
+//		Items []Item `binary:"len=N"`
+//		Sum   uint64 `binary:"if=Flags&1"`
+//	}
+//
+// with bigend.Codec{LenSize: 2}. The order of a type applies to its
+// contents too, so the byte order can change within a value.
+//
+// Decoded values are trees of bool, int64 for signed integers, uint64 for
+// unsigned integers, float64, complex128, string, []any for arrays and
+// slices, []any of [key, value] pairs for maps, in encoding order, and
+// map[string]any for structs. A union holds the value of its variant,
+// whose tag is in the field named by union=. Absent if= and since= fields,
+// and blank (_) fields, are left out of structs. Encoding accepts the same
+// trees, with any Go integer type, integral float64 and json.Number for
+// integers, and fills in the fields holding lengths and sizes when they
+// are missing or zero. Since JSON has no such values, it also accepts
+// [re, im] lists for complex numbers, and the strings NaN, +Inf and -Inf
+// for floats.
+package schema
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"sync"
+)
+
+// Schema describes a binary format.
+type Schema struct {
+	// Order is the byte order of the types without an order of their
+	// own: "little", the default, or "big".
+	Order string `json:"order,omitempty"`
+
+	// IntSize, LenSize and NaturalAlign are as in litend.Codec.
+	IntSize      int  `json:"intSize,omitempty"`
+	LenSize      int  `json:"lenSize,omitempty"`
+	NaturalAlign bool `json:"naturalAlign,omitempty"`
+
+	// Types are the named types the schema refers to.
+	Types map[string]*Type `json:"types,omitempty"`
+
+	// Root is the type of the encoded values. If it is a slice, its
+	// length is not encoded, and decoding it consumes the whole input.
+	Root *Type `json:"root"`
+
+	once sync.Once
+	root *node
+	err  error
+}
+
+// Type is a type of a schema. It is one of a named type, an array, a slice,
+// a map, a struct or a union, as set by the first non-empty one of
+// Name, Array, Slice, Map, Fields and Union. In JSON, a type that only
+// has a Name can be written as that name.
+type Type struct {
+	// Name is bool, int8, int16, int32, int64, uint8, uint16, uint32,
+	// uint64, int, uint, float32, float64, complex64, complex128, string,
+	// or a key of Schema.Types.
+	Name string `json:"type,omitempty"`
+
+	// Order, if set, is the byte order of the type and its contents.
+	Order string `json:"order,omitempty"`
+
+	Array *Type     `json:"array,omitempty"` // element type of an array
+	Len   int       `json:"len,omitempty"`   // length of an array
+	Slice *Type     `json:"slice,omitempty"` // element type of a slice
+	Map   *Type     `json:"map,omitempty"`   // value type of a map
+	Key   *Type     `json:"key,omitempty"`   // key type of a map
+	Union []Variant `json:"union,omitempty"` // variants of a union
+
+	Fields []Field `json:"fields,omitempty"` // fields of a struct; may be empty
+}
+
+// Field is a struct field.
+type Field struct {
+	Name string `json:"name"` // the name, or _ for a blank field
+	Type *Type  `json:"type"`
+	Tag  string `json:"binary,omitempty"` // options of a `binary:"..."` tag
+}
+
+// Variant is a variant of a union: a field of the union type tagged
+// union=Kind holds the variant whose Tag is the value of the field Kind.
+type Variant struct {
+	Tag  uint64 `json:"tag"`
+	Type *Type  `json:"type"`
+}
+
+func (t *Type) UnmarshalJSON(data []byte) error {
+	if len(data) > 0 && data[0] == '"' {
+		*t = Type{}
+		return json.Unmarshal(data, &t.Name)
+	}
+	type plain Type
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	return dec.Decode((*plain)(t))
+}
+
+func (t *Type) MarshalJSON() ([]byte, error) {
+	if t.Order == "" && t.Array == nil && t.Len == 0 && t.Slice == nil && t.Map == nil && t.Key == nil &&
+		t.Union == nil && t.Fields == nil {
+		return json.Marshal(t.Name)
+	}
+	type plain Type
+	return json.Marshal((*plain)(t))
+}
+
+// Parse parses a schema in JSON.
+func Parse(data []byte) (*Schema, error) {
+	s := new(Schema)
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(s); err != nil {
+		return nil, errors.New("schema: " + err.Error())
+	}
+	if err := s.compile(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// compile checks s and plans its encoding, once.
+func (s *Schema) compile() error {
+	s.once.Do(func() {
+		if s.Root == nil {
+			s.err = errors.New("schema: no root type")
+			return
+		}
+		p := &planner{s: s, types: make(map[namedKey]*node)}
+		order, err := p.order(s.Order, littleEndian{})
+		if err != nil {
+			s.err = err
+			return
+		}
+		if s.root, err = p.node(s.Root, order, "root"); err != nil {
+			s.err = err
+			return
+		}
+		if s.root.kind != kindSlice {
+			p.require(s.root, "root")
+		}
+		for _, check := range p.later {
+			if err := check(); err != nil {
+				s.err = err
+				return
+			}
+		}
+	})
+	return s.err
+}
+
+// Decode decodes a value from the start of b. It returns the value and
+// the number of bytes it was encoded with.
+func (s *Schema) Decode(b []byte) (any, int, error) {
+	return s.DecodeSpans(b, nil)
+}
+
+// DecodeSpans is like Decode, and also calls fn with the spans of the
+// input, in order. The bit fields of a run have spans of the same bytes.
+func (s *Schema) DecodeSpans(b []byte, fn func(Span)) (any, int, error) {
+	if err := s.compile(); err != nil {
+		return nil, 0, err
+	}
+	d := &decoder{s: s, buf: b, visit: fn}
+	var v any
+	if s.root.kind == kindSlice {
+		v = d.rest(s.root.elem)
+	} else {
+		v = d.value(s.root)
+	}
+	if d.err != nil {
+		return nil, d.off, d.err
+	}
+	return v, d.off, nil
+}
+
+// A Span is the encoding of a number, bool, string or bit field, of a
+// length prefix, or of padding, in the input of DecodeSpans.
+type Span struct {
+	Kind   SpanKind
+	Path   string // path of the value, such as Items[2].Name
+	Offset int    // offset of the first byte
+	Size   int    // size in bytes
+
+	// BitOffset and Bits are the position and width of a bit field in
+	// the bits of its bytes, in the bit order of its byte order.
+	BitOffset, Bits int
+
+	Value any // decoded value, or the length; nil for padding
+}
+
+// SpanKind is the kind of a Span.
+type SpanKind uint8
+
+const (
+	ValueSpan   SpanKind = iota // a number, bool, string or bit field
+	LengthSpan                  // the length prefix of a string, slice or map
+	PaddingSpan                 // alignment padding or a blank (_) field
+)
+
+// Encode returns the encoding of the value v.
+func (s *Schema) Encode(v any) ([]byte, error) {
+	return s.Append(nil, v)
+}
+
+// Append appends the encoding of the value v to dst.
+func (s *Schema) Append(dst []byte, v any) ([]byte, error) {
+	if err := s.compile(); err != nil {
+		return dst, err
+	}
+	e := &encoder{s: s, buf: dst, start: len(dst)}
+	if s.root.kind == kindSlice {
+		e.elems(s.root.elem, e.list(v, -1))
+	} else {
+		e.value(s.root, v)
+	}
+	if e.err != nil {
+		return dst, e.err
+	}
+	return e.buf, nil
+}
+
+// Error reports a value that cannot be decoded or encoded.
+type Error struct {
+	Path   string // path of the value, such as Items[2].Name
+	Offset int    // offset of the value in the encoding
+	Err    error
+}
+
+func (e *Error) Error() string {
+	msg := "schema: "
+	if e.Path != "" {
+		msg += e.Path + ": "
+	}
+	return msg + e.Err.Error() + " at offset " + strconv.Itoa(e.Offset)
+}
+
+func (e *Error) Unwrap() error { return e.Err }
@@ -0,0 +1,348 @@
+package schema
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/go-perf/encoding/bigend"
+	"github.com/go-perf/encoding/litend"
+)
+
+type testItem struct {
+	ID   uint32
+	Name string `binary:"fixed=8"`
+}
+
+type testShape interface{ area() float64 }
+
+type testCircle struct{ R float32 }
+
+type testRect struct{ W, H uint16 }
+
+func (c testCircle) area() float64 { return 3 * float64(c.R*c.R) }
+func (r testRect) area() float64   { return float64(r.W) * float64(r.H) }
+
+func init() {
+	litend.RegisterVariant[testShape, testCircle](1)
+	litend.RegisterVariant[testShape, testRect](2)
+	bigend.RegisterVariant[testShape, testCircle](1)
+	bigend.RegisterVariant[testShape, testRect](2)
+}
+
+type testRecord struct {
+	Flags   uint8 `binary:"bits=3"`
+	_       uint8 `binary:"bits=5"`
+	N       uint16
+	Items   []testItem `binary:"len=N"`
+	Sum     uint64     `binary:"if=Flags&1"`
+	Version uint8
+	Extra   int16 `binary:"since=2,version=Version"`
+	Kind    uint8
+	Shape   testShape `binary:"union=Kind"`
+	Size    uint32
+	Names   []string `binary:"size=Size"`
+	Title   string   `binary:"cstring"`
+	Wide    string   `binary:"utf16"`
+	Attrs   map[string]int32
+	Grid    [2][3]int8
+	Z       complex64
+	Count   int
+	Neg     int32  `binary:"bits=5"`
+	On      bool   `binary:"bits=1"`
+	Pad     uint64 `binary:"align=8"`
+}
+
+const testSchema = `{
+	"order": "ORDER",
+	"intSize": 8,
+	"lenSize": 2,
+	"naturalAlign": NATURAL,
+	"types": {
+		"Item": {"fields": [
+			{"name": "ID", "type": "uint32"},
+			{"name": "Name", "type": "string", "binary": "fixed=8"}
+		]},
+		"Shape": {"union": [
+			{"tag": 1, "type": {"fields": [{"name": "R", "type": "float32"}]}},
+			{"tag": 2, "type": {"fields": [{"name": "W", "type": "uint16"}, {"name": "H", "type": "uint16"}]}}
+		]}
+	},
+	"root": {"fields": [
+		{"name": "Flags", "type": "uint8", "binary": "bits=3"},
+		{"name": "_", "type": "uint8", "binary": "bits=5"},
+		{"name": "N", "type": "uint16"},
+		{"name": "Items", "type": {"slice": "Item"}, "binary": "len=N"},
+		{"name": "Sum", "type": "uint64", "binary": "if=Flags&1"},
+		{"name": "Version", "type": "uint8"},
+		{"name": "Extra", "type": "int16", "binary": "since=2,version=Version"},
+		{"name": "Kind", "type": "uint8"},
+		{"name": "Shape", "type": "Shape", "binary": "union=Kind"},
+		{"name": "Size", "type": "uint32"},
+		{"name": "Names", "type": {"slice": "string"}, "binary": "size=Size"},
+		{"name": "Title", "type": "string", "binary": "cstring"},
+		{"name": "Wide", "type": "string", "binary": "utf16"},
+		{"name": "Attrs", "type": {"map": "int32", "key": "string"}},
+		{"name": "Grid", "type": {"array": {"array": "int8", "len": 3}, "len": 2}},
+		{"name": "Z", "type": "complex64"},
+		{"name": "Count", "type": "int"},
+		{"name": "Neg", "type": "int32", "binary": "bits=5"},
+		{"name": "On", "type": "bool", "binary": "bits=1"},
+		{"name": "Pad", "type": "uint64", "binary": "align=8"}
+	]}
+}`
+
+var testValue = testRecord{
+	Flags:   5,
+	N:       2,
+	Items:   []testItem{{1, "one"}, {2, "two"}},
+	Sum:     3,
+	Version: 1,
+	Kind:    2,
+	Shape:   testRect{3, 4},
+	Size:    9,
+	Names:   []string{"ab", "cde"},
+	Title:   "title",
+	Wide:    "wide \U0001F600",
+	Attrs:   map[string]int32{"bb": -2, "a": 1},
+	Grid:    [2][3]int8{{1, 2, 3}, {-4, -5, -6}},
+	Z:       complex(1.5, -2),
+	Count:   -7,
+	Neg:     -3,
+	On:      true,
+	Pad:     9,
+}
+
+var testTree = map[string]any{
+	"Flags": uint64(5),
+	"N":     uint64(2),
+	"Items": []any{
+		map[string]any{"ID": uint64(1), "Name": "one"},
+		map[string]any{"ID": uint64(2), "Name": "two"},
+	},
+	"Sum":     uint64(3),
+	"Version": uint64(1),
+	"Kind":    uint64(2),
+	"Shape":   map[string]any{"W": uint64(3), "H": uint64(4)},
+	"Size":    uint64(9),
+	"Names":   []any{"ab", "cde"},
+	"Title":   "title",
+	"Wide":    "wide \U0001F600",
+	"Attrs":   []any{[]any{"a", int64(1)}, []any{"bb", int64(-2)}},
+	"Grid":    []any{[]any{int64(1), int64(2), int64(3)}, []any{int64(-4), int64(-5), int64(-6)}},
+	"Z":       complex(1.5, -2),
+	"Count":   int64(-7),
+	"Neg":     int64(-3),
+	"On":      true,
+	"Pad":     uint64(9),
+}
+
+func TestCodecCompat(t *testing.T) {
+	for _, order := range []string{"little", "big"} {
+		for _, natural := range []string{"false", "true"} {
+			s, err := Parse([]byte(strings.NewReplacer("ORDER", order, "NATURAL", natural).Replace(testSchema)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			var b bytes.Buffer
+			if order == "little" {
+				err = litend.Codec{IntSize: 8, LenSize: 2, NaturalAlign: natural == "true"}.Write(&b, &testValue)
+			} else {
+				err = bigend.Codec{IntSize: 8, LenSize: 2, NaturalAlign: natural == "true"}.Write(&b, &testValue)
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := b.Bytes()
+
+			v, n, err := s.Decode(want)
+			if err != nil {
+				t.Fatalf("%s natural=%s: Decode: %v", order, natural, err)
+			}
+			if n != len(want) || !reflect.DeepEqual(v, testTree) {
+				t.Errorf("%s natural=%s: Decode = %v, %d\nwant %v, %d", order, natural, v, n, testTree, len(want))
+			}
+
+			got, err := s.Encode(testTree)
+			if err != nil {
+				t.Fatalf("%s natural=%s: Encode: %v", order, natural, err)
+			}
+			if !bytes.Equal(got, want) {
+				t.Errorf("%s natural=%s: Encode = %x\nwant %x", order, natural, got, want)
+			}
+		}
+	}
+}
+
+func TestEncodeFillsHolders(t *testing.T) {
+	s, err := Parse([]byte(`{"root": {"fields": [
+		{"name": "N", "type": "uint8"},
+		{"name": "Size", "type": "uint16", "binary": "bits=12"},
+		{"name": "_", "type": "uint16", "binary": "bits=4"},
+		{"name": "Data", "type": {"slice": "uint16"}, "binary": "len=N"},
+		{"name": "Text", "type": "string", "binary": "size=Size"}
+	]}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := s.Encode(map[string]any{
+		"Data": []any{1.0, 2},
+		"Text": "hi",
+	})
+	want := []byte{2, 2, 0, 1, 0, 2, 0, 'h', 'i'}
+	if err != nil || !bytes.Equal(got, want) {
+		t.Errorf("Encode = %x, %v, want %x", got, err, want)
+	}
+
+	_, err = s.Encode(map[string]any{"N": 3, "Data": []any{1, 2}, "Text": ""})
+	if err == nil {
+		t.Errorf("Encode with a wrong length succeeded")
+	}
+}
+
+func TestOrderSwitch(t *testing.T) {
+	s, err := Parse([]byte(`{
+		"types": {"BE": {"order": "big", "fields": [{"name": "X", "type": "uint16"}]}},
+		"root": {"fields": [
+			{"name": "A", "type": "uint16"},
+			{"name": "B", "type": "BE"},
+			{"name": "C", "type": {"type": "uint32", "order": "big"}}
+		]}
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := []byte{1, 2, 1, 2, 0, 0, 0, 5}
+	v, _, err := s.Decode(b)
+	want := map[string]any{"A": uint64(0x0201), "B": map[string]any{"X": uint64(0x0102)}, "C": uint64(5)}
+	if err != nil || !reflect.DeepEqual(v, want) {
+		t.Errorf("Decode = %v, %v, want %v", v, err, want)
+	}
+}
+
+func TestRecursive(t *testing.T) {
+	s, err := Parse([]byte(`{
+		"lenSize": 1,
+		"types": {"Node": {"fields": [
+			{"name": "V", "type": "int8"},
+			{"name": "Kids", "type": {"slice": "Node"}}
+		]}},
+		"root": {"slice": "Node"}
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := []byte{1, 2, 2, 0, 3, 0, 4, 0}
+	v, n, err := s.Decode(b)
+	if err != nil || n != len(b) {
+		t.Fatalf("Decode = %v, %d, %v", v, n, err)
+	}
+	got, err := s.Encode(v)
+	if err != nil || !bytes.Equal(got, b) {
+		t.Errorf("Encode = %x, %v, want %x", got, err, b)
+	}
+}
+
+func TestInvalidSchema(t *testing.T) {
+	for _, src := range []string{
+		`{}`,
+		`{"root": "float16"}`,
+		`{"root": {"fields": [{"name": "S", "type": "string"}]}}`,
+		`{"root": {"fields": [{"name": "X", "type": "int"}]}}`,
+		`{"root": {"fields": [{"name": "D", "type": {"slice": "uint8"}, "binary": "len=N"}]}}`,
+		`{"root": {"fields": [{"name": "X", "type": "uint8", "binary": "bits=9"}]}}`,
+		`{"types": {"T": {"fields": [{"name": "T", "type": "T"}]}}, "root": "T"}`,
+		`{"root": {"union": [{"tag": 1, "type": "uint8"}]}}`,
+		`{"root": {"slice": "uint8", "array": "uint8"}}`,
+		`{"root": "uint8", "order": "middle"}`,
+		`{"root": {"fields": [{"name": "X", "type": "uint8", "binary": "bogus"}]}}`,
+	} {
+		if _, err := Parse([]byte(src)); err == nil {
+			t.Errorf("Parse(%s) succeeded", src)
+		}
+	}
+}
+
+func TestDecodeError(t *testing.T) {
+	s, err := Parse([]byte(`{"lenSize": 4, "root": {"fields": [
+		{"name": "Items", "type": {"slice": {"fields": [{"name": "S", "type": "string"}]}}}
+	]}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _, err = s.Decode([]byte{2, 0, 0, 0, 0, 0, 0, 0, 1, 0, 0, 0})
+	var e *Error
+	if !errors.As(err, &e) || !errors.Is(err, io.ErrUnexpectedEOF) || e.Path != "Items[1].S" || e.Offset != 12 {
+		t.Errorf("Decode error = %v", err)
+	}
+	_, _, err = s.Decode([]byte{0xff, 0xff, 0xff, 0x7f})
+	if !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("Decode of a huge length = %v", err)
+	}
+}
+
+func TestFromType(t *testing.T) {
+	type node struct {
+		V    int8
+		Kids []*node
+	}
+	v := struct {
+		Items []testItem
+		Tree  node
+		M     map[uint8]bool
+	}{
+		Items: []testItem{{1, "one"}},
+		Tree:  node{V: 1, Kids: []*node{{V: 2}}},
+		M:     map[uint8]bool{3: true},
+	}
+	s, err := FromType(reflect.TypeOf(&v))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Order, s.LenSize = "big", 2
+	var b bytes.Buffer
+	if err := (bigend.Codec{LenSize: 2}).Write(&b, &v); err != nil {
+		t.Fatal(err)
+	}
+	tree, n, err := s.Decode(b.Bytes())
+	if err != nil || n != b.Len() {
+		t.Fatalf("Decode = %v, %d, %v", tree, n, err)
+	}
+	got, err := s.Encode(tree)
+	if err != nil || !bytes.Equal(got, b.Bytes()) {
+		t.Errorf("Encode = %x, %v, want %x", got, err, b.Bytes())
+	}
+
+	if _, err := FromType(reflect.TypeOf(struct{ S testShape }{})); err == nil {
+		t.Errorf("FromType of an interface field succeeded")
+	}
+}
+
+func TestDecodeSpans(t *testing.T) {
+	s, err := Parse([]byte(`{"lenSize": 1, "naturalAlign": true, "root": {"fields": [
+		{"name": "A", "type": "uint8", "binary": "bits=3"},
+		{"name": "_", "type": "uint8", "binary": "bits=5"},
+		{"name": "B", "type": "uint16"},
+		{"name": "S", "type": "string"}
+	]}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var spans []Span
+	_, _, err = s.DecodeSpans([]byte{0x0a, 0, 1, 2, 2, 'h', 'i', 0}, func(sp Span) { spans = append(spans, sp) })
+	want := []Span{
+		{Kind: ValueSpan, Path: "A", Offset: 0, Size: 1, Bits: 3, Value: uint64(2)},
+		{Kind: PaddingSpan, Path: "_", Offset: 0, Size: 1, BitOffset: 3, Bits: 5},
+		{Kind: PaddingSpan, Offset: 1, Size: 1},
+		{Kind: ValueSpan, Path: "B", Offset: 2, Size: 2, Value: uint64(0x0201)},
+		{Kind: LengthSpan, Path: "S", Offset: 4, Size: 1, Value: uint64(2)},
+		{Kind: ValueSpan, Path: "S", Offset: 5, Size: 2, Value: "hi"},
+		{Kind: PaddingSpan, Offset: 7, Size: 1},
+	}
+	if err != nil || !reflect.DeepEqual(spans, want) {
+		t.Errorf("DecodeSpans = %+v, %v\nwant %+v", spans, err, want)
+	}
+}